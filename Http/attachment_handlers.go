@@ -0,0 +1,298 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 图片附件处理器 ====================
+
+const (
+	maxImageSize      = 10 * 1024 * 1024 // 图片最大10MB
+	attachmentURLTTL  = 1 * time.Hour    // 附件上传URL有效期
+	attachmentViewTTL = 1 * time.Hour    // 附件下载URL有效期
+)
+
+// 校验附件所属对象存在
+func validateAttachmentOwner(ctx context.Context, ownerType, ownerID string) error {
+	switch ownerType {
+	case AttachmentOwnerTree:
+		_, err := plantationRepo.GetTree(ctx, ownerID)
+		return err
+	case AttachmentOwnerInspection:
+		_, err := inspectionRepo.Get(ctx, ownerID)
+		return err
+	default:
+		// 设备尚无持久化的注册表，只要求设备ID非空
+		return nil
+	}
+}
+
+// CreateAttachment 创建图片附件并返回预签名上传URL
+// POST /api/v1/attachments
+func CreateAttachment(c *gin.Context) {
+	var req CreateAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 验证图片类型，Content-Type必须与扩展名一致
+	if !ValidateImageType(req.FileType) || GetContentType("."+req.FileType) != req.ContentType {
+		errorResponse(c, http.StatusBadRequest, "不支持的文件类型: "+req.FileType)
+		return
+	}
+
+	if !ValidateFileSize(req.FileSize, maxImageSize) {
+		errorResponse(c, http.StatusBadRequest, "文件大小超出限制")
+		return
+	}
+
+	if err := validateAttachmentOwner(c.Request.Context(), req.OwnerType, req.OwnerID); err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	attachmentID := generateID("att")
+	storageKey := GenerateStorageKey("attachments/"+req.OwnerType+"/"+req.OwnerID, req.FileName)
+
+	metadata := map[string]string{
+		"attachment_id": attachmentID,
+		"owner_type":    req.OwnerType,
+		"owner_id":      req.OwnerID,
+		"upload_time":   time.Now().Format(time.RFC3339),
+	}
+
+	uploadURL, err := presignUpload(storageKey, req.ContentType, req.FileSize, metadata, attachmentURLTTL)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	attachment, err := attachmentRepo.Create(c.Request.Context(), Attachment{
+		ID:          attachmentID,
+		OwnerType:   req.OwnerType,
+		OwnerID:     req.OwnerID,
+		FileName:    req.FileName,
+		FileSize:    req.FileSize,
+		FileType:    strings.ToLower(req.FileType),
+		ContentType: req.ContentType,
+		Description: req.Description,
+		UploadedBy:  req.UploadedBy,
+		Bucket:      defaultBucket,
+		Key:         storageKey,
+		ExpiresAt:   time.Now().Add(attachmentURLTTL),
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	attachment.UploadURL = uploadURL
+
+	successResponse(c, attachment)
+}
+
+// CompleteAttachment 确认图片已上传，并生成缩略图
+// POST /api/v1/attachments/:id/complete
+func CompleteAttachment(c *gin.Context) {
+	ctx := c.Request.Context()
+	attachment, err := attachmentRepo.Get(ctx, c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	// 重复回调直接返回当前状态
+	if attachment.Status == AttachmentUploaded {
+		successResponse(c, withAttachmentURLs(attachment))
+		return
+	}
+	// 过期清理已删除对象，不能再确认
+	if attachment.Status == AttachmentExpired {
+		appErrorResponse(c, ErrUploadGone)
+		return
+	}
+
+	if storageService == nil {
+		appErrorResponse(c, ErrStorageService)
+		return
+	}
+
+	info, err := storageService.GetFileInfo(attachment.Bucket, attachment.Key)
+	if err != nil {
+		appErrorResponse(c, objectInfoError(err))
+		return
+	}
+	if info.Size > maxImageSize {
+		rejectAttachment(ctx, attachment, ErrFileTooLarge)
+		appErrorResponse(c, ErrFileTooLarge)
+		return
+	}
+
+	// 排队等待解码名额；等待期间请求被取消不算附件失败，客户端可以重试
+	if err := acquireThumbnailSlot(ctx); err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	thumbnailKey, width, height, err := generateAttachmentThumbnail(attachment)
+	releaseThumbnailSlot()
+	if err != nil {
+		rejectAttachment(ctx, attachment, err)
+		appErrorResponse(c, err)
+		return
+	}
+
+	attachment, err = attachmentRepo.Update(ctx, attachment.ID, func(a *Attachment) {
+		a.Status = AttachmentUploaded
+		a.FailReason = ""
+		a.FileSize = info.Size
+		a.ThumbnailKey = thumbnailKey
+		a.Width = width
+		a.Height = height
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, withAttachmentURLs(attachment))
+}
+
+// 把附件标记为失败；内容不合格 (过大、类型不符、无法解析) 时同时删除已上传的对象
+func rejectAttachment(ctx context.Context, attachment Attachment, err error) {
+	appErr, ok := err.(AppError)
+	if ok && (appErr.Code == http.StatusRequestEntityTooLarge || appErr.Code == http.StatusUnprocessableEntity) {
+		if err := storageService.DeleteFile(attachment.Bucket, attachment.Key); err != nil {
+			log.Printf("删除不合格的附件对象 %s 失败: %v", attachment.Key, err)
+		}
+	}
+
+	reason := err.Error()
+	if _, err := attachmentRepo.Update(ctx, attachment.ID, func(a *Attachment) {
+		a.Status = AttachmentFailed
+		a.FailReason = reason
+	}); err != nil {
+		log.Printf("标记附件 %s 失败状态失败: %v", attachment.ID, err)
+	}
+}
+
+// 读取原图并把缩略图写到派生对象前缀下
+// 图片类型以对象内容为准，不信任上传时声明的Content-Type
+func generateAttachmentThumbnail(attachment Attachment) (string, int, int, error) {
+	body, err := storageService.GetObject(attachment.Bucket, attachment.Key)
+	if err != nil {
+		return "", 0, 0, AppError{Code: http.StatusServiceUnavailable, Message: "读取图片失败: " + err.Error()}
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(body, maxImageSize+1))
+	if err != nil {
+		return "", 0, 0, AppError{Code: http.StatusServiceUnavailable, Message: "读取图片失败: " + err.Error()}
+	}
+	if len(content) > maxImageSize {
+		return "", 0, 0, ErrFileTooLarge
+	}
+	if detected := http.DetectContentType(content); !sameMediaType(attachment.ContentType, detected) {
+		return "", 0, 0, AppError{Code: http.StatusUnprocessableEntity, Message: "图片内容与声明的类型不一致: " + detected}
+	}
+
+	thumbnail, width, height, err := GenerateThumbnail(bytes.NewReader(content), thumbnailMaxSide)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	thumbnailKey := GenerateDerivedStorageKey(attachment.Key, "thumbnail.jpg")
+	err = storageService.PutObject(attachment.Bucket, thumbnailKey, bytes.NewReader(thumbnail), "image/jpeg", map[string]string{
+		"attachment_id": attachment.ID,
+	})
+	if err != nil {
+		return "", 0, 0, AppError{Code: http.StatusServiceUnavailable, Message: "保存缩略图失败: " + err.Error()}
+	}
+
+	return thumbnailKey, width, height, nil
+}
+
+// 为已上传的附件填充预签名下载URL
+func withAttachmentURLs(attachment Attachment) Attachment {
+	if attachment.Status != AttachmentUploaded || storageService == nil {
+		return attachment
+	}
+
+	if url, err := storageService.GeneratePresignedDownloadURL(attachment.Bucket, attachment.Key, attachmentViewTTL); err == nil {
+		attachment.DownloadURL = url
+	} else {
+		log.Printf("生成附件下载URL失败: %v", err)
+	}
+	if attachment.ThumbnailKey != "" {
+		if url, err := storageService.GeneratePresignedDownloadURL(attachment.Bucket, attachment.ThumbnailKey, attachmentViewTTL); err == nil {
+			attachment.ThumbnailURL = url
+		}
+	}
+	return attachment
+}
+
+// ListAttachments 列出附件
+// GET /api/v1/attachments?owner_type=inspection&owner_id=xxx
+func ListAttachments(c *gin.Context) {
+	attachments, err := attachmentRepo.List(c.Request.Context(), AttachmentFilter{
+		OwnerType: c.Query("owner_type"),
+		OwnerID:   c.Query("owner_id"),
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	for i := range attachments {
+		attachments[i] = withAttachmentURLs(attachments[i])
+	}
+
+	successResponse(c, gin.H{
+		"total":       len(attachments),
+		"attachments": attachments,
+	})
+}
+
+// GetAttachment 获取附件详情
+// GET /api/v1/attachments/:id
+func GetAttachment(c *gin.Context) {
+	attachment, err := attachmentRepo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, withAttachmentURLs(attachment))
+}
+
+// DeleteAttachment 删除附件及其原图和缩略图
+// DELETE /api/v1/attachments/:id
+func DeleteAttachment(c *gin.Context) {
+	attachment, err := attachmentRepo.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	if storageService != nil {
+		for _, key := range []string{attachment.Key, attachment.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := storageService.DeleteFile(attachment.Bucket, key); err != nil {
+				log.Printf("删除附件对象失败 %s: %v", key, err)
+			}
+		}
+	}
+
+	successResponse(c, gin.H{
+		"message":       "附件删除成功",
+		"attachment_id": attachment.ID,
+	})
+}
@@ -0,0 +1,248 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成测试用PNG图片
+func testPNG(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 80, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestGenerateThumbnail(t *testing.T) {
+	thumb, width, height, err := GenerateThumbnail(bytes.NewReader(testPNG(640, 480)), 320)
+	assert.NoError(t, err)
+	assert.Equal(t, 640, width)
+	assert.Equal(t, 480, height)
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 320, config.Width)
+	assert.Equal(t, 240, config.Height)
+
+	_, _, _, err = GenerateThumbnail(strings.NewReader("not an image"), 320)
+	assert.Equal(t, ErrInvalidImage, err)
+
+	// 只读取头部即拒绝像素数过多的图片
+	_, _, _, err = GenerateThumbnail(bytes.NewReader(resizePNGHeader(testPNG(4, 4), 8000, 8000)), 320)
+	assert.Equal(t, ErrImageTooLarge, err)
+	_, _, _, err = GenerateThumbnail(bytes.NewReader(resizePNGHeader(testPNG(4, 4), 5000, 4001)), 320)
+	assert.Equal(t, ErrImageTooLarge, err)
+}
+
+// 修改PNG头中声明的宽高 (重新计算IHDR的CRC)，用于构造解压炸弹
+func resizePNGHeader(content []byte, width, height uint32) []byte {
+	patched := append([]byte{}, content...)
+	ihdr := patched[12:29] // 块类型 + 13字节数据
+	binary.BigEndian.PutUint32(ihdr[4:8], width)
+	binary.BigEndian.PutUint32(ihdr[8:12], height)
+	binary.BigEndian.PutUint32(patched[29:33], crc32.ChecksumIEEE(ihdr))
+	return patched
+}
+
+func TestScaleDownAveragesPixels(t *testing.T) {
+	// 非零原点的NRGBA子图，左半黑右半白
+	src := image.NewNRGBA(image.Rect(0, 0, 6, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 6; x++ {
+			value := uint8(0)
+			if x >= 4 {
+				value = 255
+			}
+			src.SetNRGBA(x, y, color.NRGBA{R: value, G: value, B: value, A: 255})
+		}
+	}
+	sub := src.SubImage(image.Rect(2, 0, 6, 4))
+
+	dst := scaleDown(sub, 2).(*image.RGBA)
+	assert.Equal(t, image.Rect(0, 0, 2, 2), dst.Bounds())
+	assert.Equal(t, color.RGBA{R: 0, G: 0, B: 0, A: 255}, dst.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, dst.RGBAAt(1, 1))
+
+	// JPEG解码得到的YCbCr图片
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 640, 480), image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = 200
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = 128, 128
+	}
+	thumb := scaleDown(ycbcr, 320).(*image.RGBA)
+	assert.Equal(t, image.Rect(0, 0, 320, 240), thumb.Bounds())
+	assert.Equal(t, color.RGBA{R: 200, G: 200, B: 200, A: 255}, thumb.RGBAAt(100, 100))
+}
+
+func TestAttachmentUploadFlow(t *testing.T) {
+	router := setupPlantationRouter()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+
+	// 只允许图片类型
+	code, _ := doJSON(t, router, "POST", "/api/v1/attachments",
+		`{"owner_type":"tree","owner_id":"`+tree.ID+`","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/attachments",
+		`{"owner_type":"tree","owner_id":"tree_missing","file_name":"a.png","file_size":1000,"file_type":"png","content_type":"image/png"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, data := doJSON(t, router, "POST", "/api/v1/attachments",
+		`{"owner_type":"tree","owner_id":"`+tree.ID+`","file_name":"bore_hole.png","file_size":1000,"file_type":"png","content_type":"image/png"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, data["upload_url"])
+	assert.Equal(t, "pending", data["status"])
+	id := data["id"].(string)
+	key := data["key"].(string)
+
+	// 尚未上传
+	code, _ = doJSON(t, router, "POST", "/api/v1/attachments/"+id+"/complete", "")
+	assert.Equal(t, http.StatusConflict, code)
+
+	// 模拟客户端通过预签名URL上传
+	storage.PutObject(defaultBucket, key, bytes.NewReader(testPNG(800, 400)), "image/png", nil)
+
+	code, data = doJSON(t, router, "POST", "/api/v1/attachments/"+id+"/complete", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "uploaded", data["status"])
+	assert.Equal(t, float64(800), data["width"])
+	assert.NotEmpty(t, data["thumbnail_url"])
+
+	thumbnailKey := data["thumbnail_key"].(string)
+	assert.Equal(t, GenerateDerivedStorageKey(key, "thumbnail.jpg"), thumbnailKey)
+	body, err := storage.GetObject(defaultBucket, thumbnailKey)
+	assert.NoError(t, err)
+	thumb, _ := io.ReadAll(body)
+	config, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+	assert.NoError(t, err)
+	assert.Equal(t, thumbnailMaxSide, config.Width)
+
+	code, data = doJSON(t, router, "GET", "/api/v1/attachments?owner_type=tree&owner_id="+tree.ID, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), data["total"])
+
+	code, _ = doJSON(t, router, "DELETE", "/api/v1/attachments/"+id, "")
+	assert.Equal(t, http.StatusOK, code)
+	exists, _ := storage.FileExists(defaultBucket, thumbnailKey)
+	assert.False(t, exists)
+}
+
+func TestAttachmentInvalidImage(t *testing.T) {
+	router := setupPlantationRouter()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+
+	code, data := doJSON(t, router, "POST", "/api/v1/attachments",
+		`{"owner_type":"device","owner_id":"dev_001","file_name":"install.jpg","file_size":1000,"file_type":"jpg","content_type":"image/jpeg"}`)
+	assert.Equal(t, http.StatusOK, code)
+	id := data["id"].(string)
+
+	storage.PutObject(defaultBucket, data["key"].(string), strings.NewReader("garbage"), "image/jpeg", nil)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/attachments/"+id+"/complete", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	attachment, _ := attachmentRepo.Get(context.Background(), id)
+	assert.Equal(t, AttachmentFailed, attachment.Status)
+	exists, _ := storage.FileExists(defaultBucket, attachment.Key)
+	assert.False(t, exists)
+}
+
+// 解码名额被占满时排队；请求取消后返回503，附件保持待上传状态以便重试
+func TestAttachmentThumbnailSlots(t *testing.T) {
+	router := setupPlantationRouter()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+
+	code, data := doJSON(t, router, "POST", "/api/v1/attachments",
+		`{"owner_type":"device","owner_id":"dev_001","file_name":"install.png","file_size":1000,"file_type":"png","content_type":"image/png"}`)
+	assert.Equal(t, http.StatusOK, code)
+	id := data["id"].(string)
+	storage.PutObject(defaultBucket, data["key"].(string), bytes.NewReader(testPNG(64, 64)), "image/png", nil)
+
+	for i := 0; i < thumbnailConcurrency; i++ {
+		assert.NoError(t, acquireThumbnailSlot(context.Background()))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/api/v1/attachments/"+id+"/complete", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	attachment, _ := attachmentRepo.Get(context.Background(), id)
+	assert.Equal(t, AttachmentPending, attachment.Status)
+
+	for i := 0; i < thumbnailConcurrency; i++ {
+		releaseThumbnailSlot()
+	}
+	code, data = doJSON(t, router, "POST", "/api/v1/attachments/"+id+"/complete", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "uploaded", data["status"])
+	assert.Empty(t, thumbnailSlots)
+}
+
+func TestAttachmentRejectedContent(t *testing.T) {
+	router := setupPlantationRouter()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+
+	tests := []struct {
+		name    string
+		content []byte
+		code    int
+	}{
+		// 声明为JPEG但实际内容是PNG
+		{"类型与内容不符", testPNG(16, 16), http.StatusUnprocessableEntity},
+		{"超过大小限制", bytes.Repeat([]byte{0xFF}, maxImageSize+1), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, data := doJSON(t, router, "POST", "/api/v1/attachments",
+				`{"owner_type":"device","owner_id":"dev_001","file_name":"install.jpg","file_size":1000,"file_type":"jpg","content_type":"image/jpeg"}`)
+			assert.Equal(t, http.StatusOK, code)
+			id, key := data["id"].(string), data["key"].(string)
+
+			storage.PutObject(defaultBucket, key, bytes.NewReader(tt.content), "image/jpeg", nil)
+			code, _ = doJSON(t, router, "POST", "/api/v1/attachments/"+id+"/complete", "")
+			assert.Equal(t, tt.code, code)
+
+			// 不合格的对象被删除，附件标记为失败
+			attachment, _ := attachmentRepo.Get(context.Background(), id)
+			assert.Equal(t, AttachmentFailed, attachment.Status)
+			assert.NotEmpty(t, attachment.FailReason)
+			exists, _ := storage.FileExists(defaultBucket, key)
+			assert.False(t, exists)
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package httpserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== 附件持久化 ====================
+
+// 全局附件仓库实例，StartServer中按配置替换
+var attachmentRepo AttachmentRepository = NewMemoryAttachmentRepository()
+
+// AttachmentFilter 附件查询条件，字段为零值表示不过滤
+type AttachmentFilter struct {
+	OwnerType string           // 所属对象类型
+	OwnerID   string           // 所属对象ID
+	Status    AttachmentStatus // 附件状态
+	ExpiresTo time.Time        // 上传URL过期时间上限 (不包含)，用于查找已过期附件
+}
+
+// 判断附件是否符合过滤条件
+func (f AttachmentFilter) matches(attachment Attachment) bool {
+	if f.OwnerType != "" && attachment.OwnerType != f.OwnerType {
+		return false
+	}
+	if f.OwnerID != "" && attachment.OwnerID != f.OwnerID {
+		return false
+	}
+	if f.Status != "" && attachment.Status != f.Status {
+		return false
+	}
+	if !f.ExpiresTo.IsZero() && !attachment.ExpiresAt.Before(f.ExpiresTo) {
+		return false
+	}
+	return true
+}
+
+// AttachmentRepository 图片附件元数据仓库接口
+// 附件对象保存在对象存储中，记录需要同样在重启后保留，否则对象会失去与树木/巡检的关联
+type AttachmentRepository interface {
+	// 保存新附件 (ID由调用方生成，与对象元数据保持一致)，状态为pending
+	Create(ctx context.Context, attachment Attachment) (Attachment, error)
+
+	// 获取附件，不存在时返回ErrAttachmentNotFound
+	Get(ctx context.Context, id string) (Attachment, error)
+
+	// 读取-修改-保存附件，fn在持有附件锁时执行
+	Update(ctx context.Context, id string, fn func(a *Attachment)) (Attachment, error)
+
+	// 删除附件并返回删除前的记录
+	Delete(ctx context.Context, id string) (Attachment, error)
+
+	// 按条件列出附件 (按创建时间排序)
+	List(ctx context.Context, filter AttachmentFilter) ([]Attachment, error)
+
+	// 判断对象是否被附件引用 (原图或缩略图)，用于存储对账
+	ReferencesObject(ctx context.Context, bucket, key string) (bool, error)
+}
+
+// 初始化新附件的状态和时间
+func newAttachment(attachment Attachment, now time.Time) Attachment {
+	attachment.Status = AttachmentPending
+	attachment.CreatedAt = now
+	attachment.UpdatedAt = now
+	// 预签名URL不落库
+	attachment.UploadURL = ""
+	return attachment
+}
+
+// ==================== 内存实现 ====================
+
+// MemoryAttachmentRepository 内存附件仓库
+type MemoryAttachmentRepository struct {
+	mu          sync.RWMutex
+	attachments map[string]*Attachment
+}
+
+// NewMemoryAttachmentRepository 创建内存附件仓库
+func NewMemoryAttachmentRepository() *MemoryAttachmentRepository {
+	return &MemoryAttachmentRepository{attachments: make(map[string]*Attachment)}
+}
+
+// Create 保存新附件
+func (r *MemoryAttachmentRepository) Create(ctx context.Context, attachment Attachment) (Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attachment = newAttachment(attachment, time.Now())
+	r.attachments[attachment.ID] = &attachment
+	return attachment, nil
+}
+
+// Get 获取附件
+func (r *MemoryAttachmentRepository) Get(ctx context.Context, id string) (Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	return *attachment, nil
+}
+
+// Update 更新附件
+func (r *MemoryAttachmentRepository) Update(ctx context.Context, id string, fn func(a *Attachment)) (Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	fn(attachment)
+	attachment.UpdatedAt = time.Now()
+	return *attachment, nil
+}
+
+// Delete 删除附件
+func (r *MemoryAttachmentRepository) Delete(ctx context.Context, id string) (Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	delete(r.attachments, id)
+	return *attachment, nil
+}
+
+// List 按条件列出附件
+func (r *MemoryAttachmentRepository) List(ctx context.Context, filter AttachmentFilter) ([]Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attachments := make([]Attachment, 0)
+	for _, attachment := range r.attachments {
+		if filter.matches(*attachment) {
+			attachments = append(attachments, *attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].CreatedAt.Before(attachments[j].CreatedAt) })
+	return attachments, nil
+}
+
+// ReferencesObject 判断对象是否被附件引用
+func (r *MemoryAttachmentRepository) ReferencesObject(ctx context.Context, bucket, key string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, attachment := range r.attachments {
+		if attachment.Bucket == bucket && (attachment.Key == key || attachment.ThumbnailKey == key) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ==================== MySQL实现 ====================
+
+// 附件表结构
+const attachmentSchema = "CREATE TABLE IF NOT EXISTS attachments (" +
+	"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+	"owner_type VARCHAR(32) NOT NULL," +
+	"owner_id VARCHAR(128) NOT NULL," +
+	"file_name VARCHAR(255) NOT NULL," +
+	"file_size BIGINT NOT NULL," +
+	"file_type VARCHAR(16) NOT NULL," +
+	"content_type VARCHAR(128) NOT NULL," +
+	"description TEXT NOT NULL," +
+	"uploaded_by VARCHAR(128) NOT NULL," +
+	"bucket VARCHAR(128) NOT NULL," +
+	"`key` VARCHAR(512) NOT NULL," +
+	"thumbnail_key VARCHAR(512) NOT NULL," +
+	"width INT NOT NULL," +
+	"height INT NOT NULL," +
+	"status VARCHAR(16) NOT NULL," +
+	"fail_reason TEXT NOT NULL," +
+	"expires_at DATETIME(3) NOT NULL," +
+	"created_at DATETIME(3) NOT NULL," +
+	"updated_at DATETIME(3) NOT NULL," +
+	"KEY idx_attachments_owner_created (owner_type, owner_id, created_at)," +
+	"KEY idx_attachments_status_expires (status, expires_at)," +
+	"UNIQUE KEY uk_attachments_object (bucket, `key`)," +
+	"KEY idx_attachments_thumbnail (bucket, thumbnail_key)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+// 查询列 (顺序与scanAttachment一致)
+const attachmentColumns = "id, owner_type, owner_id, file_name, file_size, file_type, content_type, description, " +
+	"uploaded_by, bucket, `key`, thumbnail_key, width, height, status, fail_reason, expires_at, created_at, updated_at"
+
+// MySQLAttachmentRepository MySQL附件仓库
+// 与其他仓库一样，写入前把时间截断到毫秒，保证读回的附件与写入时一致
+type MySQLAttachmentRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLAttachmentRepository 创建MySQL附件仓库
+func NewMySQLAttachmentRepository(conn *sql.DB) *MySQLAttachmentRepository {
+	return &MySQLAttachmentRepository{db: conn}
+}
+
+// Migrate 创建附件表
+func (r *MySQLAttachmentRepository) Migrate(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, attachmentSchema); err != nil {
+		return fmt.Errorf("创建附件表失败: %v", err)
+	}
+	return nil
+}
+
+// Create 保存新附件
+func (r *MySQLAttachmentRepository) Create(ctx context.Context, attachment Attachment) (Attachment, error) {
+	attachment = newAttachment(attachment, time.Now().Truncate(time.Millisecond))
+	attachment.ExpiresAt = attachment.ExpiresAt.Truncate(time.Millisecond)
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO attachments ("+attachmentColumns+") "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		attachment.ID, attachment.OwnerType, attachment.OwnerID, attachment.FileName, attachment.FileSize,
+		attachment.FileType, attachment.ContentType, attachment.Description, attachment.UploadedBy,
+		attachment.Bucket, attachment.Key, attachment.ThumbnailKey, attachment.Width, attachment.Height,
+		string(attachment.Status), attachment.FailReason, attachment.ExpiresAt, attachment.CreatedAt, attachment.UpdatedAt)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("保存附件失败: %v", err)
+	}
+	return attachment, nil
+}
+
+// Get 获取附件
+func (r *MySQLAttachmentRepository) Get(ctx context.Context, id string) (Attachment, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ?", id)
+	attachment, err := scanAttachment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return Attachment{}, fmt.Errorf("查询附件失败: %v", err)
+	}
+	return attachment, nil
+}
+
+// Update 更新附件
+// 在事务中锁定附件行，确认上传与过期清理并发时按顺序执行
+func (r *MySQLAttachmentRepository) Update(ctx context.Context, id string, fn func(a *Attachment)) (Attachment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ? FOR UPDATE", id)
+	attachment, err := scanAttachment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return Attachment{}, fmt.Errorf("查询附件失败: %v", err)
+	}
+
+	fn(&attachment)
+	attachment.UpdatedAt = time.Now().Truncate(time.Millisecond)
+
+	_, err = tx.ExecContext(ctx, "UPDATE attachments SET file_size = ?, thumbnail_key = ?, width = ?, height = ?, "+
+		"status = ?, fail_reason = ?, updated_at = ? WHERE id = ?",
+		attachment.FileSize, attachment.ThumbnailKey, attachment.Width, attachment.Height,
+		string(attachment.Status), attachment.FailReason, attachment.UpdatedAt, attachment.ID)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("更新附件失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Attachment{}, fmt.Errorf("更新附件失败: %v", err)
+	}
+	return attachment, nil
+}
+
+// Delete 删除附件
+func (r *MySQLAttachmentRepository) Delete(ctx context.Context, id string) (Attachment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ? FOR UPDATE", id)
+	attachment, err := scanAttachment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return Attachment{}, fmt.Errorf("查询附件失败: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments WHERE id = ?", id); err != nil {
+		return Attachment{}, fmt.Errorf("删除附件失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Attachment{}, fmt.Errorf("删除附件失败: %v", err)
+	}
+	return attachment, nil
+}
+
+// List 按条件列出附件
+func (r *MySQLAttachmentRepository) List(ctx context.Context, filter AttachmentFilter) ([]Attachment, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.OwnerType != "" {
+		conditions = append(conditions, "owner_type = ?")
+		args = append(args, filter.OwnerType)
+	}
+	if filter.OwnerID != "" {
+		conditions = append(conditions, "owner_id = ?")
+		args = append(args, filter.OwnerID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(filter.Status))
+	}
+	if !filter.ExpiresTo.IsZero() {
+		conditions = append(conditions, "expires_at < ?")
+		args = append(args, filter.ExpiresTo)
+	}
+
+	query := "SELECT " + attachmentColumns + " FROM attachments"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询附件失败: %v", err)
+	}
+	defer rows.Close()
+
+	attachments := make([]Attachment, 0)
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取附件失败: %v", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取附件失败: %v", err)
+	}
+	return attachments, nil
+}
+
+// ReferencesObject 判断对象是否被附件引用
+func (r *MySQLAttachmentRepository) ReferencesObject(ctx context.Context, bucket, key string) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM attachments WHERE bucket = ? AND (`key` = ? OR thumbnail_key = ?)",
+		bucket, key, key).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("查询附件对象失败: %v", err)
+	}
+	return count > 0, nil
+}
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	var attachment Attachment
+	var status string
+	err := row.Scan(&attachment.ID, &attachment.OwnerType, &attachment.OwnerID, &attachment.FileName, &attachment.FileSize,
+		&attachment.FileType, &attachment.ContentType, &attachment.Description, &attachment.UploadedBy,
+		&attachment.Bucket, &attachment.Key, &attachment.ThumbnailKey, &attachment.Width, &attachment.Height,
+		&status, &attachment.FailReason, &attachment.ExpiresAt, &attachment.CreatedAt, &attachment.UpdatedAt)
+	if err != nil {
+		return Attachment{}, err
+	}
+	attachment.Status = AttachmentStatus(status)
+	return attachment, nil
+}
@@ -0,0 +1,112 @@
+package httpserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAttachmentRepository(t *testing.T) (*MySQLAttachmentRepository, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("创建sqlmock失败: %v", err)
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		conn.Close()
+	})
+	return NewMySQLAttachmentRepository(conn), mock
+}
+
+func attachmentRows(attachments ...Attachment) *sqlmock.Rows {
+	rows := sqlmock.NewRows(columnNames(attachmentColumns))
+	for _, a := range attachments {
+		rows.AddRow(a.ID, a.OwnerType, a.OwnerID, a.FileName, a.FileSize, a.FileType, a.ContentType, a.Description,
+			a.UploadedBy, a.Bucket, a.Key, a.ThumbnailKey, a.Width, a.Height, string(a.Status), a.FailReason,
+			a.ExpiresAt, a.CreatedAt, a.UpdatedAt)
+	}
+	return rows
+}
+
+func TestMySQLAttachmentRepositoryCreate(t *testing.T) {
+	repo, mock := newMockAttachmentRepository(t)
+	ctx := context.Background()
+	expiresAt := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(attachmentSchema).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, repo.Migrate(ctx))
+
+	// 预签名URL不落库
+	mock.ExpectExec("INSERT INTO attachments ("+attachmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs("att_1", "tree", "tree_a", "hole.jpg", int64(2048), "jpg", "image/jpeg", "", "installer",
+			defaultBucket, "attachments/tree/tree_a/hole.jpg", "", 0, 0, "pending", "", expiresAt,
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	attachment, err := repo.Create(ctx, Attachment{ID: "att_1", OwnerType: "tree", OwnerID: "tree_a", FileName: "hole.jpg",
+		FileSize: 2048, FileType: "jpg", ContentType: "image/jpeg", UploadedBy: "installer", Bucket: defaultBucket,
+		Key: "attachments/tree/tree_a/hole.jpg", UploadURL: "http://storage.test/upload", ExpiresAt: expiresAt.Add(300 * time.Microsecond)})
+	assert.NoError(t, err)
+	assert.Equal(t, AttachmentPending, attachment.Status)
+	assert.Empty(t, attachment.UploadURL)
+	assert.Equal(t, expiresAt, attachment.ExpiresAt)
+}
+
+func TestMySQLAttachmentRepositoryUpdate(t *testing.T) {
+	repo, mock := newMockAttachmentRepository(t)
+	ctx := context.Background()
+	created := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	pending := Attachment{ID: "att_1", OwnerType: "tree", OwnerID: "tree_a", Bucket: defaultBucket,
+		Key: "attachments/tree/tree_a/hole.jpg", Status: AttachmentPending, ExpiresAt: created.Add(time.Hour),
+		CreatedAt: created, UpdatedAt: created}
+	selectForUpdate := "SELECT " + attachmentColumns + " FROM attachments WHERE id = ? FOR UPDATE"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectForUpdate).WithArgs("att_1").WillReturnRows(attachmentRows(pending))
+	mock.ExpectExec("UPDATE attachments SET file_size = ?, thumbnail_key = ?, width = ?, height = ?, "+
+		"status = ?, fail_reason = ?, updated_at = ? WHERE id = ?").
+		WithArgs(int64(4096), "attachments/tree/tree_a/hole.derived/thumbnail.jpg", 640, 480, "uploaded", "",
+			sqlmock.AnyArg(), "att_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	updated, err := repo.Update(ctx, "att_1", func(a *Attachment) {
+		a.Status = AttachmentUploaded
+		a.FileSize = 4096
+		a.ThumbnailKey = "attachments/tree/tree_a/hole.derived/thumbnail.jpg"
+		a.Width = 640
+		a.Height = 480
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, AttachmentUploaded, updated.Status)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectForUpdate).WithArgs("att_missing").WillReturnRows(attachmentRows())
+	mock.ExpectRollback()
+	_, err = repo.Update(ctx, "att_missing", func(a *Attachment) {})
+	assert.Equal(t, ErrAttachmentNotFound, err)
+}
+
+func TestMySQLAttachmentRepositoryQueries(t *testing.T) {
+	repo, mock := newMockAttachmentRepository(t)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	// 过期清理按状态和过期时间查询
+	mock.ExpectQuery("SELECT "+attachmentColumns+" FROM attachments WHERE status = ? AND expires_at < ? ORDER BY created_at, id").
+		WithArgs("pending", now).
+		WillReturnRows(attachmentRows(Attachment{ID: "att_1", Status: AttachmentPending, ExpiresAt: now.Add(-time.Minute),
+			CreatedAt: now.Add(-time.Hour), UpdatedAt: now.Add(-time.Hour)}))
+	attachments, err := repo.List(ctx, AttachmentFilter{Status: AttachmentPending, ExpiresTo: now})
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 1)
+
+	// 缩略图同样算作被引用
+	mock.ExpectQuery("SELECT COUNT(*) FROM attachments WHERE bucket = ? AND (`key` = ? OR thumbnail_key = ?)").
+		WithArgs(defaultBucket, "attachments/tree/t1/a.derived/thumbnail.jpg", "attachments/tree/t1/a.derived/thumbnail.jpg").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	referenced, err := repo.ReferencesObject(ctx, defaultBucket, "attachments/tree/t1/a.derived/thumbnail.jpg")
+	assert.NoError(t, err)
+	assert.True(t, referenced)
+}
@@ -3,16 +3,19 @@ package httpserver
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // 配置结构体
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Kafka    KafkaConfig
+	Server       ServerConfig
+	Database     DatabaseConfig
+	Redis        RedisConfig
+	JWT          JWTConfig
+	Kafka        KafkaConfig
+	Notification NotificationConfig
+	Upload       UploadConfig
 }
 
 // 服务器配置
@@ -26,6 +29,7 @@ type ServerConfig struct {
 
 // 数据库配置
 type DatabaseConfig struct {
+	Driver       string // mysql 或 memory (本地开发，不持久化)
 	Host         string
 	Port         int
 	Username     string
@@ -53,6 +57,35 @@ type KafkaConfig struct {
 	GroupID string
 }
 
+// 通知配置
+type NotificationConfig struct {
+	SMTPHost            string
+	SMTPPort            int
+	SMTPUsername        string
+	SMTPPassword        string
+	SMTPFrom            string
+	SMTPTimeout         time.Duration // 单封邮件的连接和发送超时
+	SMSGatewayURL       string
+	SMSGatewayAPIKey    string
+	HTTPTimeout         time.Duration
+	WebhookAllowedHosts []string // 允许回调指向内网地址的主机名
+	LocalOnly           bool     // 本地开发模式: 所有渠道都写入日志/文件
+	LogFile             string   // 日志通知文件，为空时写入标准日志
+	MaxAttempts         int
+	InitialBackoff      time.Duration
+	MaxBackoff          time.Duration
+	Retention           time.Duration // 已发送和最终失败投递的保留时间
+}
+
+// 上传任务维护配置
+type UploadConfig struct {
+	SweepInterval     time.Duration // 过期任务清理间隔
+	ReconcileInterval time.Duration // 存储对账间隔，0表示只通过接口手动触发
+	ReconcileRepair   bool          // 定期对账时是否自动修复
+	OrphanGracePeriod time.Duration // 对象至少存在多久才会被视为孤儿对象 (不小于10分钟)
+	AdminToken        string        // 存储对账接口的认证令牌，为空时不允许手动对账
+}
+
 // 从环境变量加载配置
 func LoadConfig() *Config {
 	config := &Config{
@@ -64,6 +97,7 @@ func LoadConfig() *Config {
 			IdleTimeout:  getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
 		},
 		Database: DatabaseConfig{
+			Driver:       getEnv("DB_DRIVER", "mysql"),
 			Host:         getEnv("DB_HOST", "localhost"),
 			Port:         getIntEnv("DB_PORT", 3306),
 			Username:     getEnv("DB_USERNAME", "root"),
@@ -90,6 +124,31 @@ func LoadConfig() *Config {
 			Topic:   getEnv("KAFKA_TOPIC", "audio_detection"),
 			GroupID: getEnv("KAFKA_GROUP_ID", "detection_group"),
 		},
+		Notification: NotificationConfig{
+			SMTPHost:            getEnv("SMTP_HOST", ""),
+			SMTPPort:            getIntEnv("SMTP_PORT", 587),
+			SMTPUsername:        getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom:            getEnv("SMTP_FROM", "alerts@pest-detection.local"),
+			SMTPTimeout:         getDurationEnv("SMTP_TIMEOUT", 30*time.Second),
+			SMSGatewayURL:       getEnv("SMS_GATEWAY_URL", ""),
+			SMSGatewayAPIKey:    getEnv("SMS_GATEWAY_API_KEY", ""),
+			HTTPTimeout:         getDurationEnv("NOTIFY_HTTP_TIMEOUT", 10*time.Second),
+			WebhookAllowedHosts: getStringSliceEnv("NOTIFY_WEBHOOK_ALLOWED_HOSTS", nil),
+			LocalOnly:           getEnv("NOTIFY_LOCAL_ONLY", "false") == "true",
+			LogFile:             getEnv("NOTIFY_LOG_FILE", ""),
+			MaxAttempts:         getIntEnv("NOTIFY_MAX_ATTEMPTS", 3),
+			InitialBackoff:      getDurationEnv("NOTIFY_INITIAL_BACKOFF", 1*time.Second),
+			MaxBackoff:          getDurationEnv("NOTIFY_MAX_BACKOFF", 30*time.Second),
+			Retention:           getDurationEnv("NOTIFY_RETENTION", defaultNotificationRetention),
+		},
+		Upload: UploadConfig{
+			SweepInterval:     getDurationEnv("UPLOAD_SWEEP_INTERVAL", 10*time.Minute),
+			ReconcileInterval: getDurationEnv("UPLOAD_RECONCILE_INTERVAL", 24*time.Hour),
+			ReconcileRepair:   getEnv("UPLOAD_RECONCILE_REPAIR", "false") == "true",
+			OrphanGracePeriod: getDurationEnv("UPLOAD_ORPHAN_GRACE_PERIOD", 1*time.Hour),
+			AdminToken:        os.Getenv("STORAGE_ADMIN_TOKEN"),
+		},
 	}
 
 	return config
@@ -126,9 +185,14 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 // 获取字符串切片环境变量
 func getStringSliceEnv(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
-		// 简单的逗号分隔实现
-		// 在生产环境中可能需要更复杂的解析逻辑
-		return []string{value}
+		// 逗号分隔，忽略空白和空项
+		values := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		return values
 	}
 	return defaultValue
 }
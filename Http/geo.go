@@ -0,0 +1,123 @@
+package httpserver
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ==================== GeoJSON与地理计算 ====================
+
+// 地球平均半径(米)
+const earthRadiusMeters = 6371000.0
+
+// GeoJSON要素集合
+type FeatureCollection struct {
+	Type     string    `json:"type"` // 固定为 FeatureCollection
+	Features []Feature `json:"features"`
+}
+
+// GeoJSON要素
+type Feature struct {
+	Type       string                 `json:"type"` // 固定为 Feature
+	ID         string                 `json:"id,omitempty"`
+	Geometry   PointGeometry          `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSON点几何 (坐标顺序为 [经度, 纬度])
+type PointGeometry struct {
+	Type        string     `json:"type"` // 固定为 Point
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// NewFeatureCollection 创建空的要素集合
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+}
+
+// AddPoint 添加一个点要素
+func (fc *FeatureCollection) AddPoint(id string, lat, lon float64, properties map[string]interface{}) {
+	fc.Features = append(fc.Features, Feature{
+		Type:       "Feature",
+		ID:         id,
+		Geometry:   PointGeometry{Type: "Point", Coordinates: [2]float64{lon, lat}},
+		Properties: properties,
+	})
+}
+
+// BoundingBox 经纬度矩形范围
+type BoundingBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// ParseBoundingBox 解析 "minLon,minLat,maxLon,maxLat" 格式的范围 (与GeoJSON bbox顺序一致)
+// 与GeoJSON (RFC 7946) 相同，minLon大于maxLon表示跨越180度经线的范围
+func ParseBoundingBox(value string) (*BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox格式应为 minLon,minLat,maxLon,maxLat")
+	}
+
+	var numbers [4]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox包含无效数字: %s", part)
+		}
+		numbers[i] = n
+	}
+
+	box := &BoundingBox{MinLon: numbers[0], MinLat: numbers[1], MaxLon: numbers[2], MaxLat: numbers[3]}
+	if err := ValidateCoordinates(box.MinLat, box.MinLon); err != nil {
+		return nil, fmt.Errorf("bbox%s", err.Error())
+	}
+	if err := ValidateCoordinates(box.MaxLat, box.MaxLon); err != nil {
+		return nil, fmt.Errorf("bbox%s", err.Error())
+	}
+	if box.MinLat > box.MaxLat {
+		return nil, fmt.Errorf("bbox最小纬度不能大于最大纬度")
+	}
+	return box, nil
+}
+
+// Contains 判断点是否在范围内
+func (b *BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	// 跨越180度经线时范围分为 [minLon, 180] 和 [-180, maxLon] 两段
+	if b.MinLon > b.MaxLon {
+		return lon >= b.MinLon || lon <= b.MaxLon
+	}
+	return lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// ValidateCoordinates 检查纬度在±90、经度在±180范围内
+func ValidateCoordinates(lat, lon float64) error {
+	if math.IsNaN(lat) || math.IsInf(lat, 0) || math.IsNaN(lon) || math.IsInf(lon, 0) {
+		return fmt.Errorf("经纬度必须为有限数字")
+	}
+	if !(lat >= -90 && lat <= 90) {
+		return fmt.Errorf("纬度超出范围[-90, 90]: %v", lat)
+	}
+	if !(lon >= -180 && lon <= 180) {
+		return fmt.Errorf("经度超出范围[-180, 180]: %v", lon)
+	}
+	return nil
+}
+
+// DistanceMeters 使用haversine公式计算两点间的地面距离(米)
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
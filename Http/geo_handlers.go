@@ -0,0 +1,158 @@
+package httpserver
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 地图与地理查询处理器 ====================
+// 地图接口直接返回GeoJSON，不包装在Response中，便于GIS工具直接加载
+
+// 地理过滤条件
+type geoFilter struct {
+	box    *BoundingBox
+	center *[2]float64 // [纬度, 经度]
+	radius float64     // 米
+}
+
+// 解析 bbox / lat+lon+radius / near_tree+radius 查询参数
+func parseGeoFilter(c *gin.Context) (*geoFilter, error) {
+	filter := &geoFilter{}
+
+	if value := c.Query("bbox"); value != "" {
+		box, err := ParseBoundingBox(value)
+		if err != nil {
+			return nil, AppError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		filter.box = box
+	}
+
+	radiusValue := c.Query("radius")
+	if radiusValue == "" {
+		// 只给出中心点而没有半径时无法过滤，不能静默返回全部结果
+		if c.Query("near_tree") != "" || c.Query("lat") != "" || c.Query("lon") != "" {
+			return nil, AppError{Code: http.StatusBadRequest, Message: "near_tree或lat/lon需要同时提供radius参数"}
+		}
+		return filter, nil
+	}
+
+	radius, err := strconv.ParseFloat(radiusValue, 64)
+	// NaN与任何数比较都为false，需要单独排除；Inf会匹配全部结果
+	if err != nil || math.IsNaN(radius) || math.IsInf(radius, 0) || radius <= 0 {
+		return nil, AppError{Code: http.StatusBadRequest, Message: "radius必须为正数(米)"}
+	}
+	filter.radius = radius
+
+	if treeID := c.Query("near_tree"); treeID != "" {
+		tree, err := plantationRepo.GetTree(c.Request.Context(), treeID)
+		if err != nil {
+			return nil, err
+		}
+		filter.center = &[2]float64{tree.Latitude, tree.Longitude}
+		return filter, nil
+	}
+
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, lonErr := strconv.ParseFloat(c.Query("lon"), 64)
+	if latErr != nil || lonErr != nil {
+		return nil, AppError{Code: http.StatusBadRequest, Message: "按半径查询需要 lat/lon 或 near_tree 参数"}
+	}
+	if err := ValidateCoordinates(lat, lon); err != nil {
+		return nil, AppError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	filter.center = &[2]float64{lat, lon}
+	return filter, nil
+}
+
+// 判断点是否满足过滤条件，返回到中心点的距离(没有中心点时为-1)
+func (f *geoFilter) match(lat, lon float64) (bool, float64) {
+	if f.box != nil && !f.box.Contains(lat, lon) {
+		return false, -1
+	}
+	if f.center == nil {
+		return true, -1
+	}
+	distance := DistanceMeters(f.center[0], f.center[1], lat, lon)
+	return distance <= f.radius, distance
+}
+
+// GetTreesGeoJSON 以GeoJSON返回树木位置
+// GET /api/v1/plantation/geo/trees?bbox=minLon,minLat,maxLon,maxLat
+// GET /api/v1/plantation/geo/trees?near_tree=tree_xxx&radius=50
+// GET /api/v1/plantation/geo/trees?lat=24.1&lon=45.2&radius=50
+func GetTreesGeoJSON(c *gin.Context) {
+	filter, err := parseGeoFilter(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	trees, err := plantationRepo.ListAllTrees(c.Request.Context())
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	collection := NewFeatureCollection()
+	for _, tree := range trees {
+		ok, distance := filter.match(tree.Latitude, tree.Longitude)
+		if !ok {
+			continue
+		}
+
+		properties := map[string]interface{}{
+			"kind":         "tree",
+			"code":         tree.Code,
+			"farm_id":      tree.FarmID,
+			"block_id":     tree.BlockID,
+			"species":      tree.Species,
+			"planted_year": tree.PlantedYear,
+		}
+		if distance >= 0 {
+			properties["distance_m"] = distance
+		}
+		collection.AddPoint(tree.ID, tree.Latitude, tree.Longitude, properties)
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// GetDevicesGeoJSON 以GeoJSON返回设备当前位置
+// GET /api/v1/plantation/geo/devices?bbox=minLon,minLat,maxLon,maxLat
+func GetDevicesGeoJSON(c *gin.Context) {
+	filter, err := parseGeoFilter(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	positions, err := DevicePositions(c.Request.Context(), time.Now())
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	collection := NewFeatureCollection()
+	for _, position := range positions {
+		ok, distance := filter.match(position.Latitude, position.Longitude)
+		if !ok {
+			continue
+		}
+
+		properties := map[string]interface{}{
+			"kind":     "device",
+			"tree_id":  position.TreeID,
+			"position": position.Source,
+		}
+		if distance >= 0 {
+			properties["distance_m"] = distance
+		}
+		collection.AddPoint(position.DeviceID, position.Latitude, position.Longitude, properties)
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
@@ -0,0 +1,125 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	// 同一点
+	assert.InDelta(t, 0, DistanceMeters(24.1, 45.2, 24.1, 45.2), 1e-6)
+
+	// 纬度相差0.001度约111米
+	assert.InDelta(t, 111.2, DistanceMeters(24.0, 45.0, 24.001, 45.0), 0.5)
+}
+
+func TestParseBoundingBox(t *testing.T) {
+	box, err := ParseBoundingBox("45.0,24.0,45.1,24.1")
+	assert.NoError(t, err)
+	assert.True(t, box.Contains(24.05, 45.05))
+	assert.False(t, box.Contains(24.2, 45.05))
+
+	_, err = ParseBoundingBox("45.0,24.0,45.1")
+	assert.Error(t, err)
+
+	// 最小经度大于最大经度表示跨越180度经线
+	box, err = ParseBoundingBox("179.5,-17.0,-179.5,-16.0")
+	assert.NoError(t, err)
+	assert.True(t, box.Contains(-16.5, 179.8))
+	assert.True(t, box.Contains(-16.5, -179.8))
+	assert.False(t, box.Contains(-16.5, 0))
+
+	for _, value := range []string{
+		"45.0,24.1,45.1,24.0", // 最小纬度大于最大纬度
+		"45.0,-91,45.1,24.0",  // 纬度超出范围
+		"-181,24.0,45.1,24.1", // 经度超出范围
+		"45.0,24.0,NaN,24.1",
+	} {
+		_, err = ParseBoundingBox(value)
+		assert.Error(t, err, value)
+	}
+}
+
+// 获取GeoJSON要素集合
+func getFeatureCollection(t *testing.T, path string) (int, FeatureCollection) {
+	router := newTestEngine()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+
+	var collection FeatureCollection
+	if w.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &collection))
+	}
+	return w.Code, collection
+}
+
+func TestTreesGeoJSON(t *testing.T) {
+	setupPlantationRouter()
+	block := seedBlock(t)
+	center := seedTree(t, Tree{BlockID: block.ID, Code: "P-001", Latitude: 24.0, Longitude: 45.0})
+	near := seedTree(t, Tree{BlockID: block.ID, Code: "P-002", Latitude: 24.0003, Longitude: 45.0})
+	seedTree(t, Tree{BlockID: block.ID, Code: "P-003", Latitude: 24.01, Longitude: 45.0})
+
+	code, all := getFeatureCollection(t, "/api/v1/plantation/geo/trees")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "FeatureCollection", all.Type)
+	assert.Len(t, all.Features, 3)
+	assert.Equal(t, [2]float64{45.0, 24.0}, all.Features[0].Geometry.Coordinates)
+
+	// 50米范围内只有自身和相邻的树
+	code, nearby := getFeatureCollection(t, "/api/v1/plantation/geo/trees?near_tree="+center.ID+"&radius=50")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, nearby.Features, 2)
+	assert.Equal(t, near.ID, nearby.Features[1].ID)
+
+	code, boxed := getFeatureCollection(t, "/api/v1/plantation/geo/trees?bbox=44.9,24.005,45.1,24.02")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, boxed.Features, 1)
+
+	for _, query := range []string{
+		"radius=50",                   // 缺少中心点
+		"near_tree=" + center.ID,      // 缺少半径
+		"lat=24&lon=45",               // 缺少半径
+		"lat=95&lon=45&radius=50",     // 纬度超出范围
+		"lat=24&lon=200&radius=50",    // 经度超出范围
+		"bbox=44.9,24.005,45.1,100.0", // 纬度超出范围
+		"lat=24&lon=45&radius=NaN",    // 半径不是数字
+		"lat=24&lon=45&radius=Inf",    // 半径无穷大
+		"lat=24&lon=45&radius=-1",     // 半径为负
+		"lat=NaN&lon=45&radius=50",    // 纬度不是数字
+		"lat=24&lon=-Inf&radius=50",   // 经度无穷大
+	} {
+		code, _ = getFeatureCollection(t, "/api/v1/plantation/geo/trees?"+query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestDevicesGeoJSON(t *testing.T) {
+	setupPlantationRouter()
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001", Latitude: 24.0, Longitude: 45.0})
+
+	// 登记坐标会被安装位置覆盖
+	ctx := context.Background()
+	_, err := plantationRepo.SetDeviceLocation(ctx, DeviceLocation{DeviceID: "dev_001", Latitude: 10, Longitude: 10})
+	assert.NoError(t, err)
+	_, err = plantationRepo.AttachSensor(ctx, "dev_001", tree.ID, tree.CreatedAt, "")
+	assert.NoError(t, err)
+	_, err = plantationRepo.SetDeviceLocation(ctx, DeviceLocation{DeviceID: "dev_002", Latitude: 24.5, Longitude: 45.5})
+	assert.NoError(t, err)
+
+	code, devices := getFeatureCollection(t, "/api/v1/plantation/geo/devices")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, devices.Features, 2)
+	assert.Equal(t, "dev_001", devices.Features[0].ID)
+	assert.Equal(t, [2]float64{45.0, 24.0}, devices.Features[0].Geometry.Coordinates)
+	assert.Equal(t, "placement", devices.Features[0].Properties["position"])
+	assert.Equal(t, "registered", devices.Features[1].Properties["position"])
+}
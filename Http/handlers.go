@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -38,9 +39,12 @@ type AudioUploadRequest struct {
 
 // 设备注册请求
 type DeviceRegisterRequest struct {
-	DeviceID   string `json:"device_id" binding:"required"`
-	DeviceName string `json:"device_name" binding:"required"`
-	Location   string `json:"location"`
+	DeviceID   string   `json:"device_id" binding:"required"`
+	DeviceName string   `json:"device_name" binding:"required"`
+	Location   string   `json:"location"`
+	TreeID     string   `json:"tree_id"`                                        // 安装的树木ID (可选)
+	Latitude   *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`    // 纬度 (可选)
+	Longitude  *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"` // 经度 (可选)
 }
 
 // 成功响应
@@ -53,6 +57,16 @@ func successResponse(c *gin.Context, data interface{}) {
 	})
 }
 
+// 已接受响应，请求已入队，由后台异步处理
+func acceptedResponse(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusAccepted, Response{
+		Code:    202,
+		Message: "已接受，正在处理",
+		Data:    data,
+		Time:    time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
+
 // 错误响应
 func errorResponse(c *gin.Context, code int, message string) {
 	c.JSON(code, Response{
@@ -62,6 +76,15 @@ func errorResponse(c *gin.Context, code int, message string) {
 	})
 }
 
+// 根据AppError返回错误响应，其他错误按服务器内部错误处理
+func appErrorResponse(c *gin.Context, err error) {
+	if appErr, ok := err.(AppError); ok {
+		errorResponse(c, appErr.Code, appErr.Message)
+		return
+	}
+	errorResponse(c, http.StatusInternalServerError, "服务器内部错误: "+err.Error())
+}
+
 // ==================== 认证相关处理函数 ====================
 
 // 用户登录
@@ -288,14 +311,54 @@ func handleDeviceRegister(c *gin.Context) {
 	// 2. 创建设备记录
 	// 3. 分配初始配置
 
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		errorResponse(c, http.StatusBadRequest, "经纬度必须同时提供")
+		return
+	}
+
+	// 注册时指定了树木则同时记录安装信息，安装失败 (树木不存在等) 时不保存任何数据
+	// 设备重复注册且仍安装在同一棵树上时沿用当前记录，不重复追加
+	var placement *SensorPlacement
+	if req.TreeID != "" {
+		ctx := c.Request.Context()
+		now := time.Now()
+		current, err := plantationRepo.PlacementAt(ctx, req.DeviceID, now)
+		if err != nil && !errors.Is(err, ErrPlacementNotFound) {
+			appErrorResponse(c, err)
+			return
+		}
+		if err == nil && current.DetachedAt == nil && current.TreeID == req.TreeID {
+			placement = &current
+		} else {
+			p, err := plantationRepo.AttachSensor(ctx, req.DeviceID, req.TreeID, now, "设备注册时安装")
+			if err != nil {
+				appErrorResponse(c, err)
+				return
+			}
+			placement = &p
+		}
+	}
+
+	// 记录设备坐标
+	if req.Latitude != nil {
+		location := DeviceLocation{DeviceID: req.DeviceID, Latitude: *req.Latitude, Longitude: *req.Longitude}
+		if _, err := plantationRepo.SetDeviceLocation(c.Request.Context(), location); err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+	}
+
 	successResponse(c, gin.H{
 		"message": "设备注册成功",
 		"device": gin.H{
 			"device_id":     req.DeviceID,
 			"device_name":   req.DeviceName,
 			"location":      req.Location,
+			"latitude":      req.Latitude,
+			"longitude":     req.Longitude,
 			"register_time": time.Now().Format("2006-01-02 15:04:05"),
 			"status":        "registered",
 		},
+		"placement": placement,
 	})
 }
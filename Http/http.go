@@ -1,6 +1,8 @@
 package httpserver
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -64,8 +66,35 @@ func SetupRoutes(engine *gin.Engine) {
 		jobs.GET("/:id", GetUploadJobStatus)                // 获取任务状态
 		jobs.DELETE("/:id", DeleteUploadJob)                // 删除任务
 		jobs.POST("/:id/complete", UploadCompletionWebhook) // 上传完成回调
+		jobs.PUT("/:id/upload", DirectUpload)               // 服务端直传 (原始内容)
+		jobs.POST("/:id/upload", DirectUpload)              // 服务端直传 (multipart表单)
+		jobs.POST("/:id/clips", ExtractEventClips)          // 截取事件片段
+		jobs.GET("/:id/clips", ListEventClips)              // 已截取的事件片段
+
+		jobs.POST("/multipart", CreateMultipartUploadJob)                // 创建分片上传任务
+		jobs.GET("/:id/parts", ListUploadJobParts)                       // 已上传分片 (断线续传)
+		jobs.POST("/:id/multipart/complete", CompleteMultipartUploadJob) // 合并分片
+		jobs.DELETE("/:id/multipart", AbortMultipartUploadJob)           // 取消分片上传
 	}
 
+	// tus断点续传 (无法直连S3的网关)
+	tus := api.Group("/tus", TusMiddleware())
+	{
+		tus.OPTIONS("", TusOptions)            // 协议能力
+		tus.POST("", CreateTusUpload)          // 创建上传
+		tus.HEAD("/:id", GetTusUploadOffset)   // 查询偏移量
+		tus.PATCH("/:id", PatchTusUpload)      // 追加数据
+		tus.DELETE("/:id", TerminateTusUpload) // 终止上传
+	}
+
+	// 存储桶事件通知 (MinIO webhook / S3)
+	api.POST("/storage/events", HandleBucketEvent)
+	api.POST("/storage/reconcile", ReconcileStorage) // 存储对账
+
+	// 本地存储的预签名上传/下载 (STORAGE_PROVIDER=local)
+	api.PUT("/storage/local/:bucket/*key", LocalStorageUpload)
+	api.GET("/storage/local/:bucket/*key", LocalStorageDownload)
+
 	// 设备管理相关路由
 	device := api.Group("/device")
 	{
@@ -73,16 +102,79 @@ func SetupRoutes(engine *gin.Engine) {
 		device.GET("/:id", handleDeviceInfo)
 		device.POST("/register", handleDeviceRegister)
 	}
+
+	// 种植园管理路由 (农场/地块/树木/传感器安装)
+	plantation := api.Group("/plantation")
+	{
+		plantation.POST("/farms", CreateFarm)                           // 创建农场
+		plantation.GET("/farms", ListFarms)                             // 列出农场
+		plantation.GET("/farms/:id", GetFarm)                           // 获取农场详情
+		plantation.POST("/farms/:id/blocks", CreateBlock)               // 创建地块
+		plantation.GET("/farms/:id/blocks", ListBlocks)                 // 列出地块
+		plantation.POST("/blocks/:id/trees", CreateTree)                // 登记树木
+		plantation.GET("/blocks/:id/trees", ListTrees)                  // 列出树木
+		plantation.GET("/trees/:id", GetTree)                           // 获取树木详情
+		plantation.POST("/trees/:id/treatments", CreateTreatment)       // 记录处理
+		plantation.GET("/trees/:id/treatments", ListTreatments)         // 处理记录列表
+		plantation.POST("/placements", AttachSensor)                    // 安装传感器
+		plantation.POST("/placements/:id/detach", DetachSensor)         // 拆除传感器
+		plantation.GET("/devices/:id/placements", ListDevicePlacements) // 设备安装历史
+		plantation.GET("/devices/:id/placement", GetDevicePlacement)    // 设备在某时间点的安装位置
+		plantation.GET("/geo/trees", GetTreesGeoJSON)                   // 树木GeoJSON
+		plantation.GET("/geo/devices", GetDevicesGeoJSON)               // 设备GeoJSON
+	}
+
+	// 巡检任务路由
+	inspections := api.Group("/inspections")
+	{
+		inspections.POST("", CreateInspection)                // 创建巡检任务
+		inspections.GET("", ListInspections)                  // 列出巡检任务
+		inspections.GET("/:id", GetInspection)                // 获取巡检任务详情
+		inspections.POST("/:id/assign", AssignInspection)     // 分配巡检人员
+		inspections.POST("/:id/start", StartInspection)       // 开始巡检
+		inspections.POST("/:id/complete", CompleteInspection) // 提交巡检结果
+		inspections.POST("/:id/cancel", CancelInspection)     // 取消巡检任务
+	}
+	api.GET("/workers/:id/inspections", ListWorkerInspections) // 巡检人员的任务列表
+
+	// 图片附件路由 (巡检、树木、设备照片)
+	attachments := api.Group("/attachments")
+	{
+		attachments.POST("", CreateAttachment)                // 创建附件并获取上传URL
+		attachments.GET("", ListAttachments)                  // 列出附件
+		attachments.GET("/:id", GetAttachment)                // 获取附件详情
+		attachments.POST("/:id/complete", CompleteAttachment) // 上传完成并生成缩略图
+		attachments.DELETE("/:id", DeleteAttachment)          // 删除附件
+	}
+
+	// 通知管理路由
+	notifications := api.Group("/notifications")
+	{
+		notifications.PUT("/preferences/:user_id", SetNotificationPreference) // 设置通知偏好
+		notifications.GET("/preferences/:user_id", GetNotificationPreference) // 获取通知偏好
+		notifications.POST("/send", SendNotification)                         // 手动发送通知
+		notifications.GET("/deliveries", ListNotificationDeliveries)          // 投递记录列表
+		notifications.GET("/deliveries/:id", GetNotificationDelivery)         // 投递记录详情
+	}
 }
 
 // 启动服务器
 func StartServer(config *Config, engine *gin.Engine) error {
-	// 初始化存储服务
+	// 初始化存储服务，上传、附件等功能都依赖存储服务，失败时不启动服务 (单机部署可使用STORAGE_PROVIDER=local)
 	if err := InitStorageService(); err != nil {
-		log.Printf("初始化存储服务失败: %v", err)
-		// 注意：这里不返回错误，因为存储服务不是必需的
+		return fmt.Errorf("初始化存储服务失败: %v", err)
 	}
 
+	// 初始化上传任务和种植园存储，任务状态和树木归属必须持久化，失败时不启动服务
+	if err := InitRepositories(&config.Database); err != nil {
+		return fmt.Errorf("初始化数据存储失败: %v", err)
+	}
+	StartUploadMaintenance(context.Background(), &config.Upload)
+
+	// 初始化通知服务，后台worker发送新通知、免打扰时段结束后的延后通知和失败重试
+	InitNotificationService(&config.Notification)
+	notificationService.Start(context.Background(), notificationPollInterval)
+
 	port := ":" + config.Server.Port
 	log.Printf("启动病虫害检测服务器，监听端口: %s", port)
 	log.Printf("服务器模式: %s", config.Server.Mode)
@@ -0,0 +1,158 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 巡检任务处理器 ====================
+
+// CreateInspection 为树木创建巡检任务
+// POST /api/v1/inspections
+func CreateInspection(c *gin.Context) {
+	var req CreateInspectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if _, err := plantationRepo.GetTree(c.Request.Context(), req.TreeID); err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	task, err := inspectionRepo.Create(c.Request.Context(), InspectionTask{
+		TreeID:      req.TreeID,
+		Description: req.Description,
+		Priority:    req.Priority,
+		DueAt:       req.DueAt,
+		AssignedTo:  req.AssignedTo,
+		CreatedBy:   req.CreatedBy,
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, task)
+}
+
+// ListInspections 列出巡检任务
+// GET /api/v1/inspections?tree_id=xxx&status=open&assigned_to=xxx
+func ListInspections(c *gin.Context) {
+	tasks, err := inspectionRepo.List(c.Request.Context(), InspectionFilter{
+		TreeID:     c.Query("tree_id"),
+		AssignedTo: c.Query("assigned_to"),
+		Status:     InspectionStatus(c.Query("status")),
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"total":       len(tasks),
+		"inspections": tasks,
+	})
+}
+
+// ListWorkerInspections 列出分配给某个巡检人员的任务
+// GET /api/v1/workers/:id/inspections?status=assigned
+func ListWorkerInspections(c *gin.Context) {
+	tasks, err := inspectionRepo.List(c.Request.Context(), InspectionFilter{
+		AssignedTo: c.Param("id"),
+		Status:     InspectionStatus(c.Query("status")),
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"worker_id":   c.Param("id"),
+		"total":       len(tasks),
+		"inspections": tasks,
+	})
+}
+
+// GetInspection 获取巡检任务详情
+// GET /api/v1/inspections/:id
+func GetInspection(c *gin.Context) {
+	task, err := inspectionRepo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, task)
+}
+
+// AssignInspection 分配巡检人员
+// POST /api/v1/inspections/:id/assign
+func AssignInspection(c *gin.Context) {
+	var req AssignInspectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	task, err := assignInspection(c.Request.Context(), c.Param("id"), req.WorkerID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, task)
+}
+
+// StartInspection 开始巡检
+// POST /api/v1/inspections/:id/start
+func StartInspection(c *gin.Context) {
+	task, err := startInspection(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, task)
+}
+
+// CompleteInspection 提交巡检结果
+// POST /api/v1/inspections/:id/complete
+func CompleteInspection(c *gin.Context) {
+	var req CompleteInspectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	task, err := completeInspection(c.Request.Context(), c.Param("id"), req.Outcome, req.Notes)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, task)
+}
+
+// CancelInspection 取消巡检任务
+// POST /api/v1/inspections/:id/cancel
+func CancelInspection(c *gin.Context) {
+	var req CancelInspectionRequest
+	// 请求体可选；分块传输时ContentLength未知，因此总是尝试解析，空请求体按未提供处理
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	task, err := cancelInspection(c.Request.Context(), c.Param("id"), req.Reason)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, task)
+}
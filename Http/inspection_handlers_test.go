@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试巡检任务完整流程
+func TestInspectionWorkflow(t *testing.T) {
+	router := setupPlantationRouter()
+	inspectionRepo = NewMemoryInspectionRepository()
+
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+
+	code, task := doJSON(t, router, "POST", "/api/v1/inspections", `{"tree_id":"`+tree.ID+`","description":"声学检测阳性","priority":"high"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "open", task["status"])
+	id := task["id"].(string)
+
+	// 未分配时不能开始
+	code, _ = doJSON(t, router, "POST", "/api/v1/inspections/"+id+"/start", "")
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, task = doJSON(t, router, "POST", "/api/v1/inspections/"+id+"/assign", `{"worker_id":"worker_1"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "assigned", task["status"])
+
+	code, data := doJSON(t, router, "GET", "/api/v1/workers/worker_1/inspections", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), data["total"])
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/inspections/"+id+"/start", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/inspections/"+id+"/complete", `{"outcome":"eaten_by_goat"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, task = doJSON(t, router, "POST", "/api/v1/inspections/"+id+"/complete", `{"outcome":"confirmed_infestation","notes":"发现蛀孔和虫粪"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", task["status"])
+	assert.Equal(t, "confirmed_infestation", task["outcome"])
+
+	// 已完成的任务不能取消
+	code, _ = doJSON(t, router, "POST", "/api/v1/inspections/"+id+"/cancel", "")
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+func TestCreateInspectionValidation(t *testing.T) {
+	router := setupPlantationRouter()
+	inspectionRepo = NewMemoryInspectionRepository()
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/inspections", `{"tree_id":"tree_missing"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+
+	// 创建时直接分配
+	code, task := doJSON(t, router, "POST", "/api/v1/inspections", `{"tree_id":"`+tree.ID+`","assigned_to":"worker_2"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "assigned", task["status"])
+	assert.Equal(t, "normal", task["priority"])
+
+	code, data := doJSON(t, router, "GET", "/api/v1/inspections?tree_id="+tree.ID+"&status=assigned", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), data["total"])
+}
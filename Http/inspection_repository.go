@@ -0,0 +1,375 @@
+package httpserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== 巡检任务持久化 ====================
+
+// 全局巡检任务仓库实例，StartServer中按配置替换
+var inspectionRepo InspectionRepository = NewMemoryInspectionRepository()
+
+// 允许的状态流转
+var inspectionTransitions = map[InspectionStatus][]InspectionStatus{
+	InspectionOpen:       {InspectionAssigned, InspectionCancelled},
+	InspectionAssigned:   {InspectionAssigned, InspectionInProgress, InspectionCancelled},
+	InspectionInProgress: {InspectionCompleted, InspectionCancelled},
+}
+
+// 判断状态流转是否允许
+func canTransition(from, to InspectionStatus) bool {
+	for _, next := range inspectionTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// InspectionFilter 巡检任务查询条件
+type InspectionFilter struct {
+	TreeID     string
+	AssignedTo string
+	Status     InspectionStatus
+}
+
+// InspectionRepository 巡检任务仓库接口
+// 巡检结果是检测结果的人工核实依据，需要与树木一样在重启后保留
+type InspectionRepository interface {
+	// 创建巡检任务 (生成ID和时间)，指定了AssignedTo时直接进入已分配状态
+	Create(ctx context.Context, task InspectionTask) (InspectionTask, error)
+
+	// 获取巡检任务，不存在时返回ErrInspectionNotFound
+	Get(ctx context.Context, id string) (InspectionTask, error)
+
+	// 按条件列出巡检任务 (按创建时间倒序)
+	List(ctx context.Context, filter InspectionFilter) ([]InspectionTask, error)
+
+	// 校验状态流转并更新任务，不允许的流转返回ErrInvalidTransition
+	// apply在持有任务锁时执行，用于写入分配人员、结果等字段
+	Transition(ctx context.Context, id string, to InspectionStatus, apply func(task *InspectionTask, now time.Time)) (InspectionTask, error)
+}
+
+// 初始化新任务的状态和时间
+func newInspectionTask(task InspectionTask, now time.Time) InspectionTask {
+	task.ID = generateID("inspection")
+	task.Status = InspectionOpen
+	if task.Priority == "" {
+		task.Priority = "normal"
+	}
+	if task.AssignedTo != "" {
+		task.Status = InspectionAssigned
+		task.AssignedAt = &now
+	}
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	return task
+}
+
+// 分配 (或重新分配) 巡检人员
+func assignInspection(ctx context.Context, id, workerID string) (InspectionTask, error) {
+	return inspectionRepo.Transition(ctx, id, InspectionAssigned, func(task *InspectionTask, now time.Time) {
+		task.AssignedTo = workerID
+		task.AssignedAt = &now
+	})
+}
+
+// 巡检人员开始巡检
+func startInspection(ctx context.Context, id string) (InspectionTask, error) {
+	return inspectionRepo.Transition(ctx, id, InspectionInProgress, func(task *InspectionTask, now time.Time) {
+		task.StartedAt = &now
+	})
+}
+
+// 提交巡检结果
+func completeInspection(ctx context.Context, id, outcome, notes string) (InspectionTask, error) {
+	return inspectionRepo.Transition(ctx, id, InspectionCompleted, func(task *InspectionTask, now time.Time) {
+		task.Outcome = outcome
+		task.OutcomeNotes = notes
+		task.CompletedAt = &now
+	})
+}
+
+// 取消巡检任务
+func cancelInspection(ctx context.Context, id, reason string) (InspectionTask, error) {
+	return inspectionRepo.Transition(ctx, id, InspectionCancelled, func(task *InspectionTask, now time.Time) {
+		task.OutcomeNotes = reason
+		task.CompletedAt = &now
+	})
+}
+
+// ==================== 内存实现 ====================
+
+// MemoryInspectionRepository 内存巡检任务仓库
+type MemoryInspectionRepository struct {
+	mu    sync.RWMutex
+	tasks map[string]*InspectionTask
+}
+
+// NewMemoryInspectionRepository 创建内存巡检任务仓库
+func NewMemoryInspectionRepository() *MemoryInspectionRepository {
+	return &MemoryInspectionRepository{tasks: make(map[string]*InspectionTask)}
+}
+
+// Create 创建巡检任务
+func (r *MemoryInspectionRepository) Create(ctx context.Context, task InspectionTask) (InspectionTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task = newInspectionTask(task, time.Now())
+	r.tasks[task.ID] = &task
+	return task, nil
+}
+
+// Get 获取巡检任务
+func (r *MemoryInspectionRepository) Get(ctx context.Context, id string) (InspectionTask, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return InspectionTask{}, ErrInspectionNotFound
+	}
+	return *task, nil
+}
+
+// List 按条件列出巡检任务
+func (r *MemoryInspectionRepository) List(ctx context.Context, filter InspectionFilter) ([]InspectionTask, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tasks := make([]InspectionTask, 0)
+	for _, task := range r.tasks {
+		if filter.TreeID != "" && task.TreeID != filter.TreeID {
+			continue
+		}
+		if filter.AssignedTo != "" && task.AssignedTo != filter.AssignedTo {
+			continue
+		}
+		if filter.Status != "" && task.Status != filter.Status {
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.After(tasks[j].CreatedAt) })
+	return tasks, nil
+}
+
+// Transition 校验状态流转并更新任务
+func (r *MemoryInspectionRepository) Transition(ctx context.Context, id string, to InspectionStatus, apply func(task *InspectionTask, now time.Time)) (InspectionTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return InspectionTask{}, ErrInspectionNotFound
+	}
+	if !canTransition(task.Status, to) {
+		return InspectionTask{}, ErrInvalidTransition
+	}
+
+	now := time.Now()
+	apply(task, now)
+	task.Status = to
+	task.UpdatedAt = now
+	return *task, nil
+}
+
+// ==================== MySQL实现 ====================
+
+// 巡检任务表结构
+const inspectionSchema = "CREATE TABLE IF NOT EXISTS inspections (" +
+	"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+	"tree_id VARCHAR(64) NOT NULL," +
+	"description TEXT NOT NULL," +
+	"priority VARCHAR(16) NOT NULL," +
+	"status VARCHAR(16) NOT NULL," +
+	"assigned_to VARCHAR(128) NOT NULL," +
+	"assigned_at DATETIME(3) NULL," +
+	"due_at DATETIME(3) NULL," +
+	"started_at DATETIME(3) NULL," +
+	"completed_at DATETIME(3) NULL," +
+	"outcome VARCHAR(32) NOT NULL," +
+	"outcome_notes TEXT NOT NULL," +
+	"created_by VARCHAR(128) NOT NULL," +
+	"created_at DATETIME(3) NOT NULL," +
+	"updated_at DATETIME(3) NOT NULL," +
+	"KEY idx_inspections_tree_created (tree_id, created_at)," +
+	"KEY idx_inspections_assigned_created (assigned_to, created_at)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+// 查询列 (顺序与scanInspection一致)
+const inspectionColumns = "id, tree_id, description, priority, status, assigned_to, assigned_at, due_at, started_at, " +
+	"completed_at, outcome, outcome_notes, created_by, created_at, updated_at"
+
+// MySQLInspectionRepository MySQL巡检任务仓库
+// 与其他仓库一样，写入前把时间截断到毫秒，保证读回的任务与写入时一致
+type MySQLInspectionRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLInspectionRepository 创建MySQL巡检任务仓库
+func NewMySQLInspectionRepository(conn *sql.DB) *MySQLInspectionRepository {
+	return &MySQLInspectionRepository{db: conn}
+}
+
+// Migrate 创建巡检任务表
+func (r *MySQLInspectionRepository) Migrate(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, inspectionSchema); err != nil {
+		return fmt.Errorf("创建巡检任务表失败: %v", err)
+	}
+	return nil
+}
+
+// Create 创建巡检任务
+func (r *MySQLInspectionRepository) Create(ctx context.Context, task InspectionTask) (InspectionTask, error) {
+	task = newInspectionTask(task, time.Now().Truncate(time.Millisecond))
+	task.DueAt = truncateMillis(task.DueAt)
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO inspections ("+inspectionColumns+") "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		task.ID, task.TreeID, task.Description, task.Priority, string(task.Status), task.AssignedTo,
+		task.AssignedAt, task.DueAt, task.StartedAt, task.CompletedAt, task.Outcome, task.OutcomeNotes,
+		task.CreatedBy, task.CreatedAt, task.UpdatedAt)
+	if err != nil {
+		return InspectionTask{}, fmt.Errorf("保存巡检任务失败: %v", err)
+	}
+	return task, nil
+}
+
+// Get 获取巡检任务
+func (r *MySQLInspectionRepository) Get(ctx context.Context, id string) (InspectionTask, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+inspectionColumns+" FROM inspections WHERE id = ?", id)
+	task, err := scanInspection(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return InspectionTask{}, ErrInspectionNotFound
+	}
+	if err != nil {
+		return InspectionTask{}, fmt.Errorf("查询巡检任务失败: %v", err)
+	}
+	return task, nil
+}
+
+// List 按条件列出巡检任务
+func (r *MySQLInspectionRepository) List(ctx context.Context, filter InspectionFilter) ([]InspectionTask, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.TreeID != "" {
+		conditions = append(conditions, "tree_id = ?")
+		args = append(args, filter.TreeID)
+	}
+	if filter.AssignedTo != "" {
+		conditions = append(conditions, "assigned_to = ?")
+		args = append(args, filter.AssignedTo)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(filter.Status))
+	}
+
+	query := "SELECT " + inspectionColumns + " FROM inspections"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询巡检任务失败: %v", err)
+	}
+	defer rows.Close()
+
+	tasks := make([]InspectionTask, 0)
+	for rows.Next() {
+		task, err := scanInspection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取巡检任务失败: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取巡检任务失败: %v", err)
+	}
+	return tasks, nil
+}
+
+// Transition 校验状态流转并更新任务
+// 在事务中锁定任务行，同一任务的并发流转按顺序执行
+func (r *MySQLInspectionRepository) Transition(ctx context.Context, id string, to InspectionStatus, apply func(task *InspectionTask, now time.Time)) (InspectionTask, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return InspectionTask{}, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+inspectionColumns+" FROM inspections WHERE id = ? FOR UPDATE", id)
+	task, err := scanInspection(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return InspectionTask{}, ErrInspectionNotFound
+	}
+	if err != nil {
+		return InspectionTask{}, fmt.Errorf("查询巡检任务失败: %v", err)
+	}
+	if !canTransition(task.Status, to) {
+		return InspectionTask{}, ErrInvalidTransition
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	apply(&task, now)
+	task.Status = to
+	task.UpdatedAt = now
+
+	_, err = tx.ExecContext(ctx, "UPDATE inspections SET status = ?, assigned_to = ?, assigned_at = ?, started_at = ?, "+
+		"completed_at = ?, outcome = ?, outcome_notes = ?, updated_at = ? WHERE id = ?",
+		string(task.Status), task.AssignedTo, task.AssignedAt, task.StartedAt, task.CompletedAt,
+		task.Outcome, task.OutcomeNotes, task.UpdatedAt, task.ID)
+	if err != nil {
+		return InspectionTask{}, fmt.Errorf("更新巡检任务失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return InspectionTask{}, fmt.Errorf("更新巡检任务失败: %v", err)
+	}
+	return task, nil
+}
+
+func scanInspection(row rowScanner) (InspectionTask, error) {
+	var task InspectionTask
+	var status string
+	var assignedAt, dueAt, startedAt, completedAt sql.NullTime
+	err := row.Scan(&task.ID, &task.TreeID, &task.Description, &task.Priority, &status, &task.AssignedTo,
+		&assignedAt, &dueAt, &startedAt, &completedAt, &task.Outcome, &task.OutcomeNotes,
+		&task.CreatedBy, &task.CreatedAt, &task.UpdatedAt)
+	if err != nil {
+		return InspectionTask{}, err
+	}
+	task.Status = InspectionStatus(status)
+	task.AssignedAt = nullTimePtr(assignedAt)
+	task.DueAt = nullTimePtr(dueAt)
+	task.StartedAt = nullTimePtr(startedAt)
+	task.CompletedAt = nullTimePtr(completedAt)
+	return task, nil
+}
+
+// 将可为空的时间截断到毫秒
+func truncateMillis(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	truncated := t.Truncate(time.Millisecond)
+	return &truncated
+}
+
+// 将可为空的数据库时间转换为指针
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
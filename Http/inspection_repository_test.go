@@ -0,0 +1,109 @@
+package httpserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockInspectionRepository(t *testing.T) (*MySQLInspectionRepository, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("创建sqlmock失败: %v", err)
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		conn.Close()
+	})
+	return NewMySQLInspectionRepository(conn), mock
+}
+
+func inspectionRows(tasks ...InspectionTask) *sqlmock.Rows {
+	rows := sqlmock.NewRows(columnNames(inspectionColumns))
+	nullable := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return *t
+	}
+	for _, task := range tasks {
+		rows.AddRow(task.ID, task.TreeID, task.Description, task.Priority, string(task.Status), task.AssignedTo,
+			nullable(task.AssignedAt), nullable(task.DueAt), nullable(task.StartedAt), nullable(task.CompletedAt),
+			task.Outcome, task.OutcomeNotes, task.CreatedBy, task.CreatedAt, task.UpdatedAt)
+	}
+	return rows
+}
+
+const selectInspectionForUpdate = "SELECT " + inspectionColumns + " FROM inspections WHERE id = ? FOR UPDATE"
+
+func TestMySQLInspectionRepositoryCreate(t *testing.T) {
+	repo, mock := newMockInspectionRepository(t)
+	ctx := context.Background()
+
+	mock.ExpectExec(inspectionSchema).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, repo.Migrate(ctx))
+
+	// 创建时指定人员直接进入已分配状态
+	mock.ExpectExec("INSERT INTO inspections ("+inspectionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), "tree_a", "声学检测阳性", "normal", "assigned", "worker_1",
+			sqlmock.AnyArg(), nil, nil, nil, "", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	task, err := repo.Create(ctx, InspectionTask{TreeID: "tree_a", Description: "声学检测阳性", AssignedTo: "worker_1"})
+	assert.NoError(t, err)
+	assert.Equal(t, InspectionAssigned, task.Status)
+	assert.Equal(t, task.CreatedAt, task.CreatedAt.Truncate(time.Millisecond))
+}
+
+func TestMySQLInspectionRepositoryTransition(t *testing.T) {
+	repo, mock := newMockInspectionRepository(t)
+	ctx := context.Background()
+	created := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	task := InspectionTask{ID: "inspection_a", TreeID: "tree_a", Priority: "high", Status: InspectionAssigned,
+		AssignedTo: "worker_1", AssignedAt: &created, CreatedAt: created, UpdatedAt: created}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectInspectionForUpdate).WithArgs("inspection_a").WillReturnRows(inspectionRows(task))
+	mock.ExpectExec("UPDATE inspections SET status = ?, assigned_to = ?, assigned_at = ?, started_at = ?, "+
+		"completed_at = ?, outcome = ?, outcome_notes = ?, updated_at = ? WHERE id = ?").
+		WithArgs("in_progress", "worker_1", created, sqlmock.AnyArg(), nil, "", "", sqlmock.AnyArg(), "inspection_a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	started, err := repo.Transition(ctx, "inspection_a", InspectionInProgress, func(task *InspectionTask, now time.Time) {
+		task.StartedAt = &now
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, InspectionInProgress, started.Status)
+	assert.NotNil(t, started.StartedAt)
+
+	// 不允许的流转不写入
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectInspectionForUpdate).WithArgs("inspection_a").WillReturnRows(inspectionRows(task))
+	mock.ExpectRollback()
+	_, err = repo.Transition(ctx, "inspection_a", InspectionCompleted, func(task *InspectionTask, now time.Time) {})
+	assert.Equal(t, ErrInvalidTransition, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectInspectionForUpdate).WithArgs("inspection_missing").WillReturnRows(inspectionRows())
+	mock.ExpectRollback()
+	_, err = repo.Transition(ctx, "inspection_missing", InspectionCancelled, func(task *InspectionTask, now time.Time) {})
+	assert.Equal(t, ErrInspectionNotFound, err)
+}
+
+func TestMySQLInspectionRepositoryList(t *testing.T) {
+	repo, mock := newMockInspectionRepository(t)
+	created := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	due := created.Add(48 * time.Hour)
+
+	mock.ExpectQuery("SELECT "+inspectionColumns+" FROM inspections WHERE assigned_to = ? AND status = ? ORDER BY created_at DESC, id DESC").
+		WithArgs("worker_1", "assigned").
+		WillReturnRows(inspectionRows(InspectionTask{ID: "inspection_a", TreeID: "tree_a", Status: InspectionAssigned,
+			AssignedTo: "worker_1", DueAt: &due, CreatedAt: created, UpdatedAt: created}))
+	tasks, err := repo.List(context.Background(), InspectionFilter{AssignedTo: "worker_1", Status: InspectionAssigned})
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, due, *tasks[0].DueAt)
+	assert.Nil(t, tasks[0].StartedAt)
+}
@@ -168,14 +168,20 @@ func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Header("Access-Control-Expose-Headers", "Content-Length")
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+
+			"Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum, Upload-Defer-Length")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Location, Tus-Resumable, Tus-Version, Tus-Extension, "+
+			"Tus-Max-Size, Tus-Checksum-Algorithm, Upload-Offset, Upload-Length, Upload-Expires")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
+		// OPTIONS请求直接返回204；只有tus客户端查询协议能力的OPTIONS请求 (非预检) 交给路由处理
 		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+			isTus := c.Request.URL.Path == tusBasePath || strings.HasPrefix(c.Request.URL.Path, tusBasePath+"/")
+			if !isTus || c.GetHeader("Access-Control-Request-Method") != "" {
+				c.AbortWithStatus(204)
+				return
+			}
 		}
 
 		c.Next()
@@ -8,27 +8,70 @@ import (
 
 // 创建上传任务请求
 type CreateUploadJobRequest struct {
-	DeviceID    string `json:"device_id" binding:"required"`    // 设备ID
-	FileName    string `json:"file_name" binding:"required"`    // 文件名
-	FileSize    int64  `json:"file_size" binding:"required"`    // 文件大小(字节)
-	FileType    string `json:"file_type" binding:"required"`    // 文件类型 (wav, mp3, flac等)
-	ContentType string `json:"content_type" binding:"required"` // MIME类型
-	Description string `json:"description"`                     // 文件描述
+	DeviceID     string `json:"device_id" binding:"required"`                     // 设备ID
+	FileName     string `json:"file_name" binding:"required"`                     // 文件名
+	FileSize     int64  `json:"file_size" binding:"required"`                     // 文件大小(字节)
+	FileType     string `json:"file_type" binding:"required"`                     // 文件类型 (wav, mp3, flac等)
+	ContentType  string `json:"content_type" binding:"required"`                  // MIME类型
+	Description  string `json:"description"`                                      // 文件描述
+	UploadMethod string `json:"upload_method" binding:"omitempty,oneof=PUT POST"` // 上传方式 (PUT, POST)，默认PUT
 }
 
 // 上传任务响应
 type CreateUploadJobResponse struct {
-	JobID          string    `json:"job_id"`          // 任务ID
-	UploadURL      string    `json:"upload_url"`      // 预签名上传URL
-	Bucket         string    `json:"bucket"`          // 存储桶名称
-	Key            string    `json:"key"`             // 对象键
-	TTL            int64     `json:"ttl"`             // 预签名URL过期时间(秒)
-	ExpiresAt      time.Time `json:"expires_at"`      // 过期时间点
-	ContentType    string    `json:"content_type"`    // 要求的Content-Type
-	MaxFileSize    int64     `json:"max_file_size"`   // 最大文件大小
-	RequiredFields []string  `json:"required_fields"` // 必需的表单字段
-	Status         string    `json:"status"`          // 任务状态
-	CreatedAt      time.Time `json:"created_at"`      // 创建时间
+	JobID          string            `json:"job_id"`                // 任务ID
+	UploadURL      string            `json:"upload_url"`            // 预签名上传URL
+	Method         string            `json:"method"`                // 上传方式 (PUT, POST)
+	FormFields     map[string]string `json:"form_fields,omitempty"` // POST上传需要原样提交的表单字段
+	Bucket         string            `json:"bucket"`                // 存储桶名称
+	Key            string            `json:"key"`                   // 对象键
+	TTL            int64             `json:"ttl"`                   // 预签名URL过期时间(秒)
+	ExpiresAt      time.Time         `json:"expires_at"`            // 过期时间点
+	ContentType    string            `json:"content_type"`          // 要求的Content-Type
+	MaxFileSize    int64             `json:"max_file_size"`         // 最大文件大小
+	RequiredFields []string          `json:"required_fields"`       // 必需的表单字段
+	Status         string            `json:"status"`                // 任务状态
+	CreatedAt      time.Time         `json:"created_at"`            // 创建时间
+}
+
+// 创建分片上传任务请求
+type CreateMultipartUploadRequest struct {
+	CreateUploadJobRequest
+	PartSize int64 `json:"part_size"` // 分片大小(字节)，默认8MB，最小5MB
+}
+
+// 分片上传任务响应
+type CreateMultipartUploadResponse struct {
+	JobID       string          `json:"job_id"`       // 任务ID
+	UploadID    string          `json:"upload_id"`    // 分片上传ID
+	Bucket      string          `json:"bucket"`       // 存储桶名称
+	Key         string          `json:"key"`          // 对象键
+	PartSize    int64           `json:"part_size"`    // 分片大小(字节)，最后一片可以更小
+	PartCount   int             `json:"part_count"`   // 分片数量
+	Parts       []PresignedPart `json:"parts"`        // 每个分片的预签名上传URL
+	ExpiresAt   time.Time       `json:"expires_at"`   // 过期时间点
+	ContentType string          `json:"content_type"` // 要求的Content-Type
+	Status      string          `json:"status"`       // 任务状态
+	CreatedAt   time.Time       `json:"created_at"`   // 创建时间
+}
+
+// 分片的预签名上传URL
+type PresignedPart struct {
+	PartNumber int    `json:"part_number"` // 分片序号，从1开始
+	UploadURL  string `json:"upload_url"`  // 预签名PUT URL
+}
+
+// 已上传的分片
+type UploadedPart struct {
+	PartNumber   int       `json:"part_number"`             // 分片序号
+	ETag         string    `json:"etag"`                    // 分片ETag
+	Size         int64     `json:"size,omitempty"`          // 分片大小
+	LastModified time.Time `json:"last_modified,omitempty"` // 上传时间
+}
+
+// 完成分片上传请求，parts为空时以存储服务中已上传的分片为准
+type CompleteMultipartUploadRequest struct {
+	Parts []UploadedPart `json:"parts"`
 }
 
 // 上传任务状态
@@ -44,26 +87,32 @@ const (
 
 // 上传任务记录
 type UploadJob struct {
-	ID          string          `json:"id" db:"id"`                     // 任务ID
-	DeviceID    string          `json:"device_id" db:"device_id"`       // 设备ID
-	FileName    string          `json:"file_name" db:"file_name"`       // 文件名
-	FileSize    int64           `json:"file_size" db:"file_size"`       // 文件大小
-	FileType    string          `json:"file_type" db:"file_type"`       // 文件类型
-	ContentType string          `json:"content_type" db:"content_type"` // MIME类型
-	Description string          `json:"description" db:"description"`   // 文件描述
-	Bucket      string          `json:"bucket" db:"bucket"`             // 存储桶
-	Key         string          `json:"key" db:"key"`                   // 对象键
-	Status      UploadJobStatus `json:"status" db:"status"`             // 任务状态
-	UploadURL   string          `json:"upload_url" db:"upload_url"`     // 预签名URL
-	TTL         int64           `json:"ttl" db:"ttl"`                   // 过期时间(秒)
-	ExpiresAt   time.Time       `json:"expires_at" db:"expires_at"`     // 过期时间点
-	CreatedAt   time.Time       `json:"created_at" db:"created_at"`     // 创建时间
-	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`     // 更新时间
+	ID          string          `json:"id" db:"id"`                             // 任务ID
+	DeviceID    string          `json:"device_id" db:"device_id"`               // 设备ID
+	TreeID      string          `json:"tree_id,omitempty" db:"tree_id"`         // 录音所属的树ID (按设备安装记录确定)
+	FileName    string          `json:"file_name" db:"file_name"`               // 文件名
+	FileSize    int64           `json:"file_size" db:"file_size"`               // 文件大小
+	FileType    string          `json:"file_type" db:"file_type"`               // 文件类型
+	ContentType string          `json:"content_type" db:"content_type"`         // MIME类型
+	Description string          `json:"description" db:"description"`           // 文件描述
+	Bucket      string          `json:"bucket" db:"bucket"`                     // 存储桶
+	Key         string          `json:"key" db:"key"`                           // 对象键
+	Status      UploadJobStatus `json:"status" db:"status"`                     // 任务状态
+	UploadURL   string          `json:"upload_url" db:"upload_url"`             // 预签名URL
+	ETag        string          `json:"etag,omitempty" db:"etag"`               // 已上传对象的ETag
+	UploadID    string          `json:"upload_id,omitempty" db:"upload_id"`     // 分片上传ID (仅分片上传任务)
+	PartSize    int64           `json:"part_size,omitempty" db:"part_size"`     // 分片大小 (仅分片上传任务)
+	FailReason  string          `json:"fail_reason,omitempty" db:"fail_reason"` // 失败原因
+	TTL         int64           `json:"ttl" db:"ttl"`                           // 过期时间(秒)
+	ExpiresAt   time.Time       `json:"expires_at" db:"expires_at"`             // 过期时间点
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`             // 创建时间
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`             // 更新时间
+	Version     int64           `json:"version" db:"version"`                   // 版本号，每次更新加1，用于乐观并发控制
 }
 
 // 对象存储配置
 type ObjectStorageConfig struct {
-	Provider    string `json:"provider"`     // 存储提供商 (minio, s3, oss)
+	Provider    string `json:"provider"`     // 存储提供商 (minio, s3, local)
 	Endpoint    string `json:"endpoint"`     // 存储服务端点
 	AccessKey   string `json:"access_key"`   // 访问密钥
 	SecretKey   string `json:"secret_key"`   // 秘密密钥
@@ -71,6 +120,10 @@ type ObjectStorageConfig struct {
 	Region      string `json:"region"`       // 存储区域
 	UseSSL      bool   `json:"use_ssl"`      // 是否使用SSL
 	ExpireHours int    `json:"expire_hours"` // 预签名URL过期时间(小时)
+	EventSecret string `json:"-"`            // 存储事件回调共享密钥
+	LocalRoot   string `json:"local_root"`   // 本地存储目录 (仅local)
+	PublicURL   string `json:"public_url"`   // 本服务对外地址，用于生成本地存储的预签名URL (仅local)
+	SigningKey  string `json:"-"`            // 本地存储预签名URL的签名密钥 (仅local)
 }
 
 // 预签名URL生成参数
@@ -81,6 +134,14 @@ type PresignedURLParams struct {
 	Expires     time.Duration     `json:"expires"`      // 过期时间
 	ContentType string            `json:"content_type"` // 内容类型
 	Metadata    map[string]string `json:"metadata"`     // 元数据
+	MinSize     int64             `json:"min_size"`     // 最小文件大小 (仅POST)
+	MaxSize     int64             `json:"max_size"`     // 最大文件大小 (POST；本地存储的PUT同样按此限制)
+}
+
+// 预签名POST表单
+type PresignedPost struct {
+	URL    string            `json:"url"`    // 表单提交地址
+	Fields map[string]string `json:"fields"` // 表单字段，文件字段file必须放在最后
 }
 
 // 上传完成通知
@@ -93,6 +154,382 @@ type UploadCompletionNotification struct {
 	CompletedAt time.Time `json:"completed_at"` // 完成时间
 }
 
+// 事件片段截取请求中的事件时间段 (相对录音开始的秒数)
+type ClipEvent struct {
+	Start float64 `json:"start" binding:"min=0"`       // 事件开始时间
+	End   float64 `json:"end" binding:"gtfield=Start"` // 事件结束时间
+}
+
+// 事件片段截取请求
+type ExtractClipsRequest struct {
+	Events  []ClipEvent `json:"events" binding:"required,min=1,max=100,dive"` // 检测到的事件
+	Padding *float64    `json:"padding" binding:"omitempty,min=0,max=30"`     // 事件前后扩展的秒数，默认2秒
+}
+
+// 从录音中截取的事件片段
+type AudioClip struct {
+	Index     int       `json:"index"`      // 片段序号 (从1开始)
+	Start     float64   `json:"start"`      // 片段在原录音中的开始时间(秒)
+	End       float64   `json:"end"`        // 片段在原录音中的结束时间(秒)
+	Key       string    `json:"key"`        // 派生对象键
+	URL       string    `json:"url"`        // 预签名下载URL
+	ExpiresAt time.Time `json:"expires_at"` // 下载URL过期时间
+}
+
+// ==================== 种植园相关模型 ====================
+
+// 农场
+type Farm struct {
+	ID          string    `json:"id"`          // 农场ID
+	Name        string    `json:"name"`        // 农场名称
+	Owner       string    `json:"owner"`       // 负责人
+	Latitude    float64   `json:"latitude"`    // 纬度
+	Longitude   float64   `json:"longitude"`   // 经度
+	Description string    `json:"description"` // 描述
+	CreatedAt   time.Time `json:"created_at"`  // 创建时间
+	UpdatedAt   time.Time `json:"updated_at"`  // 更新时间
+}
+
+// 地块
+type Block struct {
+	ID          string    `json:"id"`          // 地块ID
+	FarmID      string    `json:"farm_id"`     // 所属农场ID
+	Name        string    `json:"name"`        // 地块名称
+	Latitude    float64   `json:"latitude"`    // 纬度
+	Longitude   float64   `json:"longitude"`   // 经度
+	Description string    `json:"description"` // 描述
+	CreatedAt   time.Time `json:"created_at"`  // 创建时间
+	UpdatedAt   time.Time `json:"updated_at"`  // 更新时间
+}
+
+// 棕榈树
+type Tree struct {
+	ID          string    `json:"id"`           // 树ID
+	FarmID      string    `json:"farm_id"`      // 所属农场ID
+	BlockID     string    `json:"block_id"`     // 所属地块ID
+	Code        string    `json:"code"`         // 树木编号 (现场挂牌)
+	Species     string    `json:"species"`      // 品种
+	PlantedYear int       `json:"planted_year"` // 种植年份
+	Latitude    float64   `json:"latitude"`     // 纬度
+	Longitude   float64   `json:"longitude"`    // 经度
+	CreatedAt   time.Time `json:"created_at"`   // 创建时间
+	UpdatedAt   time.Time `json:"updated_at"`   // 更新时间
+}
+
+// 传感器安装记录 (设备在某段时间内安装在某棵树上)
+type SensorPlacement struct {
+	ID         string     `json:"id"`          // 安装记录ID
+	DeviceID   string     `json:"device_id"`   // 设备ID
+	TreeID     string     `json:"tree_id"`     // 树ID
+	AttachedAt time.Time  `json:"attached_at"` // 安装时间
+	DetachedAt *time.Time `json:"detached_at"` // 拆除时间 (为空表示仍在使用)
+	Notes      string     `json:"notes"`       // 备注
+}
+
+// 设备登记坐标
+type DeviceLocation struct {
+	DeviceID  string    `json:"device_id"`  // 设备ID
+	Latitude  float64   `json:"latitude"`   // 纬度
+	Longitude float64   `json:"longitude"`  // 经度
+	UpdatedAt time.Time `json:"updated_at"` // 更新时间
+}
+
+// 设备当前位置
+type DevicePosition struct {
+	DeviceID  string  `json:"device_id"`         // 设备ID
+	TreeID    string  `json:"tree_id,omitempty"` // 当前安装的树ID
+	Latitude  float64 `json:"latitude"`          // 纬度
+	Longitude float64 `json:"longitude"`         // 经度
+	Source    string  `json:"source"`            // 坐标来源 (placement, registered)
+}
+
+// 判断安装记录在指定时间点是否生效
+func (p *SensorPlacement) ActiveAt(t time.Time) bool {
+	if t.Before(p.AttachedAt) {
+		return false
+	}
+	return p.DetachedAt == nil || t.Before(*p.DetachedAt)
+}
+
+// 处理方式
+const (
+	TreatmentInjection = "injection" // 树干注药
+	TreatmentSpraying  = "spraying"  // 喷药
+	TreatmentRemoval   = "removal"   // 砍伐移除
+	TreatmentOther     = "other"     // 其他
+)
+
+// 树木处理记录
+type Treatment struct {
+	ID        string    `json:"id"`         // 处理记录ID
+	TreeID    string    `json:"tree_id"`    // 树ID
+	TreatedAt time.Time `json:"treated_at"` // 处理时间
+	Method    string    `json:"method"`     // 处理方式
+	Chemical  string    `json:"chemical"`   // 药剂名称
+	Dosage    string    `json:"dosage"`     // 用量
+	Operator  string    `json:"operator"`   // 操作人员
+	Notes     string    `json:"notes"`      // 备注
+	CreatedAt time.Time `json:"created_at"` // 创建时间
+}
+
+// 创建农场请求 (坐标必填，使用指针区分未填写与0)
+type CreateFarmRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Owner       string   `json:"owner"`
+	Latitude    *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude   *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Description string   `json:"description"`
+}
+
+// 创建地块请求
+type CreateBlockRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Latitude    *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude   *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Description string   `json:"description"`
+}
+
+// 创建树木请求
+type CreateTreeRequest struct {
+	Code        string   `json:"code" binding:"required"`
+	Species     string   `json:"species"`
+	PlantedYear int      `json:"planted_year"`
+	Latitude    *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude   *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// 安装传感器请求
+type AttachSensorRequest struct {
+	DeviceID   string     `json:"device_id" binding:"required"`
+	TreeID     string     `json:"tree_id" binding:"required"`
+	AttachedAt *time.Time `json:"attached_at"` // 为空时使用当前时间
+	Notes      string     `json:"notes"`
+}
+
+// 创建处理记录请求
+type CreateTreatmentRequest struct {
+	TreatedAt *time.Time `json:"treated_at"` // 为空时使用当前时间
+	Method    string     `json:"method" binding:"required,oneof=injection spraying removal other"`
+	Chemical  string     `json:"chemical"`
+	Dosage    string     `json:"dosage"`
+	Operator  string     `json:"operator" binding:"required"`
+	Notes     string     `json:"notes"`
+}
+
+// 拆除传感器请求
+type DetachSensorRequest struct {
+	DetachedAt *time.Time `json:"detached_at"` // 为空时使用当前时间
+}
+
+// ==================== 巡检任务相关模型 ====================
+
+// 巡检任务状态
+type InspectionStatus string
+
+const (
+	InspectionOpen       InspectionStatus = "open"        // 待分配
+	InspectionAssigned   InspectionStatus = "assigned"    // 已分配
+	InspectionInProgress InspectionStatus = "in_progress" // 巡检中
+	InspectionCompleted  InspectionStatus = "completed"   // 已完成
+	InspectionCancelled  InspectionStatus = "cancelled"   // 已取消
+)
+
+// 巡检结果
+const (
+	OutcomeConfirmedInfestation = "confirmed_infestation" // 确认虫害
+	OutcomeNoSign               = "no_sign"               // 未发现迹象
+	OutcomeTreeDead             = "tree_dead"             // 树木已死亡
+)
+
+// 巡检任务
+type InspectionTask struct {
+	ID           string           `json:"id"`            // 任务ID
+	TreeID       string           `json:"tree_id"`       // 树ID
+	Description  string           `json:"description"`   // 巡检原因/说明
+	Priority     string           `json:"priority"`      // 优先级 (low, normal, high)
+	Status       InspectionStatus `json:"status"`        // 任务状态
+	AssignedTo   string           `json:"assigned_to"`   // 负责的巡检人员ID
+	AssignedAt   *time.Time       `json:"assigned_at"`   // 分配时间
+	DueAt        *time.Time       `json:"due_at"`        // 截止时间
+	StartedAt    *time.Time       `json:"started_at"`    // 开始巡检时间
+	CompletedAt  *time.Time       `json:"completed_at"`  // 完成/取消时间
+	Outcome      string           `json:"outcome"`       // 巡检结果
+	OutcomeNotes string           `json:"outcome_notes"` // 结果说明
+	CreatedBy    string           `json:"created_by"`    // 创建人
+	CreatedAt    time.Time        `json:"created_at"`    // 创建时间
+	UpdatedAt    time.Time        `json:"updated_at"`    // 更新时间
+}
+
+// 创建巡检任务请求
+type CreateInspectionRequest struct {
+	TreeID      string     `json:"tree_id" binding:"required"`
+	Description string     `json:"description"`
+	Priority    string     `json:"priority" binding:"omitempty,oneof=low normal high"`
+	DueAt       *time.Time `json:"due_at"`
+	AssignedTo  string     `json:"assigned_to"` // 创建时直接分配 (可选)
+	CreatedBy   string     `json:"created_by"`
+}
+
+// 分配巡检任务请求
+type AssignInspectionRequest struct {
+	WorkerID string `json:"worker_id" binding:"required"`
+}
+
+// 完成巡检任务请求
+type CompleteInspectionRequest struct {
+	Outcome string `json:"outcome" binding:"required,oneof=confirmed_infestation no_sign tree_dead"`
+	Notes   string `json:"notes"`
+}
+
+// 取消巡检任务请求
+type CancelInspectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ==================== 附件相关模型 ====================
+
+// 附件所属对象类型
+const (
+	AttachmentOwnerInspection = "inspection" // 巡检任务 (蛀孔、虫粪照片)
+	AttachmentOwnerTree       = "tree"       // 树木
+	AttachmentOwnerDevice     = "device"     // 设备 (安装位置照片)
+)
+
+// 附件状态
+type AttachmentStatus string
+
+const (
+	AttachmentPending  AttachmentStatus = "pending"  // 等待上传
+	AttachmentUploaded AttachmentStatus = "uploaded" // 已上传并生成缩略图
+	AttachmentFailed   AttachmentStatus = "failed"   // 文件无法解析
+	AttachmentExpired  AttachmentStatus = "expired"  // 上传URL过期仍未确认上传
+)
+
+// 图片附件
+type Attachment struct {
+	ID           string           `json:"id"`                      // 附件ID
+	OwnerType    string           `json:"owner_type"`              // 所属对象类型
+	OwnerID      string           `json:"owner_id"`                // 所属对象ID
+	FileName     string           `json:"file_name"`               // 文件名
+	FileSize     int64            `json:"file_size"`               // 文件大小
+	FileType     string           `json:"file_type"`               // 文件类型 (jpg, png)
+	ContentType  string           `json:"content_type"`            // MIME类型
+	Description  string           `json:"description"`             // 描述
+	UploadedBy   string           `json:"uploaded_by"`             // 上传人
+	Bucket       string           `json:"bucket"`                  // 存储桶
+	Key          string           `json:"key"`                     // 对象键
+	ThumbnailKey string           `json:"thumbnail_key"`           // 缩略图对象键
+	Width        int              `json:"width"`                   // 原图宽度
+	Height       int              `json:"height"`                  // 原图高度
+	Status       AttachmentStatus `json:"status"`                  // 状态
+	FailReason   string           `json:"fail_reason,omitempty"`   // 失败原因
+	UploadURL    string           `json:"upload_url,omitempty"`    // 预签名上传URL (仅创建时返回)
+	DownloadURL  string           `json:"download_url,omitempty"`  // 预签名下载URL
+	ThumbnailURL string           `json:"thumbnail_url,omitempty"` // 缩略图下载URL
+	ExpiresAt    time.Time        `json:"expires_at"`              // 上传URL过期时间
+	CreatedAt    time.Time        `json:"created_at"`              // 创建时间
+	UpdatedAt    time.Time        `json:"updated_at"`              // 更新时间
+}
+
+// 创建附件请求
+type CreateAttachmentRequest struct {
+	OwnerType   string `json:"owner_type" binding:"required,oneof=inspection tree device"`
+	OwnerID     string `json:"owner_id" binding:"required"`
+	FileName    string `json:"file_name" binding:"required"`
+	FileSize    int64  `json:"file_size" binding:"required"`
+	FileType    string `json:"file_type" binding:"required"`
+	ContentType string `json:"content_type" binding:"required"`
+	Description string `json:"description"`
+	UploadedBy  string `json:"uploaded_by"`
+}
+
+// ==================== 通知相关模型 ====================
+
+// 通知渠道
+const (
+	ChannelEmail   = "email"   // 邮件 (SMTP)
+	ChannelWebhook = "webhook" // HTTP回调
+	ChannelSMS     = "sms"     // 短信网关
+	ChannelLog     = "log"     // 本地日志/文件 (开发与测试)
+)
+
+// 通知级别
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical" // 紧急通知不受免打扰时段限制
+)
+
+// 通知消息
+type Notification struct {
+	ID        string            `json:"id"`         // 通知ID
+	UserID    string            `json:"user_id"`    // 接收用户
+	Subject   string            `json:"subject"`    // 标题
+	Body      string            `json:"body"`       // 正文
+	Severity  string            `json:"severity"`   // 级别
+	Data      map[string]string `json:"data"`       // 附加数据 (如 tree_id)
+	CreatedAt time.Time         `json:"created_at"` // 创建时间
+}
+
+// 用户的单个通知渠道
+type ChannelPreference struct {
+	Channel string `json:"channel" binding:"required,oneof=email webhook sms log"` // 渠道
+	Address string `json:"address" binding:"required"`                             // 邮箱/回调URL/手机号，log渠道仅作为标识写入日志
+	Enabled bool   `json:"enabled"`                                                // 是否启用
+}
+
+// 免打扰时段 (本地时间 HH:MM，可跨越午夜)
+type QuietHours struct {
+	Start    string `json:"start" binding:"required"` // 开始时间，如 22:00
+	End      string `json:"end" binding:"required"`   // 结束时间，如 06:00
+	Timezone string `json:"timezone"`                 // IANA时区，默认UTC
+}
+
+// 用户通知偏好
+type NotificationPreference struct {
+	UserID     string              `json:"user_id"`
+	Channels   []ChannelPreference `json:"channels" binding:"dive"`
+	QuietHours *QuietHours         `json:"quiet_hours"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// 通知投递状态
+type DeliveryStatus string
+
+const (
+	DeliveryPending  DeliveryStatus = "pending"  // 等待发送
+	DeliveryDeferred DeliveryStatus = "deferred" // 免打扰时段延后发送
+	DeliveryRetrying DeliveryStatus = "retrying" // 发送失败，等待重试
+	DeliverySent     DeliveryStatus = "sent"     // 已发送
+	DeliveryFailed   DeliveryStatus = "failed"   // 重试后仍失败
+)
+
+// 通知投递记录 (每个渠道一条)
+type NotificationDelivery struct {
+	ID             string         `json:"id"`              // 投递ID
+	NotificationID string         `json:"notification_id"` // 通知ID
+	UserID         string         `json:"user_id"`         // 接收用户
+	Channel        string         `json:"channel"`         // 渠道
+	Address        string         `json:"address"`         // 投递地址
+	Status         DeliveryStatus `json:"status"`          // 投递状态
+	Attempts       int            `json:"attempts"`        // 已尝试次数
+	LastError      string         `json:"last_error"`      // 最近一次错误
+	NotBefore      *time.Time     `json:"not_before"`      // 延后发送时间
+	NextAttemptAt  *time.Time     `json:"next_attempt_at"` // 下次重试时间
+	SentAt         *time.Time     `json:"sent_at"`         // 发送成功时间
+	CreatedAt      time.Time      `json:"created_at"`      // 创建时间
+	UpdatedAt      time.Time      `json:"updated_at"`      // 更新时间
+}
+
+// 发送测试通知请求
+type SendNotificationRequest struct {
+	UserID   string            `json:"user_id" binding:"required"`
+	Subject  string            `json:"subject" binding:"required"`
+	Body     string            `json:"body"`
+	Severity string            `json:"severity" binding:"omitempty,oneof=info warning critical"`
+	Data     map[string]string `json:"data"`
+}
+
 // ==================== 响应结构体 ====================
 
 // 标准API响应
@@ -100,7 +537,7 @@ type APIResponse struct {
 	Code    int         `json:"code"`           // 响应状态码
 	Message string      `json:"message"`        // 响应消息
 	Data    interface{} `json:"data,omitempty"` // 响应数据
-	Time    time.Time   `json:"time"`           // 响应时间
+	Time    string      `json:"time"`           // 响应时间 (2006-01-02 15:04:05)
 }
 
 // 分页响应
@@ -112,6 +549,14 @@ type PaginatedResponse struct {
 	Data       interface{} `json:"data"`        // 数据列表
 }
 
+// 游标分页响应 (大表不统计总数)
+type CursorPaginatedResponse struct {
+	PageSize   int         `json:"page_size"`             // 每页大小
+	NextCursor string      `json:"next_cursor,omitempty"` // 下一页游标，为空表示没有更多数据
+	HasMore    bool        `json:"has_more"`              // 是否还有更多数据
+	Data       interface{} `json:"data"`                  // 数据列表
+}
+
 // ==================== 错误定义 ====================
 
 // 自定义错误
@@ -135,4 +580,43 @@ var (
 	ErrUnsupportedFileType = AppError{Code: 415, Message: "不支持的文件类型"}
 	ErrInternalServer      = AppError{Code: 500, Message: "服务器内部错误"}
 	ErrStorageService      = AppError{Code: 503, Message: "存储服务不可用"}
+
+	ErrFarmNotFound      = AppError{Code: 404, Message: "农场不存在"}
+	ErrBlockNotFound     = AppError{Code: 404, Message: "地块不存在"}
+	ErrTreeNotFound      = AppError{Code: 404, Message: "树木不存在"}
+	ErrPlacementNotFound = AppError{Code: 404, Message: "安装记录不存在"}
+	ErrPlacementOverlap  = AppError{Code: 409, Message: "设备在该时间段已有安装记录"}
+	ErrInvalidTimeRange  = AppError{Code: 400, Message: "结束时间不能早于开始时间"}
+
+	ErrInspectionNotFound = AppError{Code: 404, Message: "巡检任务不存在"}
+	ErrInvalidTransition  = AppError{Code: 409, Message: "巡检任务当前状态不允许该操作"}
+
+	ErrAttachmentNotFound = AppError{Code: 404, Message: "附件不存在"}
+	ErrObjectNotUploaded  = AppError{Code: 409, Message: "文件尚未上传到存储服务"}
+	ErrInvalidImage       = AppError{Code: 422, Message: "图片无法解析"}
+	ErrImageTooLarge      = AppError{Code: 422, Message: "图片分辨率过高"}
+	ErrThumbnailBusy      = AppError{Code: 503, Message: "缩略图生成繁忙，请稍后重试"}
+
+	ErrPreferenceNotFound   = AppError{Code: 404, Message: "用户未设置通知偏好"}
+	ErrDeliveryNotFound     = AppError{Code: 404, Message: "投递记录不存在"}
+	ErrChannelNotConfigured = AppError{Code: 400, Message: "通知渠道未配置"}
+	ErrInvalidQuietHours    = AppError{Code: 400, Message: "免打扰时段格式错误，应为HH:MM"}
+
+	ErrJobNotFound            = AppError{Code: 404, Message: "上传任务不存在"}
+	ErrInvalidCursor          = AppError{Code: 400, Message: "无效的分页游标"}
+	ErrJobNotPending          = AppError{Code: 409, Message: "上传任务当前状态不允许完成"}
+	ErrJobConflict            = AppError{Code: 409, Message: "上传任务已被其他请求修改，请重试"}
+	ErrNotMultipart           = AppError{Code: 409, Message: "上传任务不是分片上传"}
+	ErrMultipartClosed        = AppError{Code: 409, Message: "分片上传已结束"}
+	ErrPostPolicyNotSupported = AppError{Code: 501, Message: "当前存储服务不支持POST表单上传"}
+	ErrMultipartNotSupported  = AppError{Code: 501, Message: "当前存储服务不支持分片上传"}
+	ErrUploadOffsetMismatch   = AppError{Code: 409, Message: "Upload-Offset与已上传的字节数不一致"}
+	ErrUploadGone             = AppError{Code: 410, Message: "上传已终止或已过期"}
+	ErrNotTusUpload           = AppError{Code: 409, Message: "任务不是通过tus创建的，请先调用POST /api/v1/tus"}
+	ErrTusUpload              = AppError{Code: 409, Message: "任务已通过tus创建，请通过tus接口续传"}
+	ErrTusUploadCompleted     = AppError{Code: 409, Message: "上传已完成，请通过删除任务接口删除文件"}
+	ErrUploadLocked           = AppError{Code: 423, Message: "该上传正在写入，请稍后重试"}
+	ErrChecksumMismatch       = AppError{Code: 460, Message: "分片校验和不一致"}
+	ErrJobNotCompleted        = AppError{Code: 409, Message: "上传任务尚未完成"}
+	ErrClipNotSupported       = AppError{Code: 415, Message: "仅支持从PCM WAV录音截取片段"}
 )
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 通知管理处理器 ====================
+
+// SetNotificationPreference 设置用户通知渠道和免打扰时段
+// PUT /api/v1/notifications/preferences/:user_id
+func SetNotificationPreference(c *gin.Context) {
+	var pref NotificationPreference
+	if err := c.ShouldBindJSON(&pref); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+	pref.UserID = c.Param("user_id")
+
+	saved, err := notificationService.SetPreference(c.Request.Context(), pref)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, saved)
+}
+
+// GetNotificationPreference 获取用户通知偏好
+// GET /api/v1/notifications/preferences/:user_id
+func GetNotificationPreference(c *gin.Context) {
+	pref, err := notificationService.GetPreference(c.Param("user_id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, pref)
+}
+
+// SendNotification 手动发送通知 (用于验证渠道配置)
+// POST /api/v1/notifications/send
+// 通知进入发送队列后立即返回202，投递结果通过投递记录查询
+func SendNotification(c *gin.Context) {
+	var req SendNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	deliveries, err := notificationService.Notify(c.Request.Context(), Notification{
+		UserID:   req.UserID,
+		Subject:  req.Subject,
+		Body:     req.Body,
+		Severity: req.Severity,
+		Data:     req.Data,
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	acceptedResponse(c, gin.H{
+		"total":      len(deliveries),
+		"deliveries": deliveries,
+	})
+}
+
+// ListNotificationDeliveries 列出投递记录
+// GET /api/v1/notifications/deliveries?user_id=xxx&status=failed
+func ListNotificationDeliveries(c *gin.Context) {
+	deliveries := notificationService.ListDeliveries(c.Query("user_id"), DeliveryStatus(c.Query("status")))
+
+	successResponse(c, gin.H{
+		"total":      len(deliveries),
+		"deliveries": deliveries,
+	})
+}
+
+// GetNotificationDelivery 获取投递记录
+// GET /api/v1/notifications/deliveries/:id
+func GetNotificationDelivery(c *gin.Context) {
+	delivery, err := notificationService.GetDelivery(c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, delivery)
+}
@@ -0,0 +1,464 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ==================== 通知服务 ====================
+
+// 全局通知服务实例，默认所有渠道写入标准日志，StartServer中按配置替换
+var notificationService = newLocalNotificationService("")
+
+// 后台worker检查延后和待重试投递的间隔，重试时间的精度不高于此值
+const notificationPollInterval = 5 * time.Second
+
+// 已发送和最终失败的投递默认保留时间，之后由worker清理
+const defaultNotificationRetention = 7 * 24 * time.Hour
+
+// RetryPolicy 发送失败重试策略 (指数退避)
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff 第attempt次失败后的等待时间
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// NotificationService 按用户偏好分发通知并跟踪投递状态
+// Notify只创建投递记录，由后台worker (Start) 调用DeliverDue发送，失败后按退避时间重试
+// 队列只保存在进程内存中，投递是尽力而为的: 重启时尚未发送、等待重试和免打扰延后的投递都会丢失
+type NotificationService struct {
+	mu            sync.RWMutex
+	notifiers     map[string]Notifier
+	preferences   map[string]*NotificationPreference
+	notifications map[string]Notification
+	deliveries    map[string]*NotificationDelivery
+	retry         RetryPolicy
+	retention     time.Duration // 已结束投递的保留时间
+
+	deliverMu sync.Mutex    // 保证同一时间只有一个DeliverDue在发送
+	wake      chan struct{} // 有新的投递时唤醒worker
+
+	now func() time.Time
+}
+
+// NewNotificationService 创建通知服务
+func NewNotificationService(retry RetryPolicy) *NotificationService {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 1
+	}
+
+	return &NotificationService{
+		notifiers:     make(map[string]Notifier),
+		preferences:   make(map[string]*NotificationPreference),
+		notifications: make(map[string]Notification),
+		deliveries:    make(map[string]*NotificationDelivery),
+		retry:         retry,
+		retention:     defaultNotificationRetention,
+		wake:          make(chan struct{}, 1),
+		now:           time.Now,
+	}
+}
+
+// 创建所有渠道都写入日志的通知服务，用于本地开发和测试
+func newLocalNotificationService(logFile string) *NotificationService {
+	service := NewNotificationService(RetryPolicy{MaxAttempts: 1})
+	for _, channel := range []string{ChannelEmail, ChannelWebhook, ChannelSMS, ChannelLog} {
+		service.Register(NewLogNotifier(channel, logFile))
+	}
+	return service
+}
+
+// InitNotificationService 根据配置初始化通知服务
+func InitNotificationService(config *NotificationConfig) {
+	if config.LocalOnly {
+		notificationService = newLocalNotificationService(config.LogFile)
+		log.Printf("通知服务运行在本地模式，所有通知写入日志")
+		return
+	}
+
+	service := NewNotificationService(RetryPolicy{
+		MaxAttempts:    config.MaxAttempts,
+		InitialBackoff: config.InitialBackoff,
+		MaxBackoff:     config.MaxBackoff,
+	})
+	if config.Retention > 0 {
+		service.retention = config.Retention
+	}
+	service.Register(NewLogNotifier(ChannelLog, config.LogFile))
+	service.Register(NewWebhookNotifier(config.HTTPTimeout, config.WebhookAllowedHosts))
+	if config.SMTPHost != "" {
+		service.Register(NewSMTPNotifier(config))
+	}
+	if config.SMSGatewayURL != "" {
+		service.Register(NewSMSGatewayNotifier(config))
+	}
+
+	notificationService = service
+}
+
+// Register 注册通知渠道，同名渠道会被替换
+func (s *NotificationService) Register(notifier Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifiers[notifier.Channel()] = notifier
+}
+
+// SetPreference 设置用户通知偏好，已启用的渠道必须已注册，地址由渠道校验
+func (s *NotificationService) SetPreference(ctx context.Context, pref NotificationPreference) (NotificationPreference, error) {
+	for _, channel := range pref.Channels {
+		if !channel.Enabled {
+			continue
+		}
+		s.mu.RLock()
+		notifier, ok := s.notifiers[channel.Channel]
+		s.mu.RUnlock()
+		if !ok {
+			return NotificationPreference{}, AppError{Code: ErrChannelNotConfigured.Code, Message: ErrChannelNotConfigured.Message + ": " + channel.Channel}
+		}
+		if validator, isValidator := notifier.(AddressValidator); isValidator {
+			if err := validator.ValidateAddress(ctx, channel.Address); err != nil {
+				return NotificationPreference{}, err
+			}
+		}
+	}
+
+	if pref.QuietHours != nil {
+		if _, err := pref.QuietHours.location(); err != nil {
+			return NotificationPreference{}, AppError{Code: 400, Message: "未知时区: " + pref.QuietHours.Timezone}
+		}
+		if _, _, err := pref.QuietHours.Window(s.now()); err != nil {
+			return NotificationPreference{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pref.UpdatedAt = s.now()
+	s.preferences[pref.UserID] = &pref
+	return pref, nil
+}
+
+// GetPreference 获取用户通知偏好
+func (s *NotificationService) GetPreference(userID string) (NotificationPreference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pref, ok := s.preferences[userID]
+	if !ok {
+		return NotificationPreference{}, ErrPreferenceNotFound
+	}
+	return *pref, nil
+}
+
+// Notify 按用户偏好为所有启用的渠道创建投递记录，并唤醒后台worker发送
+// 处于免打扰时段的非紧急通知会延后到时段结束后发送
+func (s *NotificationService) Notify(ctx context.Context, notification Notification) ([]NotificationDelivery, error) {
+	pref, err := s.GetPreference(notification.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	if notification.ID == "" {
+		notification.ID = generateID("notif")
+	}
+	if notification.Severity == "" {
+		notification.Severity = SeverityInfo
+	}
+	notification.CreatedAt = now
+
+	var notBefore *time.Time
+	if pref.QuietHours != nil && notification.Severity != SeverityCritical {
+		if quiet, end, _ := pref.QuietHours.Window(now); quiet {
+			notBefore = &end
+		}
+	}
+
+	s.mu.Lock()
+	s.notifications[notification.ID] = notification
+	results := make([]NotificationDelivery, 0, len(pref.Channels))
+	for _, channel := range pref.Channels {
+		if !channel.Enabled {
+			continue
+		}
+		delivery := &NotificationDelivery{
+			ID:             generateID("delivery"),
+			NotificationID: notification.ID,
+			UserID:         notification.UserID,
+			Channel:        channel.Channel,
+			Address:        channel.Address,
+			Status:         DeliveryPending,
+			NotBefore:      notBefore,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if notBefore != nil {
+			delivery.Status = DeliveryDeferred
+		}
+		s.deliveries[delivery.ID] = delivery
+		results = append(results, *delivery)
+	}
+	s.mu.Unlock()
+
+	s.notifyWorker()
+	return results, nil
+}
+
+// DeliverDue 发送所有到期的投递：新建的、免打扰时段已结束的以及到达重试时间的
+// 每条投递只尝试一次，失败后按重试策略安排下次时间，返回处理的数量
+func (s *NotificationService) DeliverDue(ctx context.Context) int {
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	now := s.now()
+
+	s.mu.Lock()
+	due := make([]*NotificationDelivery, 0)
+	for _, delivery := range s.deliveries {
+		switch delivery.Status {
+		case DeliveryDeferred:
+			if delivery.NotBefore == nil || now.Before(*delivery.NotBefore) {
+				continue
+			}
+			delivery.Status = DeliveryPending
+		case DeliveryRetrying:
+			if delivery.NextAttemptAt != nil && now.Before(*delivery.NextAttemptAt) {
+				continue
+			}
+		case DeliveryPending:
+		default:
+			continue
+		}
+		due = append(due, delivery)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		s.mu.RLock()
+		notification := s.notifications[delivery.NotificationID]
+		s.mu.RUnlock()
+		s.attempt(ctx, delivery, notification)
+	}
+	return len(due)
+}
+
+// Prune 删除结束时间早于保留期的已发送和最终失败的投递，以及不再有投递的通知，返回删除的投递数量
+func (s *NotificationService) Prune() int {
+	cutoff := s.now().Add(-s.retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	active := make(map[string]bool)
+	for id, delivery := range s.deliveries {
+		finished := delivery.Status == DeliverySent || delivery.Status == DeliveryFailed
+		if finished && delivery.UpdatedAt.Before(cutoff) {
+			delete(s.deliveries, id)
+			pruned++
+			continue
+		}
+		active[delivery.NotificationID] = true
+	}
+	for id := range s.notifications {
+		if !active[id] {
+			delete(s.notifications, id)
+		}
+	}
+	return pruned
+}
+
+// Start 在后台发送投递：有新通知时立即发送，并每隔interval检查延后和待重试的投递、清理过期记录，ctx取消时退出
+func (s *NotificationService) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n := s.Prune(); n > 0 {
+					log.Printf("已清理 %d 条过期通知投递", n)
+				}
+			case <-s.wake:
+			}
+			if n := s.DeliverDue(ctx); n > 0 {
+				log.Printf("已处理 %d 条通知投递", n)
+			}
+		}
+	}()
+}
+
+// 唤醒后台worker，worker忙碌时不阻塞
+func (s *NotificationService) notifyWorker() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// GetDelivery 获取投递记录
+func (s *NotificationService) GetDelivery(id string) (NotificationDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return NotificationDelivery{}, ErrDeliveryNotFound
+	}
+	return *delivery, nil
+}
+
+// ListDeliveries 按用户和状态列出投递记录 (按创建时间倒序)
+func (s *NotificationService) ListDeliveries(userID string, status DeliveryStatus) []NotificationDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]NotificationDelivery, 0)
+	for _, delivery := range s.deliveries {
+		if userID != "" && delivery.UserID != userID {
+			continue
+		}
+		if status != "" && delivery.Status != status {
+			continue
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt) })
+	return deliveries
+}
+
+// 尝试发送一次投递，结果写回投递记录，未达到最大次数的失败安排重试
+func (s *NotificationService) attempt(ctx context.Context, delivery *NotificationDelivery, notification Notification) {
+	s.mu.RLock()
+	notifier, ok := s.notifiers[delivery.Channel]
+	s.mu.RUnlock()
+
+	if !ok {
+		s.update(delivery, func(d *NotificationDelivery) {
+			d.Status = DeliveryFailed
+			d.NextAttemptAt = nil
+			d.LastError = "通知渠道未配置: " + d.Channel
+		})
+		return
+	}
+
+	err := notifier.Send(ctx, delivery.Address, notification)
+	s.update(delivery, func(d *NotificationDelivery) {
+		d.Attempts++
+		d.NextAttemptAt = nil
+		if err == nil {
+			sentAt := s.now()
+			d.Status = DeliverySent
+			d.LastError = ""
+			d.SentAt = &sentAt
+			return
+		}
+
+		d.LastError = err.Error()
+		if d.Attempts >= s.retry.MaxAttempts {
+			d.Status = DeliveryFailed
+			return
+		}
+		next := s.now().Add(s.retry.Backoff(d.Attempts))
+		d.Status = DeliveryRetrying
+		d.NextAttemptAt = &next
+	})
+	if err != nil {
+		log.Printf("通知发送失败 (%s, 第%d次): %v", delivery.Channel, delivery.Attempts, err)
+	}
+}
+
+// 在锁内修改投递记录
+func (s *NotificationService) update(delivery *NotificationDelivery, fn func(d *NotificationDelivery)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(delivery)
+	delivery.UpdatedAt = s.now()
+}
+
+// ==================== 免打扰时段 ====================
+
+// 解析时区，默认UTC
+func (q *QuietHours) location() (*time.Location, error) {
+	if q.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(q.Timezone)
+}
+
+// Window 判断now是否处于免打扰时段，若是则返回时段结束时间
+func (q *QuietHours) Window(now time.Time) (bool, time.Time, error) {
+	loc, err := q.location()
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	startMinutes, err := parseClock(q.Start)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	endMinutes, err := parseClock(q.End)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	minutes := local.Hour()*60 + local.Minute()
+	at := func(dayOffset, m int) time.Time {
+		return midnight.AddDate(0, 0, dayOffset).Add(time.Duration(m) * time.Minute)
+	}
+
+	if startMinutes == endMinutes {
+		return false, time.Time{}, nil
+	}
+	if startMinutes < endMinutes {
+		if minutes >= startMinutes && minutes < endMinutes {
+			return true, at(0, endMinutes), nil
+		}
+		return false, time.Time{}, nil
+	}
+
+	// 跨越午夜，如 22:00-06:00
+	if minutes >= startMinutes {
+		return true, at(1, endMinutes), nil
+	}
+	if minutes < endMinutes {
+		return true, at(0, endMinutes), nil
+	}
+	return false, time.Time{}, nil
+}
+
+// 解析 HH:MM 为当天分钟数
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil {
+		return 0, ErrInvalidQuietHours
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, ErrInvalidQuietHours
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,571 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试用通知渠道，前failures次发送失败
+type flakyNotifier struct {
+	channel  string
+	failures int
+	sent     []string
+}
+
+func (n *flakyNotifier) Channel() string { return n.channel }
+
+func (n *flakyNotifier) Send(ctx context.Context, address string, notification Notification) error {
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("网关暂时不可用")
+	}
+	n.sent = append(n.sent, address)
+	return nil
+}
+
+// 创建使用可调时钟的通知服务，测试中手动调用DeliverDue代替后台worker
+func newTestNotificationService(now time.Time) (*NotificationService, *time.Time) {
+	clock := now
+	service := NewNotificationService(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	service.now = func() time.Time { return clock }
+	return service, &clock
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, 1*time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+}
+
+func TestNotifyQueuesDeliveries(t *testing.T) {
+	service, _ := newTestNotificationService(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	sms := &flakyNotifier{channel: ChannelSMS}
+	service.Register(sms)
+
+	_, err := service.SetPreference(context.Background(), NotificationPreference{
+		UserID:   "user_1",
+		Channels: []ChannelPreference{{Channel: ChannelSMS, Address: "+966500000000", Enabled: true}},
+	})
+	assert.NoError(t, err)
+
+	// Notify不发送，只创建投递记录
+	deliveries, err := service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "检测到虫害"})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, DeliveryPending, deliveries[0].Status)
+	assert.Empty(t, sms.sent)
+
+	assert.Equal(t, 1, service.DeliverDue(context.Background()))
+	delivery, _ := service.GetDelivery(deliveries[0].ID)
+	assert.Equal(t, DeliverySent, delivery.Status)
+	assert.Equal(t, []string{"+966500000000"}, sms.sent)
+
+	// 已发送的投递不再处理
+	assert.Equal(t, 0, service.DeliverDue(context.Background()))
+}
+
+func TestNotifyRetriesWithBackoff(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, clock := newTestNotificationService(start)
+	sms := &flakyNotifier{channel: ChannelSMS, failures: 2}
+	service.Register(sms)
+
+	service.SetPreference(context.Background(), NotificationPreference{
+		UserID:   "user_1",
+		Channels: []ChannelPreference{{Channel: ChannelSMS, Address: "+966500000000", Enabled: true}},
+	})
+	deliveries, _ := service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "检测到虫害"})
+	id := deliveries[0].ID
+
+	// 第1次失败，1秒后重试
+	service.DeliverDue(context.Background())
+	delivery, _ := service.GetDelivery(id)
+	assert.Equal(t, DeliveryRetrying, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, start.Add(time.Second), *delivery.NextAttemptAt)
+
+	// 未到重试时间
+	assert.Equal(t, 0, service.DeliverDue(context.Background()))
+
+	// 第2次失败，退避加倍
+	*clock = start.Add(time.Second)
+	service.DeliverDue(context.Background())
+	delivery, _ = service.GetDelivery(id)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, start.Add(3*time.Second), *delivery.NextAttemptAt)
+
+	*clock = start.Add(3 * time.Second)
+	service.DeliverDue(context.Background())
+	delivery, _ = service.GetDelivery(id)
+	assert.Equal(t, DeliverySent, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Empty(t, delivery.LastError)
+	assert.Equal(t, []string{"+966500000000"}, sms.sent)
+}
+
+func TestNotifyFailsAfterMaxAttempts(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, clock := newTestNotificationService(start)
+	service.Register(&flakyNotifier{channel: ChannelSMS, failures: 10})
+
+	service.SetPreference(context.Background(), NotificationPreference{
+		UserID: "user_1",
+		Channels: []ChannelPreference{
+			{Channel: ChannelSMS, Address: "+966500000000", Enabled: true},
+			{Channel: ChannelSMS, Address: "+966500000001", Enabled: true},
+			{Channel: ChannelWebhook, Address: "http://example.com", Enabled: false},
+		},
+	})
+
+	deliveries, err := service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "检测到虫害"})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+
+	for i := 0; i < 3; i++ {
+		service.DeliverDue(context.Background())
+		*clock = clock.Add(time.Minute)
+	}
+	for _, delivery := range deliveries {
+		delivery, _ = service.GetDelivery(delivery.ID)
+		assert.Equal(t, DeliveryFailed, delivery.Status)
+		assert.NotEmpty(t, delivery.LastError)
+	}
+	assert.Len(t, service.ListDeliveries("user_1", DeliveryFailed), 2)
+
+	// 失败的投递不再重试
+	assert.Equal(t, 0, service.DeliverDue(context.Background()))
+
+	_, err = service.Notify(context.Background(), Notification{UserID: "user_unknown"})
+	assert.Equal(t, ErrPreferenceNotFound, err)
+}
+
+func TestNotificationWorker(t *testing.T) {
+	service := NewNotificationService(RetryPolicy{MaxAttempts: 1})
+	sent := make(chan Notification, 1)
+	service.Register(notifierFunc{channel: ChannelSMS, send: func(n Notification) { sent <- n }})
+	service.SetPreference(context.Background(), NotificationPreference{
+		UserID:   "user_1",
+		Channels: []ChannelPreference{{Channel: ChannelSMS, Address: "+966500000000", Enabled: true}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.Start(ctx, time.Hour)
+
+	// 新通知唤醒worker，不需要等待下一个周期
+	service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "检测到虫害"})
+	select {
+	case n := <-sent:
+		assert.Equal(t, "检测到虫害", n.Subject)
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker未发送通知")
+	}
+}
+
+// 把发送的通知交给回调的通知渠道
+type notifierFunc struct {
+	channel string
+	send    func(Notification)
+}
+
+func (n notifierFunc) Channel() string { return n.channel }
+
+func (n notifierFunc) Send(ctx context.Context, address string, notification Notification) error {
+	n.send(notification)
+	return nil
+}
+
+func TestQuietHoursWindow(t *testing.T) {
+	quiet := &QuietHours{Start: "22:00", End: "06:00"}
+
+	in, end, err := quiet.Window(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.True(t, in)
+	assert.Equal(t, time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC), end)
+
+	in, end, _ = quiet.Window(time.Date(2024, 1, 2, 5, 0, 0, 0, time.UTC))
+	assert.True(t, in)
+	assert.Equal(t, time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC), end)
+
+	in, _, _ = quiet.Window(time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC))
+	assert.False(t, in)
+
+	_, _, err = (&QuietHours{Start: "25:00", End: "06:00"}).Window(time.Now())
+	assert.Equal(t, ErrInvalidQuietHours, err)
+}
+
+func TestNotifyDefersDuringQuietHours(t *testing.T) {
+	night := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	service, clock := newTestNotificationService(night)
+	sms := &flakyNotifier{channel: ChannelSMS}
+	service.Register(sms)
+
+	service.SetPreference(context.Background(), NotificationPreference{
+		UserID:     "user_1",
+		Channels:   []ChannelPreference{{Channel: ChannelSMS, Address: "+966500000000", Enabled: true}},
+		QuietHours: &QuietHours{Start: "22:00", End: "06:00"},
+	})
+
+	// 普通通知延后
+	deliveries, _ := service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "日报"})
+	assert.Equal(t, DeliveryDeferred, deliveries[0].Status)
+	assert.Empty(t, sms.sent)
+
+	// 紧急通知立即发送，时段未结束时普通通知不发送
+	deliveries, _ = service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "紧急", Severity: SeverityCritical})
+	assert.Equal(t, DeliveryPending, deliveries[0].Status)
+	assert.Equal(t, 1, service.DeliverDue(context.Background()))
+	assert.Len(t, sms.sent, 1)
+	assert.Equal(t, 0, service.DeliverDue(context.Background()))
+
+	*clock = night.Add(8 * time.Hour)
+	assert.Equal(t, 1, service.DeliverDue(context.Background()))
+	assert.Len(t, sms.sent, 2)
+}
+
+// 创建信任测试服务器证书的回调通知
+func newTestWebhookNotifier(server *httptest.Server, allowedHosts ...string) *WebhookNotifier {
+	notifier := NewWebhookNotifier(time.Second, allowedHosts)
+	notifier.Client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	return notifier
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Notification
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/fail"):
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasSuffix(r.URL.Path, "/redirect"):
+			http.Redirect(w, r, "http://example.com/hook", http.StatusTemporaryRedirect)
+		}
+	}))
+	defer server.Close()
+
+	// 测试服务器在127.0.0.1上，需要加入白名单
+	notifier := newTestWebhookNotifier(server, "127.0.0.1")
+	err := notifier.Send(context.Background(), server.URL+"/hook", Notification{ID: "notif_1", Subject: "检测到虫害"})
+	assert.NoError(t, err)
+	assert.Equal(t, "notif_1", received.ID)
+
+	err = notifier.Send(context.Background(), server.URL+"/fail", Notification{ID: "notif_2"})
+	assert.Error(t, err)
+
+	// 不能重定向到http
+	err = notifier.Send(context.Background(), server.URL+"/redirect", Notification{ID: "notif_3"})
+	assert.Error(t, err)
+}
+
+func TestWebhookNotifierRejectsInternalAddresses(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("不应连接到内网地址")
+	}))
+	defer server.Close()
+
+	// 不在白名单中时，发送时在连接阶段拒绝回环地址
+	notifier := newTestWebhookNotifier(server)
+	err := notifier.Send(context.Background(), server.URL+"/hook", Notification{ID: "notif_1"})
+	assert.Error(t, err)
+
+	for _, address := range []string{
+		"http://example.com/hook",         // 非https
+		"https:///hook",                   // 缺少主机名
+		"https://127.0.0.1/hook",          // 回环
+		"https://[::1]/hook",              // IPv6回环
+		"https://10.0.0.8/hook",           // 私有网段
+		"https://169.254.169.254/latest",  // 云主机元数据
+		"https://100.64.0.1/hook",         // 运营商级NAT
+		"https://0.0.0.0/hook",            // 未指定地址
+		"https://[fd00::1]/hook",          // IPv6私有地址
+		"https://[::ffff:127.0.0.1]/hook", // IPv4映射的回环
+	} {
+		assert.Error(t, notifier.ValidateAddress(context.Background(), address), address)
+		assert.Error(t, notifier.Send(context.Background(), address, Notification{}), address)
+	}
+
+	// 公网地址和白名单主机可以保存
+	assert.NoError(t, notifier.ValidateAddress(context.Background(), "https://93.184.216.34/hook"))
+	assert.NoError(t, newTestWebhookNotifier(server, "127.0.0.1").ValidateAddress(context.Background(), server.URL+"/hook"))
+}
+
+func TestSetPreferenceRejectsInternalWebhook(t *testing.T) {
+	notificationService = NewNotificationService(RetryPolicy{MaxAttempts: 1})
+	notificationService.Register(NewWebhookNotifier(time.Second, nil))
+	defer func() { notificationService = newLocalNotificationService("") }()
+	router := newTestEngine()
+
+	code, _ := doJSON(t, router, "PUT", "/api/v1/notifications/preferences/user_1",
+		`{"channels":[{"channel":"webhook","address":"https://169.254.169.254/latest/meta-data","enabled":true}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doJSON(t, router, "PUT", "/api/v1/notifications/preferences/user_1",
+		`{"channels":[{"channel":"webhook","address":"https://93.184.216.34/hook","enabled":true}]}`)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestSMSGatewayNotifier(t *testing.T) {
+	var auth string
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	notifier := NewSMSGatewayNotifier(&NotificationConfig{SMSGatewayURL: server.URL, SMSGatewayAPIKey: "secret", HTTPTimeout: time.Second})
+	err := notifier.Send(context.Background(), "+966500000000", Notification{Subject: "检测到虫害", Body: "P-001"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", auth)
+	assert.Equal(t, "+966500000000", payload["to"])
+	assert.Equal(t, "检测到虫害: P-001", payload["message"])
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	notifier := NewSMTPNotifier(&NotificationConfig{SMTPHost: "smtp.example.com", SMTPPort: 587, SMTPFrom: "alerts@example.com"})
+
+	var addr string
+	var msg []byte
+	notifier.sendMail = func(ctx context.Context, a string, auth smtp.Auth, from string, to []string, m []byte) error {
+		addr, msg = a, m
+		return nil
+	}
+
+	err := notifier.Send(context.Background(), "worker@example.com", Notification{Subject: "检测到虫害", Body: "P-001"})
+	assert.NoError(t, err)
+	assert.Equal(t, "smtp.example.com:587", addr)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, "worker@example.com", parsed.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "检测到虫害", subject)
+}
+
+func TestSMTPNotifierHeaderInjection(t *testing.T) {
+	notifier := NewSMTPNotifier(&NotificationConfig{SMTPHost: "smtp.example.com", SMTPPort: 587, SMTPFrom: "alerts@example.com"})
+
+	var recipients []string
+	var msg []byte
+	notifier.sendMail = func(ctx context.Context, a string, auth smtp.Auth, from string, to []string, m []byte) error {
+		recipients, msg = to, m
+		return nil
+	}
+
+	// 标题中的CRLF不能产生新的邮件头
+	subject := "检测到虫害\r\nBcc: attacker@example.com\r\n\r\n伪造正文"
+	assert.NoError(t, notifier.Send(context.Background(), "worker@example.com", Notification{Subject: subject}))
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	assert.NoError(t, err)
+	assert.Empty(t, parsed.Header.Get("Bcc"))
+	assert.Equal(t, []string{"worker@example.com"}, recipients)
+	decoded, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	assert.Equal(t, subject, decoded)
+
+	// 收件人地址中的CRLF和非法地址直接拒绝
+	for _, address := range []string{"worker@example.com\r\nBcc: attacker@example.com", "not-an-address", ""} {
+		msg = nil
+		assert.Error(t, notifier.Send(context.Background(), address, Notification{Subject: "测试"}), address)
+		assert.Nil(t, msg)
+		assert.Error(t, notifier.ValidateAddress(context.Background(), address), address)
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// 接受连接后不发送问候语的SMTP服务器
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	notifier := NewSMTPNotifier(&NotificationConfig{SMTPHost: "127.0.0.1", SMTPPort: addr.Port,
+		SMTPFrom: "alerts@example.com", SMTPTimeout: 200 * time.Millisecond})
+
+	start := time.Now()
+	err = notifier.Send(context.Background(), "worker@example.com", Notification{Subject: "测试"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// 没有配置超时时按ctx取消
+	notifier.Timeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start = time.Now()
+	err = notifier.Send(ctx, "worker@example.com", Notification{Subject: "测试"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestSetPreferenceValidatesAddress(t *testing.T) {
+	service, _ := newTestNotificationService(time.Now())
+	service.Register(NewSMTPNotifier(&NotificationConfig{SMTPHost: "smtp.example.com"}))
+
+	_, err := service.SetPreference(context.Background(), NotificationPreference{
+		UserID:   "user_1",
+		Channels: []ChannelPreference{{Channel: ChannelEmail, Address: "a@example.com\r\nBcc: b@example.com", Enabled: true}},
+	})
+	assert.Error(t, err)
+
+	// 未启用的渠道不校验
+	_, err = service.SetPreference(context.Background(), NotificationPreference{
+		UserID:   "user_1",
+		Channels: []ChannelPreference{{Channel: ChannelEmail, Address: "draft", Enabled: false}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestSetPreferenceRequiresRegisteredChannel(t *testing.T) {
+	service, _ := newTestNotificationService(time.Now())
+	service.Register(&flakyNotifier{channel: ChannelSMS})
+
+	// 启用未注册的渠道时拒绝，投递不会静默失败
+	_, err := service.SetPreference(context.Background(), NotificationPreference{
+		UserID: "user_1",
+		Channels: []ChannelPreference{
+			{Channel: ChannelSMS, Address: "+966500000000", Enabled: true},
+			{Channel: ChannelEmail, Address: "a@example.com", Enabled: true},
+		},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 400, err.(AppError).Code)
+	_, err = service.GetPreference("user_1")
+	assert.Equal(t, ErrPreferenceNotFound, err)
+
+	// 未启用的未注册渠道可以保存
+	_, err = service.SetPreference(context.Background(), NotificationPreference{
+		UserID: "user_1",
+		Channels: []ChannelPreference{
+			{Channel: ChannelSMS, Address: "+966500000000", Enabled: true},
+			{Channel: ChannelEmail, Address: "a@example.com", Enabled: false},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestPruneDeliveries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 21, 0, 0, 0, time.UTC)
+	service, clock := newTestNotificationService(start)
+	service.retention = time.Hour
+	service.Register(&flakyNotifier{channel: ChannelSMS})
+	service.Register(&flakyNotifier{channel: ChannelLog, failures: 10})
+	service.SetPreference(context.Background(), NotificationPreference{
+		UserID: "user_1",
+		Channels: []ChannelPreference{
+			{Channel: ChannelSMS, Address: "+966500000000", Enabled: true},
+			{Channel: ChannelLog, Address: "ops", Enabled: true},
+		},
+		QuietHours: &QuietHours{Start: "20:00", End: "08:00"},
+	})
+
+	// 已发送和最终失败的投递
+	done, _ := service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "紧急", Severity: SeverityCritical})
+	for i := 0; i < 3; i++ {
+		service.DeliverDue(context.Background())
+		*clock = clock.Add(10 * time.Second)
+	}
+
+	// 免打扰时段延后到次日08:00的投递
+	*clock = start.Add(30 * time.Minute)
+	deferred, _ := service.Notify(context.Background(), Notification{UserID: "user_1", Subject: "日报"})
+	assert.Equal(t, DeliveryDeferred, deferred[0].Status)
+
+	// 保留期内不清理
+	assert.Equal(t, 0, service.Prune())
+
+	// 超过保留期后只清理已结束的投递和对应的通知
+	*clock = start.Add(2 * time.Hour)
+	assert.Equal(t, 2, service.Prune())
+	for _, delivery := range done {
+		_, err := service.GetDelivery(delivery.ID)
+		assert.Equal(t, ErrDeliveryNotFound, err)
+	}
+	assert.NotContains(t, service.notifications, done[0].NotificationID)
+	for _, delivery := range deferred {
+		_, err := service.GetDelivery(delivery.ID)
+		assert.NoError(t, err)
+	}
+	assert.Contains(t, service.notifications, deferred[0].NotificationID)
+}
+
+func TestLogNotifierWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	notifier := NewLogNotifier(ChannelEmail, path)
+
+	assert.NoError(t, notifier.Send(context.Background(), "a@example.com", Notification{Subject: "一"}))
+	assert.NoError(t, notifier.Send(context.Background(), "b@example.com", Notification{Subject: "二"}))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "b@example.com")
+}
+
+func TestNotificationHandlers(t *testing.T) {
+	notificationService = newLocalNotificationService("")
+	router := newTestEngine()
+
+	code, _ := doJSON(t, router, "PUT", "/api/v1/notifications/preferences/user_1",
+		`{"channels":[{"channel":"email","address":"a@example.com","enabled":true}]}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = doJSON(t, router, "PUT", "/api/v1/notifications/preferences/user_1",
+		`{"channels":[{"channel":"pigeon","address":"x","enabled":true}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 未配置的渠道返回400
+	notificationService = NewNotificationService(RetryPolicy{MaxAttempts: 1})
+	code, _ = doJSON(t, router, "PUT", "/api/v1/notifications/preferences/user_1",
+		`{"channels":[{"channel":"sms","address":"+966500000000","enabled":true}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	notificationService = newLocalNotificationService("")
+	code, _ = doJSON(t, router, "PUT", "/api/v1/notifications/preferences/user_1",
+		`{"channels":[{"channel":"email","address":"a@example.com","enabled":true}]}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// 通知入队后立即返回202，由worker发送
+	code, data := doJSON(t, router, "POST", "/api/v1/notifications/send", `{"user_id":"user_1","subject":"测试"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, float64(1), data["total"])
+	delivery := data["deliveries"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "pending", delivery["status"])
+
+	notificationService.DeliverDue(context.Background())
+	code, data = doJSON(t, router, "GET", "/api/v1/notifications/deliveries/"+delivery["id"].(string), "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "sent", data["status"])
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/notifications/send", `{"user_id":"user_2","subject":"测试"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,447 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ==================== 通知渠道 ====================
+
+// Notifier 通知渠道接口
+type Notifier interface {
+	// 渠道名称 (email, webhook, sms, log)
+	Channel() string
+
+	// 向指定地址发送通知，返回错误时会按重试策略重试
+	Send(ctx context.Context, address string, notification Notification) error
+}
+
+// AddressValidator 需要校验投递地址的通知渠道实现此接口
+// 保存用户偏好时调用，发送前仍会再次校验
+type AddressValidator interface {
+	ValidateAddress(ctx context.Context, address string) error
+}
+
+// SMTPNotifier 邮件通知
+type SMTPNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration // 单封邮件从连接到发送完成的最长时间，为0时只受ctx限制
+
+	// 发送函数，默认为sendSMTPMail，测试时可替换
+	sendMail func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPNotifier 创建邮件通知
+func NewSMTPNotifier(config *NotificationConfig) *SMTPNotifier {
+	n := &SMTPNotifier{
+		Host:     config.SMTPHost,
+		Port:     config.SMTPPort,
+		Username: config.SMTPUsername,
+		Password: config.SMTPPassword,
+		From:     config.SMTPFrom,
+		Timeout:  config.SMTPTimeout,
+	}
+	n.sendMail = n.sendSMTPMail
+	return n
+}
+
+// Channel 渠道名称
+func (n *SMTPNotifier) Channel() string {
+	return ChannelEmail
+}
+
+// ValidateAddress 校验收件人地址，拒绝包含换行等可以注入邮件头的内容
+func (n *SMTPNotifier) ValidateAddress(ctx context.Context, address string) error {
+	_, err := parseMailAddress(address)
+	return err
+}
+
+// Send 发送邮件
+func (n *SMTPNotifier) Send(ctx context.Context, address string, notification Notification) error {
+	to, err := parseMailAddress(address)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	// 标题可能包含用户输入，按RFC 2047编码，其中的换行不会成为新的邮件头
+	var msg strings.Builder
+	msg.WriteString("From: " + n.From + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", notification.Subject) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(notification.Body + "\r\n")
+
+	addr := n.Host + ":" + strconv.Itoa(n.Port)
+	if err := n.sendMail(ctx, addr, auth, n.From, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+	return nil
+}
+
+// 与smtp.SendMail的流程相同，但连接和读写都有超时，并在ctx取消时中断
+// 通知worker串行发送，服务器接受连接后不响应时不能阻塞其他渠道的投递
+func (n *SMTPNotifier) sendSMTPMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+
+	conn, err := (&net.Dialer{Timeout: n.Timeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// ctx没有截止时间但被取消时，关闭连接中断阻塞的读写
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP服务器不支持AUTH")
+		}
+		if err := client.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// 解析单个收件人地址，只返回邮箱部分 (不含显示名称)
+func parseMailAddress(address string) (string, error) {
+	if strings.ContainsAny(address, "\r\n") {
+		return "", AppError{Code: 400, Message: "邮箱地址不能包含换行"}
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", AppError{Code: 400, Message: "邮箱地址格式错误: " + address}
+	}
+	return parsed.Address, nil
+}
+
+// WebhookNotifier 通用HTTP回调通知，将通知以JSON POST到用户配置的URL
+// 回调地址由用户填写，只允许https，并且不能连接回环、内网、链路本地等地址，
+// 防止借回调访问内部服务。AllowedHosts中的主机 (如内网告警网关) 不受地址限制
+type WebhookNotifier struct {
+	Client       *http.Client
+	AllowedHosts []string
+}
+
+// NewWebhookNotifier 创建HTTP回调通知
+func NewWebhookNotifier(timeout time.Duration, allowedHosts []string) *WebhookNotifier {
+	n := &WebhookNotifier{AllowedHosts: allowedHosts}
+	n.Client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil, // 经代理时无法校验实际连接的地址
+			DialContext:         n.dialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return fmt.Errorf("重定向次数过多")
+			}
+			return checkWebhookURL(req.URL)
+		},
+	}
+	return n
+}
+
+// Channel 渠道名称
+func (n *WebhookNotifier) Channel() string {
+	return ChannelWebhook
+}
+
+// ValidateAddress 校验回调URL，解析域名后拒绝内网地址
+func (n *WebhookNotifier) ValidateAddress(ctx context.Context, address string) error {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return AppError{Code: 400, Message: "回调URL格式错误: " + address}
+	}
+	if err := checkWebhookURL(parsed); err != nil {
+		return AppError{Code: 400, Message: err.Error()}
+	}
+
+	host := parsed.Hostname()
+	if n.allowedHost(host) {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return AppError{Code: 400, Message: "回调URL的域名无法解析: " + host}
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return AppError{Code: 400, Message: "回调URL不能指向内网地址: " + addr.IP.String()}
+		}
+	}
+	return nil
+}
+
+// Send 发送HTTP回调
+func (n *WebhookNotifier) Send(ctx context.Context, address string, notification Notification) error {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("回调URL格式错误: %v", err)
+	}
+	if err := checkWebhookURL(parsed); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.Client, address, payload, nil)
+}
+
+// 建立连接时校验实际连接的IP，DNS重绑定也无法绕过
+func (n *WebhookNotifier) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: n.Client.Timeout}
+	if !n.allowedHost(host) {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("回调URL不能指向内网地址: %s", host)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (n *WebhookNotifier) allowedHost(host string) bool {
+	for _, allowed := range n.AllowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// 回调URL必须是带主机名的https地址
+func checkWebhookURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("回调URL必须使用https: %s", u.Redacted())
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("回调URL缺少主机名")
+	}
+	return nil
+}
+
+// 不允许回调连接的保留网段 (net.IP的判断方法未覆盖的部分)
+var reservedNetworks = func() []*net.IPNet {
+	networks := make([]*net.IPNet, 0)
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // 本网络
+		"100.64.0.0/10", // 运营商级NAT
+		"192.0.0.0/24",  // IETF协议分配
+		"198.18.0.0/15", // 基准测试
+		"240.0.0.0/4",   // 保留地址及广播
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// 判断是否为可以从公网访问的单播地址
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// SMSGatewayNotifier 通过HTTP短信网关发送短信
+type SMSGatewayNotifier struct {
+	Endpoint string // 网关地址
+	APIKey   string // 网关密钥，以Bearer方式发送
+	Client   *http.Client
+}
+
+// NewSMSGatewayNotifier 创建短信网关通知
+func NewSMSGatewayNotifier(config *NotificationConfig) *SMSGatewayNotifier {
+	return &SMSGatewayNotifier{
+		Endpoint: config.SMSGatewayURL,
+		APIKey:   config.SMSGatewayAPIKey,
+		Client:   &http.Client{Timeout: config.HTTPTimeout},
+	}
+}
+
+// Channel 渠道名称
+func (n *SMSGatewayNotifier) Channel() string {
+	return ChannelSMS
+}
+
+// Send 发送短信
+func (n *SMSGatewayNotifier) Send(ctx context.Context, address string, notification Notification) error {
+	message := notification.Subject
+	if notification.Body != "" {
+		message += ": " + notification.Body
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"to":      address,
+		"message": message,
+	})
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if n.APIKey != "" {
+		headers["Authorization"] = "Bearer " + n.APIKey
+	}
+	return postJSON(ctx, n.Client, n.Endpoint, payload, headers)
+}
+
+// LogNotifier 本地开发与测试使用的通知渠道
+// Path为空时写入标准日志，否则以JSON行追加到文件
+// 可以以任意渠道名称注册，用于在本地替代邮件和短信
+type LogNotifier struct {
+	channel string
+	Path    string
+	mu      sync.Mutex
+}
+
+// NewLogNotifier 创建日志通知
+func NewLogNotifier(channel, path string) *LogNotifier {
+	return &LogNotifier{channel: channel, Path: path}
+}
+
+// Channel 渠道名称
+func (n *LogNotifier) Channel() string {
+	return n.channel
+}
+
+// Send 记录通知
+func (n *LogNotifier) Send(ctx context.Context, address string, notification Notification) error {
+	if n.Path == "" {
+		log.Printf("[通知:%s] -> %s %s: %s", n.channel, address, notification.Subject, notification.Body)
+		return nil
+	}
+
+	line, err := json.Marshal(map[string]interface{}{
+		"channel":      n.channel,
+		"address":      address,
+		"notification": notification,
+		"sent_at":      time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开通知日志文件失败: %v", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// 发送JSON POST请求，非2xx响应视为失败
+func postJSON(ctx context.Context, client *http.Client, url string, payload []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("对端返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 种植园管理处理器 ====================
+
+// CreateFarm 创建农场
+// POST /api/v1/plantation/farms
+func CreateFarm(c *gin.Context) {
+	var req CreateFarmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	farm, err := plantationRepo.CreateFarm(c.Request.Context(), Farm{
+		Name:        req.Name,
+		Owner:       req.Owner,
+		Latitude:    *req.Latitude,
+		Longitude:   *req.Longitude,
+		Description: req.Description,
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, farm)
+}
+
+// ListFarms 列出农场
+// GET /api/v1/plantation/farms
+func ListFarms(c *gin.Context) {
+	farms, err := plantationRepo.ListFarms(c.Request.Context())
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"total": len(farms),
+		"farms": farms,
+	})
+}
+
+// GetFarm 获取农场详情
+// GET /api/v1/plantation/farms/:id
+func GetFarm(c *gin.Context) {
+	farm, err := plantationRepo.GetFarm(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, farm)
+}
+
+// CreateBlock 在农场下创建地块
+// POST /api/v1/plantation/farms/:id/blocks
+func CreateBlock(c *gin.Context) {
+	var req CreateBlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	block, err := plantationRepo.CreateBlock(c.Request.Context(), Block{
+		FarmID:      c.Param("id"),
+		Name:        req.Name,
+		Latitude:    *req.Latitude,
+		Longitude:   *req.Longitude,
+		Description: req.Description,
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, block)
+}
+
+// ListBlocks 列出农场下的地块
+// GET /api/v1/plantation/farms/:id/blocks
+func ListBlocks(c *gin.Context) {
+	blocks, err := plantationRepo.ListBlocks(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"total":  len(blocks),
+		"blocks": blocks,
+	})
+}
+
+// CreateTree 在地块下登记树木
+// POST /api/v1/plantation/blocks/:id/trees
+func CreateTree(c *gin.Context) {
+	var req CreateTreeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	tree, err := plantationRepo.CreateTree(c.Request.Context(), Tree{
+		BlockID:     c.Param("id"),
+		Code:        req.Code,
+		Species:     req.Species,
+		PlantedYear: req.PlantedYear,
+		Latitude:    *req.Latitude,
+		Longitude:   *req.Longitude,
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, tree)
+}
+
+// ListTrees 列出地块下的树木
+// GET /api/v1/plantation/blocks/:id/trees
+func ListTrees(c *gin.Context) {
+	trees, err := plantationRepo.ListTrees(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"total": len(trees),
+		"trees": trees,
+	})
+}
+
+// GetTree 获取树木详情
+// GET /api/v1/plantation/trees/:id
+func GetTree(c *gin.Context) {
+	tree, err := plantationRepo.GetTree(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, tree)
+}
+
+// CreateTreatment 记录对树木的处理 (注药、喷药、移除等)
+// POST /api/v1/plantation/trees/:id/treatments
+func CreateTreatment(c *gin.Context) {
+	var req CreateTreatmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	treatedAt := time.Now()
+	if req.TreatedAt != nil {
+		treatedAt = *req.TreatedAt
+	}
+
+	treatment, err := plantationRepo.CreateTreatment(c.Request.Context(), Treatment{
+		TreeID:    c.Param("id"),
+		TreatedAt: treatedAt,
+		Method:    req.Method,
+		Chemical:  req.Chemical,
+		Dosage:    req.Dosage,
+		Operator:  req.Operator,
+		Notes:     req.Notes,
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, treatment)
+}
+
+// ListTreatments 列出树木的处理记录
+// GET /api/v1/plantation/trees/:id/treatments
+func ListTreatments(c *gin.Context) {
+	treatments, err := plantationRepo.ListTreatments(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"tree_id":    c.Param("id"),
+		"total":      len(treatments),
+		"treatments": treatments,
+	})
+}
+
+// AttachSensor 将传感器安装到树上
+// POST /api/v1/plantation/placements
+func AttachSensor(c *gin.Context) {
+	var req AttachSensorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	attachedAt := time.Now()
+	if req.AttachedAt != nil {
+		attachedAt = *req.AttachedAt
+	}
+
+	placement, err := plantationRepo.AttachSensor(c.Request.Context(), req.DeviceID, req.TreeID, attachedAt, req.Notes)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, placement)
+}
+
+// DetachSensor 拆除传感器
+// POST /api/v1/plantation/placements/:id/detach
+func DetachSensor(c *gin.Context) {
+	var req DetachSensorRequest
+	// 请求体可选；分块传输时ContentLength未知，因此总是尝试解析，空请求体按未提供处理
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	detachedAt := time.Now()
+	if req.DetachedAt != nil {
+		detachedAt = *req.DetachedAt
+	}
+
+	placement, err := plantationRepo.DetachSensor(c.Request.Context(), c.Param("id"), detachedAt)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, placement)
+}
+
+// ListDevicePlacements 查询设备的安装历史
+// GET /api/v1/plantation/devices/:id/placements
+func ListDevicePlacements(c *gin.Context) {
+	placements, err := plantationRepo.ListPlacements(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"device_id":  c.Param("id"),
+		"total":      len(placements),
+		"placements": placements,
+	})
+}
+
+// GetDevicePlacement 查询设备在某一时间点安装在哪棵树上
+// GET /api/v1/plantation/devices/:id/placement?at=2024-01-15T14:00:00Z
+func GetDevicePlacement(c *gin.Context) {
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "时间格式错误，应为RFC3339: "+value)
+			return
+		}
+		at = parsed
+	}
+
+	placement, err := plantationRepo.PlacementAt(c.Request.Context(), c.Param("id"), at)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	tree, err := plantationRepo.GetTree(c.Request.Context(), placement.TreeID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"placement": placement,
+		"tree":      tree,
+	})
+}
@@ -0,0 +1,275 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建注册了全部业务路由的测试引擎
+func newTestEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router)
+	return router
+}
+
+// 设置种植园测试路由 (使用空的种植园仓库)
+func setupPlantationRouter() *gin.Engine {
+	plantationRepo = NewMemoryPlantationRepository()
+	return newTestEngine()
+}
+
+// 创建农场和地块
+func seedBlock(t *testing.T) Block {
+	farm, err := plantationRepo.CreateFarm(context.Background(), Farm{Name: "农场"})
+	assert.NoError(t, err)
+	block, err := plantationRepo.CreateBlock(context.Background(), Block{FarmID: farm.ID, Name: "A1"})
+	assert.NoError(t, err)
+	return block
+}
+
+// 在地块下登记树木
+func seedTree(t *testing.T, tree Tree) Tree {
+	tree, err := plantationRepo.CreateTree(context.Background(), tree)
+	assert.NoError(t, err)
+	return tree
+}
+
+// 发送JSON请求并返回响应数据
+func doJSON(t *testing.T, router *gin.Engine, method, path, body string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var response APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	data, _ := response.Data.(map[string]interface{})
+	return w.Code, data
+}
+
+// 测试农场/地块/树木层级
+func TestPlantationHierarchy(t *testing.T) {
+	router := setupPlantationRouter()
+
+	code, farm := doJSON(t, router, "POST", "/api/v1/plantation/farms", `{"name":"东区农场","latitude":24.1,"longitude":45.2}`)
+	assert.Equal(t, http.StatusOK, code)
+	farmID := farm["id"].(string)
+
+	code, block := doJSON(t, router, "POST", "/api/v1/plantation/farms/"+farmID+"/blocks", `{"name":"A1","latitude":24.1,"longitude":45.2}`)
+	assert.Equal(t, http.StatusOK, code)
+	blockID := block["id"].(string)
+
+	code, tree := doJSON(t, router, "POST", "/api/v1/plantation/blocks/"+blockID+"/trees", `{"code":"P-001","latitude":24.1001,"longitude":45.2002}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, farmID, tree["farm_id"])
+
+	code, list := doJSON(t, router, "GET", "/api/v1/plantation/blocks/"+blockID+"/trees", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), list["total"])
+
+	// 不存在的地块
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/blocks/block_missing/trees", `{"code":"P-002","latitude":24.1,"longitude":45.2}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 坐标越界
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/farms", `{"name":"越界","latitude":91,"longitude":45.2}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 缺少坐标时不能默认为(0,0)，0本身是合法坐标
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/blocks/"+blockID+"/trees", `{"code":"P-003"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/blocks/"+blockID+"/trees", `{"code":"P-003","latitude":24.1}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/blocks/"+blockID+"/trees", `{"code":"P-003","latitude":0,"longitude":0}`)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+// 测试传感器移动后仍能按时间归属到正确的树
+func TestSensorPlacementHistory(t *testing.T) {
+	router := setupPlantationRouter()
+
+	block := seedBlock(t)
+	treeA := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+	treeB := seedTree(t, Tree{BlockID: block.ID, Code: "P-002"})
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(72 * time.Hour)
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/plantation/placements",
+		`{"device_id":"dev_001","tree_id":"`+treeA.ID+`","attached_at":"`+t0.Format(time.RFC3339)+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// 传感器移动到另一棵树，旧记录自动结束
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/placements",
+		`{"device_id":"dev_001","tree_id":"`+treeB.ID+`","attached_at":"`+t1.Format(time.RFC3339)+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// 不能在已有记录之前插入安装记录
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/placements",
+		`{"device_id":"dev_001","tree_id":"`+treeA.ID+`","attached_at":"`+t0.Format(time.RFC3339)+`"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, data := doJSON(t, router, "GET", "/api/v1/plantation/devices/dev_001/placement?at="+t0.Add(time.Hour).Format(time.RFC3339), "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, treeA.ID, data["tree"].(map[string]interface{})["id"])
+
+	code, data = doJSON(t, router, "GET", "/api/v1/plantation/devices/dev_001/placement?at="+t1.Add(time.Hour).Format(time.RFC3339), "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, treeB.ID, data["tree"].(map[string]interface{})["id"])
+
+	// 安装之前没有归属
+	code, _ = doJSON(t, router, "GET", "/api/v1/plantation/devices/dev_001/placement?at="+t0.Add(-time.Hour).Format(time.RFC3339), "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, data = doJSON(t, router, "GET", "/api/v1/plantation/devices/dev_001/placements", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), data["total"])
+}
+
+// 测试设备注册时指定树木
+func TestDeviceRegisterWithTree(t *testing.T) {
+	router := setupPlantationRouter()
+
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+
+	code, data := doJSON(t, router, "POST", "/api/v1/device/register",
+		`{"device_id":"dev_009","device_name":"检测设备","tree_id":"`+tree.ID+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	placementID := data["placement"].(map[string]interface{})["id"]
+	assert.Equal(t, tree.ID, data["placement"].(map[string]interface{})["tree_id"])
+
+	// 重复注册到同一棵树时沿用当前安装记录
+	code, data = doJSON(t, router, "POST", "/api/v1/device/register",
+		`{"device_id":"dev_009","device_name":"检测设备","tree_id":"`+tree.ID+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, placementID, data["placement"].(map[string]interface{})["id"])
+	placements, err := plantationRepo.ListPlacements(context.Background(), "dev_009")
+	assert.NoError(t, err)
+	assert.Len(t, placements, 1)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/device/register",
+		`{"device_id":"dev_010","device_name":"检测设备","tree_id":"tree_missing","latitude":24.1,"longitude":45.2}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 安装失败时不保存坐标
+	positions, err := DevicePositions(context.Background(), time.Now())
+	assert.NoError(t, err)
+	for _, position := range positions {
+		assert.NotEqual(t, "dev_010", position.DeviceID)
+	}
+}
+
+// 测试拆除传感器的可选请求体
+func TestDetachSensorBody(t *testing.T) {
+	router := setupPlantationRouter()
+
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first, err := plantationRepo.AttachSensor(context.Background(), "dev_001", tree.ID, t0, "")
+	assert.NoError(t, err)
+	second, err := plantationRepo.AttachSensor(context.Background(), "dev_002", tree.ID, t0, "")
+	assert.NoError(t, err)
+
+	// 分块传输的请求体没有ContentLength，仍需解析拆除时间
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/plantation/placements/"+first.ID+"/detach",
+		strings.NewReader(`{"detached_at":"2024-01-02T00:00:00Z"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	placement, err := plantationRepo.PlacementAt(context.Background(), "dev_001", t0)
+	assert.NoError(t, err)
+	assert.Equal(t, t0.Add(24*time.Hour), *placement.DetachedAt)
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/plantation/placements/"+second.ID+"/detach", `{"detached_at":"bogus"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 没有请求体时使用当前时间
+	code, data := doJSON(t, router, "POST", "/api/v1/plantation/placements/"+second.ID+"/detach", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotNil(t, data["detached_at"])
+}
+
+// 测试上传任务按设备安装记录归属到树
+func TestUploadJobAttributedToTree(t *testing.T) {
+	router := setupPlantationRouter()
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+
+	block := seedBlock(t)
+	first := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+	second := seedTree(t, Tree{BlockID: block.ID, Code: "P-002"})
+
+	// 没有安装记录时不归属任何树，补登记录后在完成时按创建时间归属
+	jobID, key := createTestJob(t, router)
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Empty(t, job.TreeID)
+
+	placement, err := plantationRepo.AttachSensor(context.Background(), "dev_001", first.ID, job.CreatedAt.Add(-time.Hour), "")
+	assert.NoError(t, err)
+	storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav", map[string]string{"job_id": jobID})
+	code, _ := doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{}`)
+	assert.Equal(t, http.StatusOK, code)
+	job, _ = uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, first.ID, job.TreeID)
+
+	// 传感器移到另一棵树后，新任务归属新树，已保存的归属不变
+	movedAt := time.Now().Add(-time.Minute)
+	_, err = plantationRepo.DetachSensor(context.Background(), placement.ID, movedAt)
+	assert.NoError(t, err)
+	_, err = plantationRepo.AttachSensor(context.Background(), "dev_001", second.ID, movedAt, "")
+	assert.NoError(t, err)
+	movedID, _ := createTestJob(t, router)
+
+	code, data := doJSON(t, router, "GET", "/api/v1/jobs/"+movedID, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, second.ID, data["tree_id"])
+
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs?tree_id="+first.ID, "")
+	assert.Equal(t, http.StatusOK, code)
+	jobs := data["data"].([]interface{})
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, jobID, jobs[0].(map[string]interface{})["id"])
+}
+
+// 测试树木处理记录
+func TestTreatmentRecords(t *testing.T) {
+	router := setupPlantationRouter()
+
+	block := seedBlock(t)
+	tree := seedTree(t, Tree{BlockID: block.ID, Code: "P-001"})
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/plantation/trees/"+tree.ID+"/treatments",
+		`{"method":"injection","chemical":"吡虫啉","operator":"张三","treated_at":"2024-03-01T08:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/trees/"+tree.ID+"/treatments",
+		`{"method":"removal","operator":"李四","treated_at":"2024-02-01T08:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// 不支持的处理方式
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/trees/"+tree.ID+"/treatments", `{"method":"prayer","operator":"王五"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/plantation/trees/tree_missing/treatments", `{"method":"other","operator":"王五"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, data := doJSON(t, router, "GET", "/api/v1/plantation/trees/"+tree.ID+"/treatments", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), data["total"])
+	first := data["treatments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "removal", first["method"])
+}
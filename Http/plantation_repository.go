@@ -0,0 +1,1010 @@
+package httpserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ==================== 种植园数据持久化 ====================
+
+// 全局种植园仓库实例，StartServer中按配置替换
+var plantationRepo PlantationRepository = NewMemoryPlantationRepository()
+
+// PlantationRepository 农场/地块/树木/传感器安装记录、设备登记坐标与处理记录仓库接口
+// 上传任务按tree_id持久化归属的树，树和安装历史需要同样持久化，重启后归属关系才能保持有效
+type PlantationRepository interface {
+	// 创建农场 (生成ID和时间)
+	CreateFarm(ctx context.Context, farm Farm) (Farm, error)
+
+	// 获取农场，不存在时返回ErrFarmNotFound
+	GetFarm(ctx context.Context, id string) (Farm, error)
+
+	// 列出所有农场 (按创建时间排序)
+	ListFarms(ctx context.Context) ([]Farm, error)
+
+	// 在农场下创建地块，农场不存在时返回ErrFarmNotFound
+	CreateBlock(ctx context.Context, block Block) (Block, error)
+
+	// 获取地块，不存在时返回ErrBlockNotFound
+	GetBlock(ctx context.Context, id string) (Block, error)
+
+	// 列出农场下的地块 (按创建时间排序)，农场不存在时返回ErrFarmNotFound
+	ListBlocks(ctx context.Context, farmID string) ([]Block, error)
+
+	// 在地块下登记树木，地块不存在时返回ErrBlockNotFound
+	CreateTree(ctx context.Context, tree Tree) (Tree, error)
+
+	// 获取树木，不存在时返回ErrTreeNotFound
+	GetTree(ctx context.Context, id string) (Tree, error)
+
+	// 列出地块下的树木 (按编号排序)，地块不存在时返回ErrBlockNotFound
+	ListTrees(ctx context.Context, blockID string) ([]Tree, error)
+
+	// 列出所有树木 (按编号排序)
+	ListAllTrees(ctx context.Context) ([]Tree, error)
+
+	// 将设备安装到树上，设备仍安装在其他树上时在新的安装时间点结束旧记录
+	// 安装时间不晚于最后一条记录时返回ErrPlacementOverlap
+	AttachSensor(ctx context.Context, deviceID, treeID string, at time.Time, notes string) (SensorPlacement, error)
+
+	// 结束一条安装记录，已结束的记录只允许提前结束时间
+	DetachSensor(ctx context.Context, placementID string, at time.Time) (SensorPlacement, error)
+
+	// 列出设备的安装历史 (按安装时间排序)
+	ListPlacements(ctx context.Context, deviceID string) ([]SensorPlacement, error)
+
+	// 查询设备在指定时间点的安装记录，没有时返回ErrPlacementNotFound
+	PlacementAt(ctx context.Context, deviceID string, at time.Time) (SensorPlacement, error)
+
+	// 列出指定时间点生效的全部安装记录
+	ActivePlacements(ctx context.Context, at time.Time) ([]SensorPlacement, error)
+
+	// 记录设备登记坐标，已有坐标时覆盖
+	SetDeviceLocation(ctx context.Context, location DeviceLocation) (DeviceLocation, error)
+
+	// 列出所有设备的登记坐标 (按设备ID排序)
+	ListDeviceLocations(ctx context.Context) ([]DeviceLocation, error)
+
+	// 为树木添加处理记录 (生成ID和创建时间)，树木不存在时返回ErrTreeNotFound
+	CreateTreatment(ctx context.Context, treatment Treatment) (Treatment, error)
+
+	// 列出树木的处理记录 (按处理时间排序)，树木不存在时返回ErrTreeNotFound
+	ListTreatments(ctx context.Context, treeID string) ([]Treatment, error)
+}
+
+// 在设备的最后一条安装记录之后追加新记录，返回需要结束的旧记录拆除时间 (不需要时为nil)
+func nextPlacement(last *SensorPlacement, at time.Time) (*time.Time, error) {
+	if last == nil {
+		return nil, nil
+	}
+	if !at.After(last.AttachedAt) {
+		return nil, ErrPlacementOverlap
+	}
+	if last.DetachedAt == nil {
+		return &at, nil
+	}
+	if at.Before(*last.DetachedAt) {
+		return nil, ErrPlacementOverlap
+	}
+	return nil, nil
+}
+
+// 计算结束安装记录后的拆除时间，返回nil表示保持原拆除时间
+func detachTime(placement *SensorPlacement, at time.Time) (*time.Time, error) {
+	if at.Before(placement.AttachedAt) {
+		return nil, ErrInvalidTimeRange
+	}
+	// 已结束的记录只允许提前结束时间，避免与后续安装记录重叠
+	if placement.DetachedAt == nil || at.Before(*placement.DetachedAt) {
+		return &at, nil
+	}
+	return nil, nil
+}
+
+// DevicePositions 返回所有已知位置的设备
+// 设备当前安装在树上时使用树的坐标，否则使用登记坐标
+func DevicePositions(ctx context.Context, at time.Time) ([]DevicePosition, error) {
+	locations, err := plantationRepo.ListDeviceLocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]DevicePosition)
+	for _, location := range locations {
+		positions[location.DeviceID] = DevicePosition{
+			DeviceID:  location.DeviceID,
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Source:    "registered",
+		}
+	}
+
+	placements, err := plantationRepo.ActivePlacements(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	for _, placement := range placements {
+		tree, err := plantationRepo.GetTree(ctx, placement.TreeID)
+		if errors.Is(err, ErrTreeNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		positions[placement.DeviceID] = DevicePosition{
+			DeviceID:  placement.DeviceID,
+			TreeID:    tree.ID,
+			Latitude:  tree.Latitude,
+			Longitude: tree.Longitude,
+			Source:    "placement",
+		}
+	}
+
+	result := make([]DevicePosition, 0, len(positions))
+	for _, position := range positions {
+		result = append(result, position)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DeviceID < result[j].DeviceID })
+	return result, nil
+}
+
+// ==================== 内存实现 ====================
+
+// MemoryPlantationRepository 内存种植园仓库
+type MemoryPlantationRepository struct {
+	mu         sync.RWMutex
+	farms      map[string]*Farm
+	blocks     map[string]*Block
+	trees      map[string]*Tree
+	placements map[string][]*SensorPlacement // device_id -> 按安装时间排序的安装记录
+	devices    map[string]*DeviceLocation    // device_id -> 设备登记坐标
+	treatments map[string][]*Treatment       // tree_id -> 处理记录
+}
+
+// NewMemoryPlantationRepository 创建内存种植园仓库
+func NewMemoryPlantationRepository() *MemoryPlantationRepository {
+	return &MemoryPlantationRepository{
+		farms:      make(map[string]*Farm),
+		blocks:     make(map[string]*Block),
+		trees:      make(map[string]*Tree),
+		placements: make(map[string][]*SensorPlacement),
+		devices:    make(map[string]*DeviceLocation),
+		treatments: make(map[string][]*Treatment),
+	}
+}
+
+// CreateFarm 创建农场
+func (r *MemoryPlantationRepository) CreateFarm(ctx context.Context, farm Farm) (Farm, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	farm.ID = generateID("farm")
+	farm.CreatedAt = now
+	farm.UpdatedAt = now
+	r.farms[farm.ID] = &farm
+	return farm, nil
+}
+
+// GetFarm 获取农场
+func (r *MemoryPlantationRepository) GetFarm(ctx context.Context, id string) (Farm, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	farm, ok := r.farms[id]
+	if !ok {
+		return Farm{}, ErrFarmNotFound
+	}
+	return *farm, nil
+}
+
+// ListFarms 列出所有农场
+func (r *MemoryPlantationRepository) ListFarms(ctx context.Context) ([]Farm, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	farms := make([]Farm, 0, len(r.farms))
+	for _, farm := range r.farms {
+		farms = append(farms, *farm)
+	}
+	sort.Slice(farms, func(i, j int) bool { return farms[i].CreatedAt.Before(farms[j].CreatedAt) })
+	return farms, nil
+}
+
+// CreateBlock 在农场下创建地块
+func (r *MemoryPlantationRepository) CreateBlock(ctx context.Context, block Block) (Block, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.farms[block.FarmID]; !ok {
+		return Block{}, ErrFarmNotFound
+	}
+
+	now := time.Now()
+	block.ID = generateID("block")
+	block.CreatedAt = now
+	block.UpdatedAt = now
+	r.blocks[block.ID] = &block
+	return block, nil
+}
+
+// GetBlock 获取地块
+func (r *MemoryPlantationRepository) GetBlock(ctx context.Context, id string) (Block, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	block, ok := r.blocks[id]
+	if !ok {
+		return Block{}, ErrBlockNotFound
+	}
+	return *block, nil
+}
+
+// ListBlocks 列出农场下的地块
+func (r *MemoryPlantationRepository) ListBlocks(ctx context.Context, farmID string) ([]Block, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.farms[farmID]; !ok {
+		return nil, ErrFarmNotFound
+	}
+
+	blocks := make([]Block, 0)
+	for _, block := range r.blocks {
+		if block.FarmID == farmID {
+			blocks = append(blocks, *block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].CreatedAt.Before(blocks[j].CreatedAt) })
+	return blocks, nil
+}
+
+// CreateTree 在地块下登记树木
+func (r *MemoryPlantationRepository) CreateTree(ctx context.Context, tree Tree) (Tree, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	block, ok := r.blocks[tree.BlockID]
+	if !ok {
+		return Tree{}, ErrBlockNotFound
+	}
+
+	now := time.Now()
+	tree.ID = generateID("tree")
+	tree.FarmID = block.FarmID
+	tree.CreatedAt = now
+	tree.UpdatedAt = now
+	r.trees[tree.ID] = &tree
+	return tree, nil
+}
+
+// GetTree 获取树木
+func (r *MemoryPlantationRepository) GetTree(ctx context.Context, id string) (Tree, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tree, ok := r.trees[id]
+	if !ok {
+		return Tree{}, ErrTreeNotFound
+	}
+	return *tree, nil
+}
+
+// ListTrees 列出地块下的树木
+func (r *MemoryPlantationRepository) ListTrees(ctx context.Context, blockID string) ([]Tree, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.blocks[blockID]; !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	trees := make([]Tree, 0)
+	for _, tree := range r.trees {
+		if tree.BlockID == blockID {
+			trees = append(trees, *tree)
+		}
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].Code < trees[j].Code })
+	return trees, nil
+}
+
+// ListAllTrees 列出所有树木
+func (r *MemoryPlantationRepository) ListAllTrees(ctx context.Context) ([]Tree, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	trees := make([]Tree, 0, len(r.trees))
+	for _, tree := range r.trees {
+		trees = append(trees, *tree)
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].Code < trees[j].Code })
+	return trees, nil
+}
+
+// AttachSensor 将设备安装到树上
+func (r *MemoryPlantationRepository) AttachSensor(ctx context.Context, deviceID, treeID string, at time.Time, notes string) (SensorPlacement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.trees[treeID]; !ok {
+		return SensorPlacement{}, ErrTreeNotFound
+	}
+
+	history := r.placements[deviceID]
+	var last *SensorPlacement
+	if n := len(history); n > 0 {
+		last = history[n-1]
+	}
+	detachedAt, err := nextPlacement(last, at)
+	if err != nil {
+		return SensorPlacement{}, err
+	}
+	if detachedAt != nil {
+		last.DetachedAt = detachedAt
+	}
+
+	placement := &SensorPlacement{
+		ID:         generateID("placement"),
+		DeviceID:   deviceID,
+		TreeID:     treeID,
+		AttachedAt: at,
+		Notes:      notes,
+	}
+	r.placements[deviceID] = append(history, placement)
+	return *placement, nil
+}
+
+// DetachSensor 结束一条安装记录
+func (r *MemoryPlantationRepository) DetachSensor(ctx context.Context, placementID string, at time.Time) (SensorPlacement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, history := range r.placements {
+		for _, placement := range history {
+			if placement.ID != placementID {
+				continue
+			}
+			detachedAt, err := detachTime(placement, at)
+			if err != nil {
+				return SensorPlacement{}, err
+			}
+			if detachedAt != nil {
+				placement.DetachedAt = detachedAt
+			}
+			return *placement, nil
+		}
+	}
+
+	return SensorPlacement{}, ErrPlacementNotFound
+}
+
+// ListPlacements 列出设备的安装历史
+func (r *MemoryPlantationRepository) ListPlacements(ctx context.Context, deviceID string) ([]SensorPlacement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := r.placements[deviceID]
+	placements := make([]SensorPlacement, 0, len(history))
+	for _, placement := range history {
+		placements = append(placements, *placement)
+	}
+	return placements, nil
+}
+
+// PlacementAt 查询设备在指定时间点的安装记录
+func (r *MemoryPlantationRepository) PlacementAt(ctx context.Context, deviceID string, at time.Time) (SensorPlacement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, placement := range r.placements[deviceID] {
+		if placement.ActiveAt(at) {
+			return *placement, nil
+		}
+	}
+	return SensorPlacement{}, ErrPlacementNotFound
+}
+
+// ActivePlacements 列出指定时间点生效的安装记录
+func (r *MemoryPlantationRepository) ActivePlacements(ctx context.Context, at time.Time) ([]SensorPlacement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	placements := make([]SensorPlacement, 0)
+	for _, history := range r.placements {
+		for _, placement := range history {
+			if placement.ActiveAt(at) {
+				placements = append(placements, *placement)
+			}
+		}
+	}
+	return placements, nil
+}
+
+// SetDeviceLocation 记录设备登记坐标
+func (r *MemoryPlantationRepository) SetDeviceLocation(ctx context.Context, location DeviceLocation) (DeviceLocation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	location.UpdatedAt = time.Now()
+	r.devices[location.DeviceID] = &location
+	return location, nil
+}
+
+// ListDeviceLocations 列出所有设备的登记坐标
+func (r *MemoryPlantationRepository) ListDeviceLocations(ctx context.Context) ([]DeviceLocation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	locations := make([]DeviceLocation, 0, len(r.devices))
+	for _, location := range r.devices {
+		locations = append(locations, *location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].DeviceID < locations[j].DeviceID })
+	return locations, nil
+}
+
+// CreateTreatment 为树木添加处理记录
+func (r *MemoryPlantationRepository) CreateTreatment(ctx context.Context, treatment Treatment) (Treatment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.trees[treatment.TreeID]; !ok {
+		return Treatment{}, ErrTreeNotFound
+	}
+
+	treatment.ID = generateID("treatment")
+	treatment.CreatedAt = time.Now()
+	r.treatments[treatment.TreeID] = append(r.treatments[treatment.TreeID], &treatment)
+	return treatment, nil
+}
+
+// ListTreatments 列出树木的处理记录
+func (r *MemoryPlantationRepository) ListTreatments(ctx context.Context, treeID string) ([]Treatment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.trees[treeID]; !ok {
+		return nil, ErrTreeNotFound
+	}
+
+	treatments := make([]Treatment, 0, len(r.treatments[treeID]))
+	for _, treatment := range r.treatments[treeID] {
+		treatments = append(treatments, *treatment)
+	}
+	sort.Slice(treatments, func(i, j int) bool { return treatments[i].TreatedAt.Before(treatments[j].TreatedAt) })
+	return treatments, nil
+}
+
+// ==================== MySQL实现 ====================
+
+// 种植园表结构
+var plantationSchemas = []string{
+	"CREATE TABLE IF NOT EXISTS farms (" +
+		"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+		"name VARCHAR(255) NOT NULL," +
+		"owner VARCHAR(255) NOT NULL," +
+		"latitude DOUBLE NOT NULL," +
+		"longitude DOUBLE NOT NULL," +
+		"description TEXT NOT NULL," +
+		"created_at DATETIME(3) NOT NULL," +
+		"updated_at DATETIME(3) NOT NULL" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+	"CREATE TABLE IF NOT EXISTS blocks (" +
+		"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+		"farm_id VARCHAR(64) NOT NULL," +
+		"name VARCHAR(255) NOT NULL," +
+		"latitude DOUBLE NOT NULL," +
+		"longitude DOUBLE NOT NULL," +
+		"description TEXT NOT NULL," +
+		"created_at DATETIME(3) NOT NULL," +
+		"updated_at DATETIME(3) NOT NULL," +
+		"KEY idx_blocks_farm_created (farm_id, created_at)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+	"CREATE TABLE IF NOT EXISTS trees (" +
+		"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+		"farm_id VARCHAR(64) NOT NULL," +
+		"block_id VARCHAR(64) NOT NULL," +
+		"code VARCHAR(64) NOT NULL," +
+		"species VARCHAR(128) NOT NULL," +
+		"planted_year INT NOT NULL," +
+		"latitude DOUBLE NOT NULL," +
+		"longitude DOUBLE NOT NULL," +
+		"created_at DATETIME(3) NOT NULL," +
+		"updated_at DATETIME(3) NOT NULL," +
+		"KEY idx_trees_block_code (block_id, code)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+	"CREATE TABLE IF NOT EXISTS sensor_placements (" +
+		"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+		"device_id VARCHAR(128) NOT NULL," +
+		"tree_id VARCHAR(64) NOT NULL," +
+		"attached_at DATETIME(3) NOT NULL," +
+		"detached_at DATETIME(3) NULL," +
+		"notes TEXT NOT NULL," +
+		"KEY idx_sensor_placements_device_attached (device_id, attached_at)," +
+		"KEY idx_sensor_placements_tree (tree_id)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+	"CREATE TABLE IF NOT EXISTS device_locations (" +
+		"device_id VARCHAR(128) NOT NULL PRIMARY KEY," +
+		"latitude DOUBLE NOT NULL," +
+		"longitude DOUBLE NOT NULL," +
+		"updated_at DATETIME(3) NOT NULL" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+	"CREATE TABLE IF NOT EXISTS treatments (" +
+		"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+		"tree_id VARCHAR(64) NOT NULL," +
+		"treated_at DATETIME(3) NOT NULL," +
+		"method VARCHAR(32) NOT NULL," +
+		"chemical VARCHAR(255) NOT NULL," +
+		"dosage VARCHAR(255) NOT NULL," +
+		"operator VARCHAR(255) NOT NULL," +
+		"notes TEXT NOT NULL," +
+		"created_at DATETIME(3) NOT NULL," +
+		"KEY idx_treatments_tree_treated (tree_id, treated_at)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+}
+
+// 查询列 (顺序与对应的scan函数一致)
+const (
+	farmColumns      = "id, name, owner, latitude, longitude, description, created_at, updated_at"
+	blockColumns     = "id, farm_id, name, latitude, longitude, description, created_at, updated_at"
+	treeColumns      = "id, farm_id, block_id, code, species, planted_year, latitude, longitude, created_at, updated_at"
+	placementColumns = "id, device_id, tree_id, attached_at, detached_at, notes"
+	locationColumns  = "device_id, latitude, longitude, updated_at"
+	treatmentColumns = "id, tree_id, treated_at, method, chemical, dosage, operator, notes, created_at"
+)
+
+// MySQLPlantationRepository MySQL种植园仓库
+// DATETIME(3)只保存到毫秒且MySQL会四舍五入，写入前统一截断到毫秒，避免安装时间被进位到查询时间之后
+type MySQLPlantationRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLPlantationRepository 创建MySQL种植园仓库
+func NewMySQLPlantationRepository(conn *sql.DB) *MySQLPlantationRepository {
+	return &MySQLPlantationRepository{db: conn}
+}
+
+// Migrate 创建种植园相关的表
+func (r *MySQLPlantationRepository) Migrate(ctx context.Context) error {
+	for _, schema := range plantationSchemas {
+		if _, err := r.db.ExecContext(ctx, schema); err != nil {
+			return fmt.Errorf("创建种植园表失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// CreateFarm 创建农场
+func (r *MySQLPlantationRepository) CreateFarm(ctx context.Context, farm Farm) (Farm, error) {
+	now := time.Now().Truncate(time.Millisecond)
+	farm.ID = generateID("farm")
+	farm.CreatedAt = now
+	farm.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO farms ("+farmColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		farm.ID, farm.Name, farm.Owner, farm.Latitude, farm.Longitude, farm.Description, farm.CreatedAt, farm.UpdatedAt)
+	if err != nil {
+		return Farm{}, fmt.Errorf("保存农场失败: %v", err)
+	}
+	return farm, nil
+}
+
+// GetFarm 获取农场
+func (r *MySQLPlantationRepository) GetFarm(ctx context.Context, id string) (Farm, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+farmColumns+" FROM farms WHERE id = ?", id)
+	farm, err := scanFarm(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Farm{}, ErrFarmNotFound
+	}
+	if err != nil {
+		return Farm{}, fmt.Errorf("查询农场失败: %v", err)
+	}
+	return farm, nil
+}
+
+// ListFarms 列出所有农场
+func (r *MySQLPlantationRepository) ListFarms(ctx context.Context) ([]Farm, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+farmColumns+" FROM farms ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("查询农场失败: %v", err)
+	}
+	defer rows.Close()
+
+	farms := make([]Farm, 0)
+	for rows.Next() {
+		farm, err := scanFarm(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取农场失败: %v", err)
+		}
+		farms = append(farms, farm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取农场失败: %v", err)
+	}
+	return farms, nil
+}
+
+// CreateBlock 在农场下创建地块
+func (r *MySQLPlantationRepository) CreateBlock(ctx context.Context, block Block) (Block, error) {
+	if _, err := r.GetFarm(ctx, block.FarmID); err != nil {
+		return Block{}, err
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	block.ID = generateID("block")
+	block.CreatedAt = now
+	block.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO blocks ("+blockColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		block.ID, block.FarmID, block.Name, block.Latitude, block.Longitude, block.Description, block.CreatedAt, block.UpdatedAt)
+	if err != nil {
+		return Block{}, fmt.Errorf("保存地块失败: %v", err)
+	}
+	return block, nil
+}
+
+// GetBlock 获取地块
+func (r *MySQLPlantationRepository) GetBlock(ctx context.Context, id string) (Block, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+blockColumns+" FROM blocks WHERE id = ?", id)
+	block, err := scanBlock(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Block{}, ErrBlockNotFound
+	}
+	if err != nil {
+		return Block{}, fmt.Errorf("查询地块失败: %v", err)
+	}
+	return block, nil
+}
+
+// ListBlocks 列出农场下的地块
+func (r *MySQLPlantationRepository) ListBlocks(ctx context.Context, farmID string) ([]Block, error) {
+	if _, err := r.GetFarm(ctx, farmID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+blockColumns+" FROM blocks WHERE farm_id = ? ORDER BY created_at, id", farmID)
+	if err != nil {
+		return nil, fmt.Errorf("查询地块失败: %v", err)
+	}
+	defer rows.Close()
+
+	blocks := make([]Block, 0)
+	for rows.Next() {
+		block, err := scanBlock(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取地块失败: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取地块失败: %v", err)
+	}
+	return blocks, nil
+}
+
+// CreateTree 在地块下登记树木
+func (r *MySQLPlantationRepository) CreateTree(ctx context.Context, tree Tree) (Tree, error) {
+	block, err := r.GetBlock(ctx, tree.BlockID)
+	if err != nil {
+		return Tree{}, err
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	tree.ID = generateID("tree")
+	tree.FarmID = block.FarmID
+	tree.CreatedAt = now
+	tree.UpdatedAt = now
+
+	_, err = r.db.ExecContext(ctx, "INSERT INTO trees ("+treeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		tree.ID, tree.FarmID, tree.BlockID, tree.Code, tree.Species, tree.PlantedYear,
+		tree.Latitude, tree.Longitude, tree.CreatedAt, tree.UpdatedAt)
+	if err != nil {
+		return Tree{}, fmt.Errorf("保存树木失败: %v", err)
+	}
+	return tree, nil
+}
+
+// GetTree 获取树木
+func (r *MySQLPlantationRepository) GetTree(ctx context.Context, id string) (Tree, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+treeColumns+" FROM trees WHERE id = ?", id)
+	tree, err := scanTree(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tree{}, ErrTreeNotFound
+	}
+	if err != nil {
+		return Tree{}, fmt.Errorf("查询树木失败: %v", err)
+	}
+	return tree, nil
+}
+
+// ListTrees 列出地块下的树木
+func (r *MySQLPlantationRepository) ListTrees(ctx context.Context, blockID string) ([]Tree, error) {
+	if _, err := r.GetBlock(ctx, blockID); err != nil {
+		return nil, err
+	}
+	return r.queryTrees(ctx, "SELECT "+treeColumns+" FROM trees WHERE block_id = ? ORDER BY code, id", blockID)
+}
+
+// ListAllTrees 列出所有树木
+func (r *MySQLPlantationRepository) ListAllTrees(ctx context.Context) ([]Tree, error) {
+	return r.queryTrees(ctx, "SELECT "+treeColumns+" FROM trees ORDER BY code, id")
+}
+
+func (r *MySQLPlantationRepository) queryTrees(ctx context.Context, query string, args ...interface{}) ([]Tree, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询树木失败: %v", err)
+	}
+	defer rows.Close()
+
+	trees := make([]Tree, 0)
+	for rows.Next() {
+		tree, err := scanTree(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取树木失败: %v", err)
+		}
+		trees = append(trees, tree)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取树木失败: %v", err)
+	}
+	return trees, nil
+}
+
+// AttachSensor 将设备安装到树上
+// 在事务中锁定设备的最后一条安装记录，同一设备的并发安装按顺序执行
+func (r *MySQLPlantationRepository) AttachSensor(ctx context.Context, deviceID, treeID string, at time.Time, notes string) (SensorPlacement, error) {
+	if _, err := r.GetTree(ctx, treeID); err != nil {
+		return SensorPlacement{}, err
+	}
+	at = at.Truncate(time.Millisecond)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SensorPlacement{}, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+placementColumns+" FROM sensor_placements "+
+		"WHERE device_id = ? ORDER BY attached_at DESC LIMIT 1 FOR UPDATE", deviceID)
+	var last *SensorPlacement
+	placement, err := scanPlacement(row)
+	if err == nil {
+		last = &placement
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return SensorPlacement{}, fmt.Errorf("查询安装记录失败: %v", err)
+	}
+
+	detachedAt, err := nextPlacement(last, at)
+	if err != nil {
+		return SensorPlacement{}, err
+	}
+	if detachedAt != nil {
+		if _, err := tx.ExecContext(ctx, "UPDATE sensor_placements SET detached_at = ? WHERE id = ?", *detachedAt, last.ID); err != nil {
+			return SensorPlacement{}, fmt.Errorf("结束安装记录失败: %v", err)
+		}
+	}
+
+	placement = SensorPlacement{
+		ID:         generateID("placement"),
+		DeviceID:   deviceID,
+		TreeID:     treeID,
+		AttachedAt: at,
+		Notes:      notes,
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO sensor_placements ("+placementColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		placement.ID, placement.DeviceID, placement.TreeID, placement.AttachedAt, nil, placement.Notes)
+	if err != nil {
+		return SensorPlacement{}, fmt.Errorf("保存安装记录失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return SensorPlacement{}, fmt.Errorf("保存安装记录失败: %v", err)
+	}
+	return placement, nil
+}
+
+// DetachSensor 结束一条安装记录
+func (r *MySQLPlantationRepository) DetachSensor(ctx context.Context, placementID string, at time.Time) (SensorPlacement, error) {
+	at = at.Truncate(time.Millisecond)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SensorPlacement{}, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+placementColumns+" FROM sensor_placements WHERE id = ? FOR UPDATE", placementID)
+	placement, err := scanPlacement(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SensorPlacement{}, ErrPlacementNotFound
+	}
+	if err != nil {
+		return SensorPlacement{}, fmt.Errorf("查询安装记录失败: %v", err)
+	}
+
+	detachedAt, err := detachTime(&placement, at)
+	if err != nil {
+		return SensorPlacement{}, err
+	}
+	if detachedAt == nil {
+		return placement, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE sensor_placements SET detached_at = ? WHERE id = ?", *detachedAt, placementID); err != nil {
+		return SensorPlacement{}, fmt.Errorf("结束安装记录失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return SensorPlacement{}, fmt.Errorf("结束安装记录失败: %v", err)
+	}
+	placement.DetachedAt = detachedAt
+	return placement, nil
+}
+
+// ListPlacements 列出设备的安装历史
+func (r *MySQLPlantationRepository) ListPlacements(ctx context.Context, deviceID string) ([]SensorPlacement, error) {
+	return r.queryPlacements(ctx, "SELECT "+placementColumns+" FROM sensor_placements WHERE device_id = ? ORDER BY attached_at", deviceID)
+}
+
+// PlacementAt 查询设备在指定时间点的安装记录
+func (r *MySQLPlantationRepository) PlacementAt(ctx context.Context, deviceID string, at time.Time) (SensorPlacement, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+placementColumns+" FROM sensor_placements "+
+		"WHERE device_id = ? AND attached_at <= ? AND (detached_at IS NULL OR detached_at > ?) "+
+		"ORDER BY attached_at DESC LIMIT 1", deviceID, at, at)
+	placement, err := scanPlacement(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SensorPlacement{}, ErrPlacementNotFound
+	}
+	if err != nil {
+		return SensorPlacement{}, fmt.Errorf("查询安装记录失败: %v", err)
+	}
+	return placement, nil
+}
+
+// ActivePlacements 列出指定时间点生效的安装记录
+func (r *MySQLPlantationRepository) ActivePlacements(ctx context.Context, at time.Time) ([]SensorPlacement, error) {
+	return r.queryPlacements(ctx, "SELECT "+placementColumns+" FROM sensor_placements "+
+		"WHERE attached_at <= ? AND (detached_at IS NULL OR detached_at > ?)", at, at)
+}
+
+func (r *MySQLPlantationRepository) queryPlacements(ctx context.Context, query string, args ...interface{}) ([]SensorPlacement, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询安装记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	placements := make([]SensorPlacement, 0)
+	for rows.Next() {
+		placement, err := scanPlacement(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取安装记录失败: %v", err)
+		}
+		placements = append(placements, placement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取安装记录失败: %v", err)
+	}
+	return placements, nil
+}
+
+// SetDeviceLocation 记录设备登记坐标
+func (r *MySQLPlantationRepository) SetDeviceLocation(ctx context.Context, location DeviceLocation) (DeviceLocation, error) {
+	location.UpdatedAt = time.Now().Truncate(time.Millisecond)
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO device_locations ("+locationColumns+") VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE latitude = VALUES(latitude), longitude = VALUES(longitude), updated_at = VALUES(updated_at)",
+		location.DeviceID, location.Latitude, location.Longitude, location.UpdatedAt)
+	if err != nil {
+		return DeviceLocation{}, fmt.Errorf("保存设备坐标失败: %v", err)
+	}
+	return location, nil
+}
+
+// ListDeviceLocations 列出所有设备的登记坐标
+func (r *MySQLPlantationRepository) ListDeviceLocations(ctx context.Context) ([]DeviceLocation, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+locationColumns+" FROM device_locations ORDER BY device_id")
+	if err != nil {
+		return nil, fmt.Errorf("查询设备坐标失败: %v", err)
+	}
+	defer rows.Close()
+
+	locations := make([]DeviceLocation, 0)
+	for rows.Next() {
+		var location DeviceLocation
+		if err := rows.Scan(&location.DeviceID, &location.Latitude, &location.Longitude, &location.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("读取设备坐标失败: %v", err)
+		}
+		locations = append(locations, location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取设备坐标失败: %v", err)
+	}
+	return locations, nil
+}
+
+// CreateTreatment 为树木添加处理记录
+func (r *MySQLPlantationRepository) CreateTreatment(ctx context.Context, treatment Treatment) (Treatment, error) {
+	if _, err := r.GetTree(ctx, treatment.TreeID); err != nil {
+		return Treatment{}, err
+	}
+
+	treatment.ID = generateID("treatment")
+	treatment.TreatedAt = treatment.TreatedAt.Truncate(time.Millisecond)
+	treatment.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO treatments ("+treatmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		treatment.ID, treatment.TreeID, treatment.TreatedAt, treatment.Method, treatment.Chemical, treatment.Dosage,
+		treatment.Operator, treatment.Notes, treatment.CreatedAt)
+	if err != nil {
+		return Treatment{}, fmt.Errorf("保存处理记录失败: %v", err)
+	}
+	return treatment, nil
+}
+
+// ListTreatments 列出树木的处理记录
+func (r *MySQLPlantationRepository) ListTreatments(ctx context.Context, treeID string) ([]Treatment, error) {
+	if _, err := r.GetTree(ctx, treeID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+treatmentColumns+" FROM treatments WHERE tree_id = ? ORDER BY treated_at, id", treeID)
+	if err != nil {
+		return nil, fmt.Errorf("查询处理记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	treatments := make([]Treatment, 0)
+	for rows.Next() {
+		var treatment Treatment
+		err := rows.Scan(&treatment.ID, &treatment.TreeID, &treatment.TreatedAt, &treatment.Method, &treatment.Chemical,
+			&treatment.Dosage, &treatment.Operator, &treatment.Notes, &treatment.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("读取处理记录失败: %v", err)
+		}
+		treatments = append(treatments, treatment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取处理记录失败: %v", err)
+	}
+	return treatments, nil
+}
+
+func scanFarm(row rowScanner) (Farm, error) {
+	var farm Farm
+	err := row.Scan(&farm.ID, &farm.Name, &farm.Owner, &farm.Latitude, &farm.Longitude, &farm.Description,
+		&farm.CreatedAt, &farm.UpdatedAt)
+	return farm, err
+}
+
+func scanBlock(row rowScanner) (Block, error) {
+	var block Block
+	err := row.Scan(&block.ID, &block.FarmID, &block.Name, &block.Latitude, &block.Longitude, &block.Description,
+		&block.CreatedAt, &block.UpdatedAt)
+	return block, err
+}
+
+func scanTree(row rowScanner) (Tree, error) {
+	var tree Tree
+	err := row.Scan(&tree.ID, &tree.FarmID, &tree.BlockID, &tree.Code, &tree.Species, &tree.PlantedYear,
+		&tree.Latitude, &tree.Longitude, &tree.CreatedAt, &tree.UpdatedAt)
+	return tree, err
+}
+
+func scanPlacement(row rowScanner) (SensorPlacement, error) {
+	var placement SensorPlacement
+	var detachedAt sql.NullTime
+	err := row.Scan(&placement.ID, &placement.DeviceID, &placement.TreeID, &placement.AttachedAt, &detachedAt, &placement.Notes)
+	if err != nil {
+		return SensorPlacement{}, err
+	}
+	if detachedAt.Valid {
+		placement.DetachedAt = &detachedAt.Time
+	}
+	return placement, nil
+}
@@ -0,0 +1,233 @@
+package httpserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPlantationRepositoryPlacements(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryPlantationRepository()
+	farm, _ := repo.CreateFarm(ctx, Farm{Name: "农场"})
+	block, _ := repo.CreateBlock(ctx, Block{FarmID: farm.ID, Name: "A1"})
+	treeA, _ := repo.CreateTree(ctx, Tree{BlockID: block.ID, Code: "P-001"})
+	treeB, _ := repo.CreateTree(ctx, Tree{BlockID: block.ID, Code: "P-002"})
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := repo.AttachSensor(ctx, "dev_001", "tree_missing", t0, "")
+	assert.Equal(t, ErrTreeNotFound, err)
+
+	first, err := repo.AttachSensor(ctx, "dev_001", treeA.ID, t0, "")
+	assert.NoError(t, err)
+	_, err = repo.AttachSensor(ctx, "dev_001", treeB.ID, t0.Add(time.Hour), "")
+	assert.NoError(t, err)
+	_, err = repo.AttachSensor(ctx, "dev_001", treeA.ID, t0.Add(time.Minute), "")
+	assert.Equal(t, ErrPlacementOverlap, err)
+
+	// 移动时自动结束旧记录，只允许提前结束时间
+	_, err = repo.DetachSensor(ctx, first.ID, t0.Add(-time.Minute))
+	assert.Equal(t, ErrInvalidTimeRange, err)
+	detached, err := repo.DetachSensor(ctx, first.ID, t0.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, t0.Add(time.Hour), *detached.DetachedAt)
+
+	placement, err := repo.PlacementAt(ctx, "dev_001", t0.Add(30*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, treeA.ID, placement.TreeID)
+	active, err := repo.ActivePlacements(ctx, t0.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+	assert.Equal(t, treeB.ID, active[0].TreeID)
+}
+
+// ==================== MySQL实现 ====================
+
+func newMockPlantationRepository(t *testing.T) (*MySQLPlantationRepository, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("创建sqlmock失败: %v", err)
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		conn.Close()
+	})
+	return NewMySQLPlantationRepository(conn), mock
+}
+
+// 按查询列的顺序生成结果列名
+func columnNames(columns string) []string {
+	return strings.Split(strings.ReplaceAll(columns, " ", ""), ",")
+}
+
+func treeRows(trees ...Tree) *sqlmock.Rows {
+	rows := sqlmock.NewRows(columnNames(treeColumns))
+	for _, tree := range trees {
+		rows.AddRow(tree.ID, tree.FarmID, tree.BlockID, tree.Code, tree.Species, tree.PlantedYear,
+			tree.Latitude, tree.Longitude, tree.CreatedAt, tree.UpdatedAt)
+	}
+	return rows
+}
+
+func placementRows(placements ...SensorPlacement) *sqlmock.Rows {
+	rows := sqlmock.NewRows(columnNames(placementColumns))
+	for _, placement := range placements {
+		var detachedAt interface{}
+		if placement.DetachedAt != nil {
+			detachedAt = *placement.DetachedAt
+		}
+		rows.AddRow(placement.ID, placement.DeviceID, placement.TreeID, placement.AttachedAt, detachedAt, placement.Notes)
+	}
+	return rows
+}
+
+const (
+	selectTreeByID          = "SELECT " + treeColumns + " FROM trees WHERE id = ?"
+	selectLastPlacement     = "SELECT " + placementColumns + " FROM sensor_placements WHERE device_id = ? ORDER BY attached_at DESC LIMIT 1 FOR UPDATE"
+	updatePlacementDetached = "UPDATE sensor_placements SET detached_at = ? WHERE id = ?"
+	insertPlacement         = "INSERT INTO sensor_placements (" + placementColumns + ") VALUES (?, ?, ?, ?, ?, ?)"
+)
+
+func TestMySQLPlantationRepositoryMigrate(t *testing.T) {
+	repo, mock := newMockPlantationRepository(t)
+	for _, schema := range plantationSchemas {
+		mock.ExpectExec(schema).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	assert.NoError(t, repo.Migrate(context.Background()))
+}
+
+func TestMySQLPlantationRepositoryTrees(t *testing.T) {
+	repo, mock := newMockPlantationRepository(t)
+	ctx := context.Background()
+	created := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	tree := Tree{ID: "tree_a", FarmID: "farm_a", BlockID: "block_a", Code: "P-001", Latitude: 24, Longitude: 45,
+		CreatedAt: created, UpdatedAt: created}
+
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_a").WillReturnRows(treeRows(tree))
+	got, err := repo.GetTree(ctx, "tree_a")
+	assert.NoError(t, err)
+	assert.Equal(t, tree, got)
+
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_missing").WillReturnRows(treeRows())
+	_, err = repo.GetTree(ctx, "tree_missing")
+	assert.Equal(t, ErrTreeNotFound, err)
+
+	// 登记树木时从地块继承农场
+	mock.ExpectQuery("SELECT " + blockColumns + " FROM blocks WHERE id = ?").WithArgs("block_a").
+		WillReturnRows(sqlmock.NewRows(columnNames(blockColumns)).AddRow("block_a", "farm_a", "A1", 24.0, 45.0, "", created, created))
+	mock.ExpectExec("INSERT INTO trees ("+treeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), "farm_a", "block_a", "P-002", "", 0, 24.1, 45.1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	newTree, err := repo.CreateTree(ctx, Tree{BlockID: "block_a", Code: "P-002", Latitude: 24.1, Longitude: 45.1})
+	assert.NoError(t, err)
+	assert.Equal(t, "farm_a", newTree.FarmID)
+	assert.True(t, strings.HasPrefix(newTree.ID, "tree_"))
+}
+
+func TestMySQLPlantationRepositoryAttachSensor(t *testing.T) {
+	repo, mock := newMockPlantationRepository(t)
+	ctx := context.Background()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	moved := t0.Add(time.Hour)
+	tree := Tree{ID: "tree_b", FarmID: "farm_a", BlockID: "block_a", Code: "P-002", CreatedAt: t0, UpdatedAt: t0}
+	open := SensorPlacement{ID: "placement_a", DeviceID: "dev_001", TreeID: "tree_a", AttachedAt: t0}
+
+	// 在事务中结束旧记录并追加新记录
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_b").WillReturnRows(treeRows(tree))
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectLastPlacement).WithArgs("dev_001").WillReturnRows(placementRows(open))
+	mock.ExpectExec(updatePlacementDetached).WithArgs(moved, "placement_a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertPlacement).WithArgs(sqlmock.AnyArg(), "dev_001", "tree_b", moved, nil, "移动").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	placement, err := repo.AttachSensor(ctx, "dev_001", "tree_b", moved.Add(300*time.Microsecond), "移动")
+	assert.NoError(t, err)
+	assert.Equal(t, moved, placement.AttachedAt)
+
+	// 安装时间早于最后一条记录时回滚
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_b").WillReturnRows(treeRows(tree))
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectLastPlacement).WithArgs("dev_001").WillReturnRows(placementRows(open))
+	mock.ExpectRollback()
+	_, err = repo.AttachSensor(ctx, "dev_001", "tree_b", t0, "")
+	assert.Equal(t, ErrPlacementOverlap, err)
+}
+
+func TestMySQLPlantationRepositoryPlacementAt(t *testing.T) {
+	repo, mock := newMockPlantationRepository(t)
+	ctx := context.Background()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	detached := t0.Add(time.Hour)
+	at := t0.Add(30 * time.Minute)
+	query := "SELECT " + placementColumns + " FROM sensor_placements " +
+		"WHERE device_id = ? AND attached_at <= ? AND (detached_at IS NULL OR detached_at > ?) ORDER BY attached_at DESC LIMIT 1"
+
+	mock.ExpectQuery(query).WithArgs("dev_001", at, at).
+		WillReturnRows(placementRows(SensorPlacement{ID: "placement_a", DeviceID: "dev_001", TreeID: "tree_a", AttachedAt: t0, DetachedAt: &detached}))
+	placement, err := repo.PlacementAt(ctx, "dev_001", at)
+	assert.NoError(t, err)
+	assert.Equal(t, "tree_a", placement.TreeID)
+	assert.Equal(t, detached, *placement.DetachedAt)
+
+	mock.ExpectQuery(query).WithArgs("dev_002", at, at).WillReturnRows(placementRows())
+	_, err = repo.PlacementAt(ctx, "dev_002", at)
+	assert.Equal(t, ErrPlacementNotFound, err)
+}
+
+func TestMySQLPlantationRepositoryDeviceLocations(t *testing.T) {
+	repo, mock := newMockPlantationRepository(t)
+	ctx := context.Background()
+	updated := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	// 重复登记时覆盖原坐标
+	mock.ExpectExec("INSERT INTO device_locations ("+locationColumns+") VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE latitude = VALUES(latitude), longitude = VALUES(longitude), updated_at = VALUES(updated_at)").
+		WithArgs("dev_001", 24.1, 45.2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	location, err := repo.SetDeviceLocation(ctx, DeviceLocation{DeviceID: "dev_001", Latitude: 24.1, Longitude: 45.2})
+	assert.NoError(t, err)
+	assert.Equal(t, location.UpdatedAt, location.UpdatedAt.Truncate(time.Millisecond))
+
+	mock.ExpectQuery("SELECT " + locationColumns + " FROM device_locations ORDER BY device_id").
+		WillReturnRows(sqlmock.NewRows(columnNames(locationColumns)).AddRow("dev_001", 24.1, 45.2, updated))
+	locations, err := repo.ListDeviceLocations(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []DeviceLocation{{DeviceID: "dev_001", Latitude: 24.1, Longitude: 45.2, UpdatedAt: updated}}, locations)
+}
+
+func TestMySQLPlantationRepositoryTreatments(t *testing.T) {
+	repo, mock := newMockPlantationRepository(t)
+	ctx := context.Background()
+	created := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	treatedAt := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	tree := Tree{ID: "tree_a", FarmID: "farm_a", BlockID: "block_a", Code: "P-001", CreatedAt: created, UpdatedAt: created}
+
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_a").WillReturnRows(treeRows(tree))
+	mock.ExpectExec("INSERT INTO treatments ("+treatmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), "tree_a", treatedAt, "injection", "吡虫啉", "", "张三", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	treatment, err := repo.CreateTreatment(ctx, Treatment{TreeID: "tree_a", TreatedAt: treatedAt.Add(300 * time.Microsecond),
+		Method: "injection", Chemical: "吡虫啉", Operator: "张三"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(treatment.ID, "treatment_"))
+	assert.Equal(t, treatedAt, treatment.TreatedAt)
+
+	// 树木不存在时不写入
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_missing").WillReturnRows(treeRows())
+	_, err = repo.CreateTreatment(ctx, Treatment{TreeID: "tree_missing", Method: "removal"})
+	assert.Equal(t, ErrTreeNotFound, err)
+
+	mock.ExpectQuery(selectTreeByID).WithArgs("tree_a").WillReturnRows(treeRows(tree))
+	mock.ExpectQuery("SELECT " + treatmentColumns + " FROM treatments WHERE tree_id = ? ORDER BY treated_at, id").
+		WithArgs("tree_a").
+		WillReturnRows(sqlmock.NewRows(columnNames(treatmentColumns)).
+			AddRow(treatment.ID, "tree_a", treatedAt, "injection", "吡虫啉", "", "张三", "", created))
+	treatments, err := repo.ListTreatments(ctx, "tree_a")
+	assert.NoError(t, err)
+	assert.Len(t, treatments, 1)
+	assert.Equal(t, "injection", treatments[0].Method)
+}
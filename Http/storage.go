@@ -1,9 +1,19 @@
 package httpserver
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,6 +21,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/google/uuid"
 )
 
@@ -21,6 +32,9 @@ type StorageService interface {
 	// 生成预签名上传URL
 	GeneratePresignedUploadURL(params PresignedURLParams) (string, error)
 
+	// 生成预签名下载URL
+	GeneratePresignedDownloadURL(bucket, key string, expires time.Duration) (string, error)
+
 	// 检查文件是否存在
 	FileExists(bucket, key string) (bool, error)
 
@@ -29,6 +43,42 @@ type StorageService interface {
 
 	// 删除文件
 	DeleteFile(bucket, key string) error
+
+	// 上传对象 (流式写入，不要求预先知道大小)
+	PutObject(bucket, key string, body io.Reader, contentType string, metadata map[string]string) error
+
+	// 读取对象内容，调用方负责关闭
+	GetObject(bucket, key string) (io.ReadCloser, error)
+
+	// 读取对象从offset开始的length字节，调用方负责关闭
+	GetObjectRange(bucket, key string, offset, length int64) (io.ReadCloser, error)
+
+	// 按前缀遍历对象 (不含Content-Type和元数据)，fn返回false时停止
+	ListFiles(bucket, prefix string, fn func(info FileInfo) bool) error
+}
+
+// MultipartStorage 支持分片上传的存储服务 (S3/MinIO)，不是所有存储服务都实现
+type MultipartStorage interface {
+	// 创建分片上传，返回uploadID
+	CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string) (string, error)
+
+	// 生成分片的预签名PUT URL
+	GeneratePresignedPartURL(bucket, key, uploadID string, partNumber int, expires time.Duration) (string, error)
+
+	// 列出已上传的分片 (按序号排序)
+	ListParts(bucket, key, uploadID string) ([]UploadedPart, error)
+
+	// 合并分片，返回对象ETag
+	CompleteMultipartUpload(bucket, key, uploadID string, parts []UploadedPart) (string, error)
+
+	// 取消分片上传并释放已上传的分片
+	AbortMultipartUpload(bucket, key, uploadID string) error
+}
+
+// PostPolicyStorage 支持预签名POST表单上传的存储服务
+// 与预签名PUT不同，POST策略由存储服务强制校验文件大小、Content-Type和对象键
+type PostPolicyStorage interface {
+	GeneratePresignedPost(params PresignedURLParams) (*PresignedPost, error)
 }
 
 // FileInfo 文件信息
@@ -41,11 +91,31 @@ type FileInfo struct {
 	Metadata     map[string]string `json:"metadata"`
 }
 
+// NewStorageService 根据配置的Provider创建存储服务
+func NewStorageService(config *ObjectStorageConfig) (StorageService, error) {
+	switch config.Provider {
+	case "minio", "s3":
+		service, err := NewMinIOStorageService(config)
+		if err != nil {
+			return nil, err
+		}
+		return service, nil
+	case "local":
+		service, err := NewLocalStorageService(config)
+		if err != nil {
+			return nil, err
+		}
+		return service, nil
+	}
+	return nil, fmt.Errorf("不支持的存储提供商: %s", config.Provider)
+}
+
 // MinIOStorageService MinIO存储服务实现
 type MinIOStorageService struct {
 	config    *ObjectStorageConfig
 	s3Client  *s3.S3
 	s3Session *session.Session
+	uploader  *s3manager.Uploader
 }
 
 // NewMinIOStorageService 创建MinIO存储服务
@@ -80,6 +150,7 @@ func NewMinIOStorageService(config *ObjectStorageConfig) (*MinIOStorageService,
 		config:    config,
 		s3Client:  s3Client,
 		s3Session: sess,
+		uploader:  s3manager.NewUploaderWithClient(s3Client),
 	}, nil
 }
 
@@ -107,6 +178,26 @@ func (s *MinIOStorageService) GeneratePresignedUploadURL(params PresignedURLPara
 	return url, nil
 }
 
+// GeneratePresignedDownloadURL 生成预签名下载URL
+func (s *MinIOStorageService) GeneratePresignedDownloadURL(bucket, key string, expires time.Duration) (string, error) {
+	// 设置默认值
+	if expires == 0 {
+		expires = time.Duration(s.config.ExpireHours) * time.Hour
+	}
+
+	req, _ := s.s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	url, err := req.Presign(expires)
+	if err != nil {
+		return "", fmt.Errorf("生成预签名下载URL失败: %v", err)
+	}
+
+	return url, nil
+}
+
 // FileExists 检查文件是否存在
 func (s *MinIOStorageService) FileExists(bucket, key string) (bool, error) {
 	_, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
@@ -116,7 +207,7 @@ func (s *MinIOStorageService) FileExists(bucket, key string) (bool, error) {
 
 	if err != nil {
 		// 检查是否是"文件不存在"错误
-		if strings.Contains(err.Error(), "NotFound") {
+		if IsObjectNotFound(err) {
 			return false, nil
 		}
 		return false, err
@@ -125,6 +216,19 @@ func (s *MinIOStorageService) FileExists(bucket, key string) (bool, error) {
 	return true, nil
 }
 
+// IsObjectNotFound 判断存储服务返回的错误是否表示对象不存在
+// S3的HEAD请求返回NotFound，GET请求返回NoSuchKey；本地存储返回fs.ErrNotExist
+func IsObjectNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "NotFound") || strings.Contains(message, "NoSuchKey")
+}
+
 // GetFileInfo 获取文件信息
 func (s *MinIOStorageService) GetFileInfo(bucket, key string) (*FileInfo, error) {
 	result, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
@@ -158,6 +262,255 @@ func (s *MinIOStorageService) DeleteFile(bucket, key string) error {
 	return err
 }
 
+// PutObject 上传对象
+func (s *MinIOStorageService) PutObject(bucket, key string, body io.Reader, contentType string, metadata map[string]string) error {
+	_, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		Metadata:    aws.StringMap(metadata),
+	})
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %v", err)
+	}
+
+	return nil
+}
+
+// GetObject 读取对象内容
+func (s *MinIOStorageService) GetObject(bucket, key string) (io.ReadCloser, error) {
+	result, err := s.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body, nil
+}
+
+// GetObjectRange 按Range读取对象的一段内容
+func (s *MinIOStorageService) GetObjectRange(bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	result, err := s.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body, nil
+}
+
+// ListFiles 按前缀分页遍历对象
+func (s *MinIOStorageService) ListFiles(bucket, prefix string, fn func(info FileInfo) bool) error {
+	err := s.s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			info := FileInfo{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				ETag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+				LastModified: aws.TimeValue(object.LastModified),
+			}
+			if !fn(info) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("列出对象失败: %v", err)
+	}
+
+	return nil
+}
+
+// CreateMultipartUpload 创建分片上传
+func (s *MinIOStorageService) CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string) (string, error) {
+	result, err := s.s3Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Metadata:    aws.StringMap(metadata),
+	})
+	if err != nil {
+		return "", fmt.Errorf("创建分片上传失败: %v", err)
+	}
+
+	return aws.StringValue(result.UploadId), nil
+}
+
+// GeneratePresignedPartURL 生成分片预签名上传URL
+func (s *MinIOStorageService) GeneratePresignedPartURL(bucket, key, uploadID string, partNumber int, expires time.Duration) (string, error) {
+	if expires == 0 {
+		expires = time.Duration(s.config.ExpireHours) * time.Hour
+	}
+
+	req, _ := s.s3Client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(int64(partNumber)),
+	})
+
+	url, err := req.Presign(expires)
+	if err != nil {
+		return "", fmt.Errorf("生成分片预签名URL失败: %v", err)
+	}
+
+	return url, nil
+}
+
+// ListParts 列出已上传的分片
+func (s *MinIOStorageService) ListParts(bucket, key, uploadID string) ([]UploadedPart, error) {
+	parts := make([]UploadedPart, 0)
+	err := s.s3Client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber:   int(aws.Int64Value(part.PartNumber)),
+				ETag:         strings.Trim(aws.StringValue(part.ETag), `"`),
+				Size:         aws.Int64Value(part.Size),
+				LastModified: aws.TimeValue(part.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出分片失败: %v", err)
+	}
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片
+func (s *MinIOStorageService) CompleteMultipartUpload(bucket, key, uploadID string, parts []UploadedPart) (string, error) {
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(`"` + strings.Trim(part.ETag, `"`) + `"`),
+			PartNumber: aws.Int64(int64(part.PartNumber)),
+		})
+	}
+
+	result, err := s.s3Client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return "", fmt.Errorf("合并分片失败: %v", err)
+	}
+
+	return strings.Trim(aws.StringValue(result.ETag), `"`), nil
+}
+
+// AbortMultipartUpload 取消分片上传
+func (s *MinIOStorageService) AbortMultipartUpload(bucket, key, uploadID string) error {
+	_, err := s.s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("取消分片上传失败: %v", err)
+	}
+
+	return nil
+}
+
+// GeneratePresignedPost 生成带策略的预签名POST表单 (AWS Signature V4)
+func (s *MinIOStorageService) GeneratePresignedPost(params PresignedURLParams) (*PresignedPost, error) {
+	if params.Expires == 0 {
+		params.Expires = time.Duration(s.config.ExpireHours) * time.Hour
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	credential := s.config.AccessKey + "/" + date + "/" + s.config.Region + "/s3/aws4_request"
+
+	fields := map[string]string{
+		"key":              params.Key,
+		"Content-Type":     params.ContentType,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	for name, value := range params.Metadata {
+		fields["x-amz-meta-"+name] = value
+	}
+
+	// 除文件大小外，每个表单字段都必须与策略完全一致
+	conditions := []interface{}{
+		map[string]string{"bucket": params.Bucket},
+		[]interface{}{"content-length-range", params.MinSize, params.MaxSize},
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conditions = append(conditions, []interface{}{"eq", "$" + name, fields[name]})
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(params.Expires).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成POST策略失败: %v", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(policy)
+	fields["policy"] = encoded
+	// POST策略的待签名字符串就是base64编码后的策略本身
+	fields["x-amz-signature"] = signatureV4(s.config.SecretKey, date, s.config.Region, "s3", encoded)
+
+	scheme := "http://"
+	if s.config.UseSSL {
+		scheme = "https://"
+	}
+
+	return &PresignedPost{
+		URL:    scheme + s.config.Endpoint + "/" + params.Bucket,
+		Fields: fields,
+	}, nil
+}
+
+// 用Signature V4签名密钥对待签名字符串签名，返回十六进制签名
+func signatureV4(secretKey, date, region, service, stringToSign string) string {
+	return hex.EncodeToString(hmacSHA256(signatureV4Key(secretKey, date, region, service), stringToSign))
+}
+
+// 派生Signature V4签名密钥，date为YYYYMMDD格式
+func signatureV4Key(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
 // ==================== 工具函数 ====================
 
 // GenerateJobID 生成任务ID
@@ -165,6 +518,11 @@ func GenerateJobID() string {
 	return fmt.Sprintf("job_%s", uuid.New().String()[:8])
 }
 
+// generateID 生成带前缀的实体ID
+func generateID(prefix string) string {
+	return fmt.Sprintf("%s_%s", prefix, uuid.New().String()[:8])
+}
+
 // GenerateStorageKey 生成存储键
 func GenerateStorageKey(deviceID, fileName string) string {
 	// 生成时间戳
@@ -179,6 +537,16 @@ func GenerateStorageKey(deviceID, fileName string) string {
 	return fmt.Sprintf("%s/%s/%s", deviceID, timestamp, uniqueName)
 }
 
+// 派生前缀中源键与派生对象名之间的标记
+const derivedKeyMarker = ".derived/"
+
+// GenerateDerivedStorageKey 生成派生对象存储键
+// 派生对象(音频片段、缩略图等)放在源对象旁边的 <源键去扩展名>.derived/ 前缀下
+func GenerateDerivedStorageKey(sourceKey, name string) string {
+	ext := filepath.Ext(sourceKey)
+	return strings.TrimSuffix(sourceKey, ext) + derivedKeyMarker + name
+}
+
 // ValidateFileType 验证文件类型
 func ValidateFileType(fileType string) bool {
 	allowedTypes := []string{"wav", "mp3", "flac", "m4a", "aac"}
@@ -192,6 +560,19 @@ func ValidateFileType(fileType string) bool {
 	return false
 }
 
+// ValidateImageType 验证图片类型 (巡检照片、安装照片等附件)
+func ValidateImageType(fileType string) bool {
+	allowedTypes := []string{"jpg", "jpeg", "png"}
+
+	for _, allowed := range allowedTypes {
+		if strings.ToLower(fileType) == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ValidateFileSize 验证文件大小
 func ValidateFileSize(fileSize int64, maxSize int64) bool {
 	if maxSize <= 0 {
@@ -216,6 +597,10 @@ func GetContentType(fileName string) string {
 		return "audio/mp4"
 	case ".aac":
 		return "audio/aac"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
 	default:
 		return "application/octet-stream"
 	}
@@ -234,6 +619,7 @@ func DefaultObjectStorageConfig() *ObjectStorageConfig {
 		Region:      "us-east-1",
 		UseSSL:      false,
 		ExpireHours: 24,
+		LocalRoot:   "./data/storage",
 	}
 }
 
@@ -241,11 +627,18 @@ func DefaultObjectStorageConfig() *ObjectStorageConfig {
 func LoadObjectStorageConfig() *ObjectStorageConfig {
 	config := DefaultObjectStorageConfig()
 
-	// TODO: 从环境变量加载配置
-	// config.Endpoint = os.Getenv("STORAGE_ENDPOINT")
-	// config.AccessKey = os.Getenv("STORAGE_ACCESS_KEY")
-	// config.SecretKey = os.Getenv("STORAGE_SECRET_KEY")
+	// TODO: 存储桶目前固定为defaultBucket
 	// config.Bucket = os.Getenv("STORAGE_BUCKET")
+	config.Provider = getEnv("STORAGE_PROVIDER", config.Provider)
+	config.Endpoint = getEnv("STORAGE_ENDPOINT", config.Endpoint)
+	config.AccessKey = getEnv("STORAGE_ACCESS_KEY", config.AccessKey)
+	config.SecretKey = getEnv("STORAGE_SECRET_KEY", config.SecretKey)
+	config.Region = getEnv("STORAGE_REGION", config.Region)
+	config.UseSSL = getEnv("STORAGE_USE_SSL", "false") == "true"
+	config.EventSecret = os.Getenv("STORAGE_EVENT_SECRET")
+	config.LocalRoot = getEnv("STORAGE_LOCAL_ROOT", config.LocalRoot)
+	config.PublicURL = getEnv("STORAGE_PUBLIC_URL", config.PublicURL)
+	config.SigningKey = os.Getenv("STORAGE_SIGNING_KEY")
 
 	return config
 }
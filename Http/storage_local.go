@@ -0,0 +1,509 @@
+package httpserver
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 本地文件系统存储服务 ====================
+// 单机部署和测试使用，对象保存在本地目录，预签名URL由本服务签发并处理
+
+// 本地存储的对象读写路由前缀
+const localStorageRoute = "/api/v1/storage/local/"
+
+// LocalStorageService 本地文件系统存储服务实现
+// 目录结构: <root>/<bucket>/<key> 为对象内容，<root>/.meta/<bucket>/<key>.json 为Content-Type、ETag和元数据
+type LocalStorageService struct {
+	config     *ObjectStorageConfig
+	root       string
+	publicURL  string // 本服务对外地址，用于生成预签名URL
+	signingKey []byte
+}
+
+// 对象的附加信息
+type localObjectMeta struct {
+	ContentType string            `json:"content_type"`
+	ETag        string            `json:"etag"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// NewLocalStorageService 创建本地存储服务
+// 预签名URL指向本服务并由本服务验签，因此必须配置对外地址和签名密钥
+func NewLocalStorageService(config *ObjectStorageConfig) (*LocalStorageService, error) {
+	if config.LocalRoot == "" {
+		return nil, fmt.Errorf("未配置本地存储目录")
+	}
+	if config.SigningKey == "" {
+		// 随机密钥在重启后会使已签发的URL全部失效，多实例之间也无法互相验签
+		return nil, fmt.Errorf("本地存储必须配置STORAGE_SIGNING_KEY")
+	}
+	publicURL, err := url.Parse(config.PublicURL)
+	if config.PublicURL == "" || err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+		return nil, fmt.Errorf("本地存储必须配置STORAGE_PUBLIC_URL为设备可访问的http(s)地址")
+	}
+
+	root, err := filepath.Abs(config.LocalRoot)
+	if err != nil {
+		return nil, fmt.Errorf("本地存储目录无效: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, ".tmp"), 0o755); err != nil {
+		return nil, fmt.Errorf("创建本地存储目录失败: %v", err)
+	}
+
+	log.Printf("本地存储服务初始化成功: %s", root)
+
+	return &LocalStorageService{
+		config:     config,
+		root:       root,
+		publicURL:  strings.TrimSuffix(config.PublicURL, "/"),
+		signingKey: []byte(config.SigningKey),
+	}, nil
+}
+
+// GeneratePresignedUploadURL 生成由本服务处理的预签名PUT URL，Content-Type、最大大小和元数据写入签名
+func (s *LocalStorageService) GeneratePresignedUploadURL(params PresignedURLParams) (string, error) {
+	if _, err := s.objectPath(params.Bucket, params.Key); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	if params.ContentType != "" {
+		query.Set("content_type", params.ContentType)
+	}
+	if params.MaxSize > 0 {
+		query.Set("max_size", strconv.FormatInt(params.MaxSize, 10))
+	}
+	for name, value := range params.Metadata {
+		query.Set("meta-"+name, value)
+	}
+	return s.signURL(http.MethodPut, params.Bucket, params.Key, params.Expires, query), nil
+}
+
+// GeneratePresignedDownloadURL 生成由本服务处理的预签名GET URL
+func (s *LocalStorageService) GeneratePresignedDownloadURL(bucket, key string, expires time.Duration) (string, error) {
+	if _, err := s.objectPath(bucket, key); err != nil {
+		return "", err
+	}
+	return s.signURL(http.MethodGet, bucket, key, expires, url.Values{}), nil
+}
+
+// FileExists 检查文件是否存在
+func (s *LocalStorageService) FileExists(bucket, key string) (bool, error) {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// GetFileInfo 获取文件信息
+func (s *LocalStorageService) GetFileInfo(bucket, key string) (*FileInfo, error) {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("对象不存在: %s: %w", key, fs.ErrNotExist)
+	}
+
+	meta := localObjectMeta{ContentType: "application/octet-stream"}
+	if data, err := os.ReadFile(s.metaPath(bucket, key)); err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("读取对象元数据失败: %v", err)
+		}
+	}
+
+	return &FileInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ETag:         meta.ETag,
+		ContentType:  meta.ContentType,
+		LastModified: stat.ModTime(),
+		Metadata:     meta.Metadata,
+	}, nil
+}
+
+// DeleteFile 删除文件，文件不存在时不报错 (与S3一致)
+func (s *LocalStorageService) DeleteFile(bucket, key string) error {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{objectPath, s.metaPath(bucket, key)} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("删除对象失败: %v", err)
+		}
+	}
+
+	// 清理空目录，避免tus分片等临时对象留下大量空目录
+	s.removeEmptyDirs(filepath.Dir(objectPath), filepath.Join(s.root, bucket))
+	s.removeEmptyDirs(filepath.Dir(s.metaPath(bucket, key)), filepath.Join(s.root, ".meta", bucket))
+	return nil
+}
+
+// PutObject 流式写入临时文件后重命名，读取失败时不会留下不完整的对象
+// 先替换对象内容再替换元数据，元数据同样经临时文件重命名写入，读取方不会看到半个JSON
+func (s *LocalStorageService) PutObject(bucket, key string, body io.Reader, contentType string, metadata map[string]string) error {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.root, ".tmp"), "upload-*")
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	_, err = io.Copy(tmp, io.TeeReader(body, hash))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %v", err)
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	meta, err := json.Marshal(localObjectMeta{
+		ContentType: contentType,
+		ETag:        hex.EncodeToString(hash.Sum(nil)),
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %v", err)
+	}
+
+	metaPath := s.metaPath(bucket, key)
+	for _, dir := range []string{filepath.Dir(objectPath), filepath.Dir(metaPath)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("上传对象失败: %v", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return fmt.Errorf("上传对象失败: %v", err)
+	}
+	if err := s.writeFileAtomic(metaPath, meta); err != nil {
+		return fmt.Errorf("写入对象元数据失败: %v", err)
+	}
+
+	return nil
+}
+
+// 写入临时文件后重命名为目标文件
+func (s *LocalStorageService) writeFileAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, ".tmp"), "meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// GetObject 读取对象内容
+func (s *LocalStorageService) GetObject(bucket, key string) (io.ReadCloser, error) {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(objectPath)
+}
+
+// GetObjectRange 定位到offset后读取length字节
+func (s *LocalStorageService) GetObjectRange(bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// ListFiles 按前缀遍历对象
+func (s *LocalStorageService) ListFiles(bucket, prefix string, fn func(info FileInfo) bool) error {
+	bucketDir, err := s.bucketPath(bucket)
+	if err != nil {
+		return err
+	}
+
+	// 从前缀所在的目录开始遍历，避免扫描整个存储桶
+	start := bucketDir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = filepath.Join(bucketDir, filepath.FromSlash(prefix[:i]))
+	}
+
+	errStop := errors.New("stop")
+	err = filepath.WalkDir(start, func(file string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(bucketDir, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !fn(FileInfo{Key: key, Size: stat.Size(), LastModified: stat.ModTime()}) {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return fmt.Errorf("列出对象失败: %v", err)
+	}
+
+	return nil
+}
+
+// ==================== 本地存储签名URL ====================
+
+// 生成签名URL，签名覆盖方法、存储桶、对象键和全部查询参数
+func (s *LocalStorageService) signURL(method, bucket, key string, expires time.Duration, query url.Values) string {
+	if expires == 0 {
+		expires = time.Duration(s.config.ExpireHours) * time.Hour
+	}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(expires).Unix(), 10))
+	query.Set("signature", s.signature(method, bucket, key, query))
+
+	objectURL := url.URL{Path: localStorageRoute + bucket + "/" + key}
+	return s.publicURL + objectURL.EscapedPath() + "?" + query.Encode()
+}
+
+// 校验签名URL的签名和有效期
+func (s *LocalStorageService) verifySignedRequest(method, bucket, key string, query url.Values) error {
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(signature, s.signatureBytes(method, bucket, key, query)) {
+		return AppError{Code: http.StatusForbidden, Message: "签名无效"}
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return AppError{Code: http.StatusForbidden, Message: "链接已过期"}
+	}
+	return nil
+}
+
+func (s *LocalStorageService) signature(method, bucket, key string, query url.Values) string {
+	return hex.EncodeToString(s.signatureBytes(method, bucket, key, query))
+}
+
+func (s *LocalStorageService) signatureBytes(method, bucket, key string, query url.Values) []byte {
+	signed := url.Values{}
+	for name, values := range query {
+		if name != "signature" {
+			signed[name] = values
+		}
+	}
+	return hmacSHA256(s.signingKey, method+"\n"+bucket+"\n"+key+"\n"+signed.Encode())
+}
+
+// ==================== 本地存储路径 ====================
+
+// 存储桶目录，存储桶名不能包含路径分隔符或以点开头 (.meta、.tmp为保留目录)
+func (s *LocalStorageService) bucketPath(bucket string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || strings.HasPrefix(bucket, ".") {
+		return "", fmt.Errorf("无效的存储桶: %s", bucket)
+	}
+	return filepath.Join(s.root, bucket), nil
+}
+
+// 对象文件路径，拒绝包含..或空路径段的对象键，防止越出存储目录
+func (s *LocalStorageService) objectPath(bucket, key string) (string, error) {
+	bucketDir, err := s.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+	if key == "" || strings.Contains(key, `\`) || path.Clean("/" + key)[1:] != key {
+		return "", fmt.Errorf("无效的对象键: %s", key)
+	}
+	return filepath.Join(bucketDir, filepath.FromSlash(key)), nil
+}
+
+// 对象元数据文件路径 (调用前已通过objectPath校验)
+func (s *LocalStorageService) metaPath(bucket, key string) string {
+	return filepath.Join(s.root, ".meta", bucket, filepath.FromSlash(key)+".json")
+}
+
+// 自下而上删除空目录，直到stop目录 (不含)
+func (s *LocalStorageService) removeEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// ==================== 本地存储处理器 ====================
+
+// LocalStorageUpload 处理本地存储的预签名PUT上传
+// PUT /api/v1/storage/local/:bucket/*key?expires=...&signature=...
+func LocalStorageUpload(c *gin.Context) {
+	storage, bucket, key, err := signedLocalStorageRequest(c, http.MethodPut)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	query := c.Request.URL.Query()
+	contentType := c.ContentType()
+	if signed := query.Get("content_type"); signed != "" {
+		if !sameMediaType(signed, contentType) {
+			errorResponse(c, http.StatusForbidden, "Content-Type与签名不一致")
+			return
+		}
+		contentType = signed
+	}
+
+	metadata := make(map[string]string)
+	for name := range query {
+		if strings.HasPrefix(name, "meta-") {
+			metadata[strings.TrimPrefix(name, "meta-")] = query.Get(name)
+		}
+	}
+
+	// 签名中带有声明的大小时按该大小限制，否则只受全局上限约束
+	limit := int64(maxUploadFileSize)
+	if signed := query.Get("max_size"); signed != "" {
+		maxSize, err := strconv.ParseInt(signed, 10, 64)
+		if err != nil || maxSize <= 0 {
+			errorResponse(c, http.StatusBadRequest, "max_size格式错误")
+			return
+		}
+		limit = min(limit, maxSize)
+	}
+	if c.Request.ContentLength > limit {
+		appErrorResponse(c, ErrFileTooLarge)
+		return
+	}
+
+	body := &limitedUploadReader{r: c.Request.Body, remaining: limit}
+	if err := storage.PutObject(bucket, key, body, contentType, metadata); err != nil {
+		if body.exceeded {
+			appErrorResponse(c, ErrFileTooLarge)
+			return
+		}
+		appErrorResponse(c, AppError{Code: http.StatusInternalServerError, Message: err.Error()})
+		return
+	}
+
+	info, err := storage.GetFileInfo(bucket, key)
+	if err != nil {
+		appErrorResponse(c, AppError{Code: http.StatusInternalServerError, Message: err.Error()})
+		return
+	}
+
+	// 与S3一致，响应头返回带引号的ETag
+	c.Header("ETag", `"`+info.ETag+`"`)
+	c.Status(http.StatusOK)
+}
+
+// LocalStorageDownload 处理本地存储的预签名GET下载，支持Range请求
+// GET /api/v1/storage/local/:bucket/*key?expires=...&signature=...
+func LocalStorageDownload(c *gin.Context) {
+	storage, bucket, key, err := signedLocalStorageRequest(c, http.MethodGet)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	info, err := storage.GetFileInfo(bucket, key)
+	if err != nil {
+		appErrorResponse(c, ErrNotFound)
+		return
+	}
+	objectPath, _ := storage.objectPath(bucket, key)
+	file, err := os.Open(objectPath)
+	if err != nil {
+		appErrorResponse(c, ErrNotFound)
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", info.ContentType)
+	c.Header("ETag", `"`+info.ETag+`"`)
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.LastModified, file)
+}
+
+// 校验本地存储请求的签名，未使用本地存储时返回404
+func signedLocalStorageRequest(c *gin.Context, method string) (*LocalStorageService, string, string, error) {
+	storage, ok := storageService.(*LocalStorageService)
+	if !ok {
+		return nil, "", "", ErrNotFound
+	}
+
+	bucket := c.Param("bucket")
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if _, err := storage.objectPath(bucket, key); err != nil {
+		return nil, "", "", AppError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err := storage.verifySignedRequest(method, bucket, key, c.Request.URL.Query()); err != nil {
+		return nil, "", "", err
+	}
+	return storage, bucket, key, nil
+}
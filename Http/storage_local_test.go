@@ -0,0 +1,235 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorageService {
+	config := DefaultObjectStorageConfig()
+	config.Provider = "local"
+	config.LocalRoot = t.TempDir()
+	config.PublicURL = "http://app.test"
+	config.SigningKey = "test-signing-key"
+
+	service, err := NewStorageService(config)
+	assert.NoError(t, err)
+	return service.(*LocalStorageService)
+}
+
+func TestNewStorageServiceUnknownProvider(t *testing.T) {
+	config := DefaultObjectStorageConfig()
+	config.Provider = "oss"
+
+	service, err := NewStorageService(config)
+	assert.Error(t, err)
+	assert.Nil(t, service)
+}
+
+func TestNewLocalStorageRequiresConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		publicURL  string
+		signingKey string
+	}{
+		{"缺少签名密钥", "http://app.test", ""},
+		{"缺少对外地址", "", "test-signing-key"},
+		{"对外地址不是URL", "app.test:8080", "test-signing-key"},
+		{"对外地址不是http", "ftp://app.test", "test-signing-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultObjectStorageConfig()
+			config.Provider = "local"
+			config.LocalRoot = t.TempDir()
+			config.PublicURL = tt.publicURL
+			config.SigningKey = tt.signingKey
+
+			service, err := NewStorageService(config)
+			assert.Error(t, err)
+			assert.Nil(t, service)
+		})
+	}
+}
+
+func TestLocalStorageObjects(t *testing.T) {
+	storage := newTestLocalStorage(t)
+
+	err := storage.PutObject("audio", "dev_001/a.wav", strings.NewReader("hello"), "audio/wav", map[string]string{"job_id": "job_1"})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.PutObject("audio", "dev_001/b.wav", strings.NewReader("world!"), "", nil))
+	assert.NoError(t, storage.PutObject("audio", "dev_002/c.wav", strings.NewReader("x"), "", nil))
+
+	exists, err := storage.FileExists("audio", "dev_001/a.wav")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, _ = storage.FileExists("audio", "dev_001")
+	assert.False(t, exists)
+
+	info, err := storage.GetFileInfo("audio", "dev_001/a.wav")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", info.ETag) // md5("hello")
+	assert.Equal(t, "audio/wav", info.ContentType)
+	assert.Equal(t, "job_1", info.Metadata["job_id"])
+
+	// 覆盖写入时对象和元数据一起替换，不留下临时文件
+	assert.NoError(t, storage.PutObject("audio", "dev_001/a.wav", strings.NewReader("hello!"), "audio/x-wav", nil))
+	info, err = storage.GetFileInfo("audio", "dev_001/a.wav")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), info.Size)
+	assert.Equal(t, "audio/x-wav", info.ContentType)
+	assert.Empty(t, info.Metadata)
+	tmpFiles, _ := os.ReadDir(filepath.Join(storage.root, ".tmp"))
+	assert.Empty(t, tmpFiles)
+	assert.NoError(t, storage.PutObject("audio", "dev_001/a.wav", strings.NewReader("hello"), "audio/wav", map[string]string{"job_id": "job_1"}))
+
+	body, err := storage.GetObject("audio", "dev_001/b.wav")
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "world!", string(content))
+
+	body, err = storage.GetObjectRange("audio", "dev_001/b.wav", 1, 3)
+	assert.NoError(t, err)
+	content, _ = io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "orl", string(content))
+
+	keys := make([]string, 0)
+	assert.NoError(t, storage.ListFiles("audio", "dev_001/", func(info FileInfo) bool {
+		keys = append(keys, info.Key)
+		return true
+	}))
+	assert.Equal(t, []string{"dev_001/a.wav", "dev_001/b.wav"}, keys)
+
+	// 不存在的前缀不报错
+	assert.NoError(t, storage.ListFiles("audio", "dev_009/", func(info FileInfo) bool { return true }))
+
+	assert.NoError(t, storage.DeleteFile("audio", "dev_002/c.wav"))
+	assert.NoError(t, storage.DeleteFile("audio", "dev_002/c.wav"))
+	_, err = storage.GetFileInfo("audio", "dev_002/c.wav")
+	assert.Error(t, err)
+}
+
+func TestLocalStorageRejectsTraversal(t *testing.T) {
+	storage := newTestLocalStorage(t)
+
+	for _, key := range []string{"", "../etc/passwd", "a/../../b", "/abs", "a//b", `a\b`} {
+		err := storage.PutObject("audio", key, strings.NewReader("x"), "", nil)
+		assert.Error(t, err, key)
+	}
+	for _, bucket := range []string{"", ".meta", "a/b"} {
+		_, err := storage.FileExists(bucket, "a.wav")
+		assert.Error(t, err, bucket)
+	}
+}
+
+// 把预签名URL转换为测试路由的请求路径
+func localRequestPath(t *testing.T, signedURL string) string {
+	parsed, err := url.Parse(signedURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "app.test", parsed.Host)
+	return parsed.RequestURI()
+}
+
+func TestLocalStoragePresignedUpload(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newTestLocalStorage(t)
+	storageService = storage
+	defer func() { storageService = newMockStorageService() }()
+	router := newTestEngine()
+
+	jobID, key := createTestJob(t, router)
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	uploadPath := localRequestPath(t, job.UploadURL)
+
+	put := func(path, contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 签名与Content-Type校验
+	w := put(strings.Replace(uploadPath, "signature=", "signature=00", 1), "audio/wav", "x")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = put(strings.Replace(uploadPath, "job_id", "job_idx", 1), "audio/wav", "x")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = put(uploadPath, "audio/mpeg", "x")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 上传大小受签名中声明的文件大小限制，max_size不能被篡改
+	assert.Contains(t, uploadPath, "max_size=1000")
+	w = put(uploadPath, "audio/wav", strings.Repeat("a", 1001))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = put(strings.Replace(uploadPath, "max_size=1000", "max_size=2000", 1), "audio/wav", strings.Repeat("a", 1001))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	req, _ := http.NewRequest("PUT", uploadPath, strings.NewReader(strings.Repeat("a", 1001)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "audio/wav")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	w = put(uploadPath, "audio/wav", strings.Repeat("a", 1000))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	// 签名中的元数据写入对象，完成回调可以通过校验
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{"etag":`+`"`+strings.Trim(w.Header().Get("ETag"), `"`)+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", data["status"])
+
+	downloadURL, err := storage.GeneratePresignedDownloadURL(defaultBucket, key, time.Hour)
+	assert.NoError(t, err)
+	req, _ = http.NewRequest("GET", localRequestPath(t, downloadURL), nil)
+	req.Header.Set("Range", "bytes=0-9")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, strings.Repeat("a", 10), rec.Body.String())
+	assert.Equal(t, "audio/wav", rec.Header().Get("Content-Type"))
+
+	// 上传URL不能用于下载
+	req, _ = http.NewRequest("GET", uploadPath, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestLocalStorageExpiredURL(t *testing.T) {
+	storage := newTestLocalStorage(t)
+	storageService = storage
+	defer func() { storageService = newMockStorageService() }()
+	router := newTestEngine()
+
+	assert.NoError(t, storage.PutObject(defaultBucket, "a.wav", strings.NewReader("x"), "audio/wav", nil))
+	downloadURL, _ := storage.GeneratePresignedDownloadURL(defaultBucket, "a.wav", -time.Minute)
+
+	req, _ := http.NewRequest("GET", localRequestPath(t, downloadURL), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestLocalStorageRoutesDisabled(t *testing.T) {
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	req, _ := http.NewRequest("GET", "/api/v1/storage/local/"+defaultBucket+"/a.wav", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,115 @@
+//go:build minio
+
+package httpserver
+
+// 针对真实MinIO的集成测试，默认不编译。运行方式:
+//
+//	docker run -d -p 9000:9000 minio/minio server /data
+//	MINIO_TEST_ENDPOINT=localhost:9000 go test -tags minio -run MinIO ./Http/
+//
+// 可选环境变量 MINIO_TEST_ACCESS_KEY、MINIO_TEST_SECRET_KEY (默认minioadmin)、MINIO_TEST_BUCKET
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLiveMinIOStorage(t *testing.T) (*MinIOStorageService, string) {
+	endpoint := os.Getenv("MINIO_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("未设置MINIO_TEST_ENDPOINT，跳过MinIO集成测试")
+	}
+
+	config := DefaultObjectStorageConfig()
+	config.Endpoint = endpoint
+	config.AccessKey = getEnv("MINIO_TEST_ACCESS_KEY", "minioadmin")
+	config.SecretKey = getEnv("MINIO_TEST_SECRET_KEY", "minioadmin")
+	storage, err := NewMinIOStorageService(config)
+	if err != nil {
+		t.Fatalf("连接MinIO失败: %v", err)
+	}
+
+	bucket := getEnv("MINIO_TEST_BUCKET", "rpw-detection-test")
+	if _, err := storage.s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		if _, err := storage.s3Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			t.Fatalf("创建测试存储桶失败: %v", err)
+		}
+	}
+	return storage, bucket
+}
+
+// 按浏览器表单的方式提交预签名POST，文件字段必须放在最后
+func postPresignedForm(t *testing.T, post *PresignedPost, fields map[string]string, content []byte) *http.Response {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		assert.NoError(t, writer.WriteField(name, value))
+	}
+	file, err := writer.CreateFormFile("file", "upload.wav")
+	assert.NoError(t, err)
+	file.Write(content)
+	assert.NoError(t, writer.Close())
+
+	resp, err := http.Post(post.URL, writer.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("提交表单失败: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestMinIOPresignedPostLive(t *testing.T) {
+	storage, bucket := newLiveMinIOStorage(t)
+	key := "minio-test/" + GenerateJobID() + ".wav"
+	content := []byte(strings.Repeat("a", 1000))
+	t.Cleanup(func() { storage.DeleteFile(bucket, key) })
+
+	post, err := storage.GeneratePresignedPost(PresignedURLParams{
+		Bucket:      bucket,
+		Key:         key,
+		ContentType: "audio/wav",
+		Metadata:    map[string]string{"job_id": "job_live"},
+		MinSize:     int64(len(content)),
+		MaxSize:     int64(len(content)),
+		Expires:     10 * time.Minute,
+	})
+	assert.NoError(t, err)
+
+	// 大小不在content-length-range内时被MinIO拒绝
+	resp := postPresignedForm(t, post, post.Fields, content[:999])
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 篡改策略覆盖的字段后签名不再匹配
+	tampered := make(map[string]string, len(post.Fields))
+	for name, value := range post.Fields {
+		tampered[name] = value
+	}
+	tampered["Content-Type"] = "text/html"
+	resp = postPresignedForm(t, post, tampered, content)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	exists, err := storage.FileExists(bucket, key)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// 原样提交成功，对象的类型和元数据来自签名的表单字段
+	resp = postPresignedForm(t, post, post.Fields, content)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, string(body))
+
+	info, err := storage.GetFileInfo(bucket, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, "audio/wav", info.ContentType)
+	assert.Equal(t, "job_live", metadataValue(info.Metadata, "job_id"))
+}
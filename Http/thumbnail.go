@@ -0,0 +1,138 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // 注册PNG解码器
+	"io"
+)
+
+// ==================== 缩略图生成 ====================
+
+const (
+	thumbnailMaxSide = 320 // 缩略图最长边(像素)
+	// 允许解码的最大像素数 (2000万像素)，防止解压炸弹
+	// 与文件大小限制无关：压缩后很小的图片也可能声明极大的尺寸，解码后的RGBA缓冲区最多约80MB
+	thumbnailMaxPixels = 20 * 1000 * 1000
+	// 同时解码的图片数量上限，峰值内存约为 thumbnailConcurrency × 单张解码缓冲区
+	thumbnailConcurrency = 2
+)
+
+// 缩略图生成的信号量
+var thumbnailSlots = make(chan struct{}, thumbnailConcurrency)
+
+// acquireThumbnailSlot 等待一个空闲的缩略图生成名额；请求被取消时返回 ErrThumbnailBusy
+// 成功后调用方必须调用 releaseThumbnailSlot
+func acquireThumbnailSlot(ctx context.Context) error {
+	select {
+	case thumbnailSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ErrThumbnailBusy
+	}
+}
+
+func releaseThumbnailSlot() {
+	<-thumbnailSlots
+}
+
+// GenerateThumbnail 读取JPEG/PNG图片并生成等比缩小的JPEG缩略图
+// 返回缩略图内容以及原图宽高
+func GenerateThumbnail(r io.Reader, maxSide int) ([]byte, int, int, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return nil, 0, 0, ErrInvalidImage
+	}
+	if config.Width*config.Height > thumbnailMaxPixels {
+		return nil, 0, 0, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, 0, 0, ErrInvalidImage
+	}
+
+	thumb := scaleDown(src, maxSide)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return buf.Bytes(), config.Width, config.Height, nil
+}
+
+// 按区域平均等比缩小图片，使最长边不超过maxSide
+// 直接读写RGBA像素缓冲区，避免对每个像素调用At()的接口开销
+func scaleDown(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := width, height
+	if width >= height && width > maxSide {
+		dstWidth, dstHeight = maxSide, height*maxSide/width
+	} else if height > width && height > maxSide {
+		dstWidth, dstHeight = width*maxSide/height, maxSide
+	}
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+
+	rgba := toRGBA(src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := y * height / dstHeight
+		y1 := (y + 1) * height / dstHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstWidth; x++ {
+			x0 := x * width / dstWidth
+			x1 := (x + 1) * width / dstWidth
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+
+			n := uint64((x1 - x0) * (y1 - y0))
+			offset := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// 转换为原点在(0,0)的RGBA图片，image/draw对JPEG的YCbCr和PNG的NRGBA等常见格式有快速路径
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, src, bounds.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,399 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ==================== 事件片段截取 ====================
+// 检测到的事件只有几秒，从一小时的原始录音中截取前后扩展的短片段，
+// 写入源对象旁的派生前缀 (GenerateDerivedStorageKey)，便于直接播放
+
+const (
+	defaultClipPadding = 2.0           // 事件前后默认扩展2秒
+	maxClipDuration    = 5 * 60.0      // 单个片段最长5分钟 (含扩展)
+	clipURLTTL         = 1 * time.Hour // 片段下载URL有效期
+	clipNamePrefix     = "clip_"       // 派生前缀下的片段文件名前缀
+	maxWAVHeaderSize   = 64 * 1024     // data块之前允许的最大头部长度
+	wavFormatPCM       = 0x0001        // 整数PCM
+	wavFormatFloat     = 0x0003        // 浮点PCM
+	wavFormatExtension = 0xFFFE        // WAVE_FORMAT_EXTENSIBLE
+)
+
+// wavFormat WAV文件的格式信息与data块位置
+type wavFormat struct {
+	fmtChunk   []byte // fmt块原始内容，片段沿用相同格式
+	sampleRate uint32
+	byteRate   uint32
+	blockAlign uint16
+	dataOffset int64 // data块内容在文件中的偏移
+	dataSize   int64 // data块内容长度
+}
+
+// 录音时长(秒)
+func (f *wavFormat) duration() float64 {
+	return float64(f.dataSize) / float64(f.byteRate)
+}
+
+// 时间点对应的data块字节偏移，按采样帧对齐
+func (f *wavFormat) offset(seconds float64) int64 {
+	frame := int64(math.Floor(seconds * float64(f.sampleRate)))
+	offset := frame * int64(f.blockAlign)
+	if offset > f.dataSize {
+		offset = f.dataSize - f.dataSize%int64(f.blockAlign)
+	}
+	return offset
+}
+
+// ExtractEventClips 按事件时间截取带前后扩展的音频片段
+// POST /api/v1/jobs/:id/clips
+// 重新截取时先写入全部新片段，再删除该任务已有的片段
+func ExtractEventClips(c *gin.Context) {
+	var req ExtractClipsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+	padding := defaultClipPadding
+	if req.Padding != nil {
+		padding = *req.Padding
+	}
+
+	job, err := getClipSourceJob(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	if !strings.EqualFold(job.FileType, "wav") {
+		appErrorResponse(c, ErrClipNotSupported)
+		return
+	}
+
+	format, err := readStoredWAVFormat(job)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	// 先校验所有事件，避免写入一部分片段后才失败
+	duration := format.duration()
+	ranges := make([][2]float64, len(req.Events))
+	for i, event := range req.Events {
+		start := math.Max(0, event.Start-padding)
+		end := math.Min(duration, event.End+padding)
+		if start >= duration {
+			errorResponse(c, http.StatusBadRequest, fmt.Sprintf("第%d个事件超出录音时长%.3f秒", i+1, duration))
+			return
+		}
+		if end-start > maxClipDuration {
+			errorResponse(c, http.StatusBadRequest, fmt.Sprintf("第%d个片段超过%.0f秒", i+1, maxClipDuration))
+			return
+		}
+		ranges[i] = [2]float64{start, end}
+	}
+
+	// 每次截取使用新的批次名，写入失败时旧片段保持完整
+	batch := clipBatchPrefix()
+	clips := make([]AudioClip, 0, len(ranges))
+	for i, r := range ranges {
+		clip := AudioClip{
+			Index: i + 1,
+			Start: r[0],
+			End:   r[1],
+			Key:   GenerateDerivedStorageKey(job.Key, fmt.Sprintf("%s%04d.wav", batch, i+1)),
+		}
+		if err := writeWAVClip(job, format, clip); err != nil {
+			deleteJobClips(job, func(key string) bool { return isClipOfBatch(job, key, batch) })
+			appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "写入片段失败: " + err.Error()})
+			return
+		}
+		clips = append(clips, withClipURL(job, clip))
+	}
+
+	if err := deleteJobClips(job, func(key string) bool { return !isClipOfBatch(job, key, batch) }); err != nil {
+		appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "删除旧片段失败: " + err.Error()})
+		return
+	}
+
+	successResponse(c, gin.H{
+		"job_id": job.ID,
+		"clips":  clips,
+	})
+}
+
+// ListEventClips 列出任务已截取的片段及下载URL
+// GET /api/v1/jobs/:id/clips
+func ListEventClips(c *gin.Context) {
+	job, err := getClipSourceJob(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	clips, err := listJobClips(job)
+	if err != nil {
+		appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "列出片段失败: " + err.Error()})
+		return
+	}
+
+	successResponse(c, gin.H{
+		"job_id": job.ID,
+		"clips":  clips,
+	})
+}
+
+// listJobClips 列出任务已截取的片段并生成下载URL
+func listJobClips(job *UploadJob) ([]AudioClip, error) {
+	keys, err := listJobClipKeys(job)
+	if err != nil {
+		return nil, err
+	}
+
+	clips := make([]AudioClip, 0, len(keys))
+	for i, key := range keys {
+		clip := AudioClip{Index: i + 1, Key: key}
+		// 片段的时间范围记录在对象元数据中
+		if info, err := storageService.GetFileInfo(job.Bucket, key); err == nil {
+			clip.Start, _ = strconv.ParseFloat(metadataValue(info.Metadata, "clip_start"), 64)
+			clip.End, _ = strconv.ParseFloat(metadataValue(info.Metadata, "clip_end"), 64)
+		}
+		clips = append(clips, withClipURL(job, clip))
+	}
+	return clips, nil
+}
+
+// ==================== 辅助函数 ====================
+
+// 为片段填充预签名下载URL
+func withClipURL(job *UploadJob, clip AudioClip) AudioClip {
+	url, err := storageService.GeneratePresignedDownloadURL(job.Bucket, clip.Key, clipURLTTL)
+	if err != nil {
+		log.Printf("生成片段下载URL失败: %v", err)
+		return clip
+	}
+	clip.URL = url
+	clip.ExpiresAt = time.Now().Add(clipURLTTL).Truncate(time.Millisecond)
+	return clip
+}
+
+// 获取可截取片段的已完成任务
+func getClipSourceJob(c *gin.Context) (*UploadJob, error) {
+	job, err := uploadJobRepo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobStatusCompleted {
+		return nil, ErrJobNotCompleted
+	}
+	if storageService == nil {
+		return nil, ErrStorageService
+	}
+	return job, nil
+}
+
+// 片段批次前缀，片段文件名为 clip_<批次>_0001.wav
+func clipBatchPrefix() string {
+	return clipNamePrefix + uuid.New().String()[:8] + "_"
+}
+
+// 片段是否属于指定批次
+func isClipOfBatch(job *UploadJob, key, batch string) bool {
+	return strings.HasPrefix(key, GenerateDerivedStorageKey(job.Key, batch))
+}
+
+// 列出任务的全部片段键 (按键排序)
+func listJobClipKeys(job *UploadJob) ([]string, error) {
+	keys := make([]string, 0)
+	err := storageService.ListFiles(job.Bucket, GenerateDerivedStorageKey(job.Key, clipNamePrefix), func(info FileInfo) bool {
+		keys = append(keys, info.Key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// 删除任务中满足条件的片段
+func deleteJobClips(job *UploadJob, match func(key string) bool) error {
+	keys, err := listJobClipKeys(job)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !match(key) {
+			continue
+		}
+		if err := storageService.DeleteFile(job.Bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 删除任务的全部派生对象 (片段等)，先列出再删除，避免边遍历边删除影响分页
+func deleteDerivedObjects(job *UploadJob) error {
+	keys := make([]string, 0)
+	err := storageService.ListFiles(job.Bucket, GenerateDerivedStorageKey(job.Key, ""), func(info FileInfo) bool {
+		keys = append(keys, info.Key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := storageService.DeleteFile(job.Bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 读取存储服务中录音的WAV头
+func readStoredWAVFormat(job *UploadJob) (*wavFormat, error) {
+	info, err := storageService.GetFileInfo(job.Bucket, job.Key)
+	if err != nil {
+		return nil, objectInfoError(err)
+	}
+	body, err := storageService.GetObjectRange(job.Bucket, job.Key, 0, maxWAVHeaderSize)
+	if err != nil {
+		return nil, AppError{Code: http.StatusServiceUnavailable, Message: "读取录音失败: " + err.Error()}
+	}
+	defer body.Close()
+
+	format, err := parseWAVHeader(body)
+	if err != nil {
+		return nil, AppError{Code: ErrClipNotSupported.Code, Message: ErrClipNotSupported.Message + ": " + err.Error()}
+	}
+	// 录音中断时data块声明的长度可能大于实际内容
+	if available := info.Size - format.dataOffset; format.dataSize > available {
+		format.dataSize = available - available%int64(format.blockAlign)
+	}
+	return format, nil
+}
+
+// parseWAVHeader 解析RIFF/WAVE头，读取到data块开始为止
+func parseWAVHeader(r io.Reader) (*wavFormat, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("文件过短")
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("不是RIFF/WAVE文件")
+	}
+
+	format := &wavFormat{}
+	offset := int64(len(riff))
+	for offset < maxWAVHeaderSize {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("缺少data块")
+		}
+		offset += int64(len(header))
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return nil, fmt.Errorf("fmt块长度无效")
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, fmt.Errorf("fmt块不完整")
+			}
+			switch binary.LittleEndian.Uint16(chunk[0:2]) {
+			case wavFormatPCM, wavFormatFloat, wavFormatExtension:
+			default:
+				return nil, fmt.Errorf("不支持压缩编码的WAV")
+			}
+			format.fmtChunk = chunk
+			format.sampleRate = binary.LittleEndian.Uint32(chunk[4:8])
+			format.byteRate = binary.LittleEndian.Uint32(chunk[8:12])
+			format.blockAlign = binary.LittleEndian.Uint16(chunk[12:14])
+			if format.sampleRate == 0 || format.byteRate == 0 || format.blockAlign == 0 {
+				return nil, fmt.Errorf("fmt块参数无效")
+			}
+			offset += size
+		case "data":
+			if format.fmtChunk == nil {
+				return nil, fmt.Errorf("data块之前缺少fmt块")
+			}
+			format.dataOffset = offset
+			format.dataSize = size
+			return format, nil
+		default:
+			// 跳过LIST等其他块
+			if offset+size > maxWAVHeaderSize {
+				return nil, fmt.Errorf("头部超过%d字节", maxWAVHeaderSize)
+			}
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return nil, fmt.Errorf("块%q不完整", id)
+			}
+			offset += size
+		}
+
+		// 块长度为奇数时有1字节填充
+		if size%2 == 1 {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return nil, fmt.Errorf("块%q不完整", id)
+			}
+			offset++
+		}
+	}
+	return nil, fmt.Errorf("头部超过%d字节", maxWAVHeaderSize)
+}
+
+// 生成片段的WAV头，沿用原录音的fmt块
+func wavClipHeader(format *wavFormat, dataSize int64) []byte {
+	fmtSize := len(format.fmtChunk)
+	fmtPadding := fmtSize % 2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+fmtSize+fmtPadding+8+int(dataSize)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(fmtSize))
+	buf.Write(format.fmtChunk)
+	if fmtPadding == 1 {
+		buf.WriteByte(0)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	return buf.Bytes()
+}
+
+// 按范围读取原录音中片段对应的数据，把片段写入派生对象
+func writeWAVClip(job *UploadJob, format *wavFormat, clip AudioClip) error {
+	start := format.offset(clip.Start)
+	length := format.offset(clip.End) - start
+
+	body, err := storageService.GetObjectRange(job.Bucket, job.Key, format.dataOffset+start, length)
+	if err != nil {
+		return fmt.Errorf("读取录音失败: %v", err)
+	}
+	defer body.Close()
+
+	content := io.MultiReader(bytes.NewReader(wavClipHeader(format, length)), io.LimitReader(body, length))
+	metadata := map[string]string{
+		"job_id":     job.ID,
+		"source_key": job.Key,
+		"clip_start": strconv.FormatFloat(clip.Start, 'f', 3, 64),
+		"clip_end":   strconv.FormatFloat(clip.End, 'f', 3, 64),
+	}
+	return storageService.PutObject(job.Bucket, clip.Key, content, "audio/wav", metadata)
+}
@@ -0,0 +1,230 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成单声道16位PCM WAV，第i个采样帧的值为i，便于校验片段位置
+func newTestWAV(sampleRate, seconds int) []byte {
+	format := &wavFormat{fmtChunk: make([]byte, 16)}
+	binary.LittleEndian.PutUint16(format.fmtChunk[0:2], wavFormatPCM)
+	binary.LittleEndian.PutUint16(format.fmtChunk[2:4], 1)
+	binary.LittleEndian.PutUint32(format.fmtChunk[4:8], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(format.fmtChunk[8:12], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(format.fmtChunk[12:14], 2)
+	binary.LittleEndian.PutUint16(format.fmtChunk[14:16], 16)
+
+	frames := sampleRate * seconds
+	var buf bytes.Buffer
+	buf.Write(wavClipHeader(format, int64(frames*2)))
+	for i := 0; i < frames; i++ {
+		binary.Write(&buf, binary.LittleEndian, uint16(i))
+	}
+	return buf.Bytes()
+}
+
+// failingPutStorage 写入failAfter个对象后PutObject返回错误
+type failingPutStorage struct {
+	*mockStorageService
+	failAfter int
+	puts      int
+}
+
+func (s *failingPutStorage) PutObject(bucket, key string, body io.Reader, contentType string, metadata map[string]string) error {
+	s.puts++
+	if s.puts > s.failAfter {
+		return fmt.Errorf("存储服务不可用")
+	}
+	return s.mockStorageService.PutObject(bucket, key, body, contentType, metadata)
+}
+
+// 创建已完成的WAV上传任务
+func seedCompletedWAVJob(t *testing.T, storage *mockStorageService, content []byte) *UploadJob {
+	job := seedUploadJob(t, "job_clip")
+	job.Status = JobStatusCompleted
+	job.FileSize = int64(len(content))
+	assert.NoError(t, uploadJobRepo.Update(context.Background(), job))
+	assert.NoError(t, storage.PutObject(job.Bucket, job.Key, bytes.NewReader(content), "audio/wav", map[string]string{"job_id": job.ID}))
+	return job
+}
+
+func TestParseWAVHeader(t *testing.T) {
+	content := newTestWAV(1000, 2)
+	format, err := parseWAVHeader(bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1000), format.sampleRate)
+	assert.Equal(t, int64(44), format.dataOffset)
+	assert.Equal(t, int64(4000), format.dataSize)
+	assert.Equal(t, 2.0, format.duration())
+
+	// LIST块位于fmt与data之间，奇数长度带填充字节
+	var buf bytes.Buffer
+	buf.Write(content[:36])
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte{'a', 'b', 'c', 0})
+	buf.Write(content[36:])
+	format, err = parseWAVHeader(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(56), format.dataOffset)
+
+	for name, content := range map[string][]byte{
+		"非WAV":   []byte("ID3\x04\x00\x00\x00\x00\x00\x00\x00\x00"),
+		"缺少data": content[:36],
+		"压缩编码":   append(append([]byte{}, content[:20]...), append([]byte{0x55, 0x00}, content[22:]...)...),
+	} {
+		_, err := parseWAVHeader(bytes.NewReader(content))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestExtractEventClips(t *testing.T) {
+	storage := newMockStorageService()
+	storageService = storage
+	job := seedCompletedWAVJob(t, storage, newTestWAV(1000, 10))
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/"+job.ID+"/clips",
+		`{"events":[{"start":3,"end":4},{"start":0.5,"end":1}],"padding":1}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	clips := data["clips"].([]interface{})
+	assert.Len(t, clips, 2)
+	first := clips[0].(map[string]interface{})
+	assert.Equal(t, 2.0, first["start"])
+	assert.Equal(t, 5.0, first["end"])
+	firstKey := first["key"].(string)
+	assert.True(t, strings.HasPrefix(firstKey, "dev_001/job_clip.derived/clip_"), firstKey)
+	assert.True(t, strings.HasSuffix(firstKey, "_0001.wav"), firstKey)
+	assert.NotEmpty(t, first["url"])
+	// 扩展后的开始时间不早于录音开始
+	assert.Equal(t, 0.0, clips[1].(map[string]interface{})["start"])
+
+	// 头部一次范围读取，每个片段一次范围读取，不再从头读取整个录音
+	assert.Equal(t, 3, storage.rangeReads)
+
+	// 片段是完整的WAV，内容从第2秒的采样帧开始
+	body, err := storage.GetObject(job.Bucket, firstKey)
+	assert.NoError(t, err)
+	clip, _ := io.ReadAll(body)
+	format, err := parseWAVHeader(bytes.NewReader(clip))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6000), format.dataSize)
+	assert.Equal(t, int64(len(clip)), format.dataOffset+format.dataSize)
+	assert.Equal(t, uint16(2000), binary.LittleEndian.Uint16(clip[format.dataOffset:]))
+
+	// 任务的片段接口返回片段URL
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs/"+job.ID+"/clips", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, data["clips"], 2)
+
+	// 重新截取时替换旧片段
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+job.ID+"/clips", `{"events":[{"start":9.5,"end":9.8}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	clipsAfter, err := listJobClips(job)
+	assert.NoError(t, err)
+	assert.Len(t, clipsAfter, 1)
+	assert.Equal(t, 7.5, clipsAfter[0].Start)
+	assert.Equal(t, 10.0, clipsAfter[0].End)
+}
+
+func TestExtractEventClipsKeepsOldClipsOnFailure(t *testing.T) {
+	storage := newMockStorageService()
+	storageService = storage
+	job := seedCompletedWAVJob(t, storage, newTestWAV(1000, 10))
+	router := newTestEngine()
+	path := "/api/v1/jobs/" + job.ID + "/clips"
+
+	code, _ := doJSON(t, router, "POST", path, `{"events":[{"start":3,"end":4},{"start":6,"end":7}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	before, err := listJobClips(job)
+	assert.NoError(t, err)
+	assert.Len(t, before, 2)
+
+	// 写入第二个新片段时存储服务出错
+	storageService = &failingPutStorage{mockStorageService: storage, failAfter: 1}
+	code, _ = doJSON(t, router, "POST", path, `{"events":[{"start":1,"end":2},{"start":8,"end":9}]}`)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// 旧片段完整保留，已写入的新片段被清理
+	storageService = storage
+	after, err := listJobClips(job)
+	assert.NoError(t, err)
+	assert.Len(t, after, 2)
+	for i := range before {
+		assert.Equal(t, before[i].Key, after[i].Key)
+	}
+}
+
+func TestDeleteUploadJobRemovesClips(t *testing.T) {
+	storage := newMockStorageService()
+	storageService = storage
+	job := seedCompletedWAVJob(t, storage, newTestWAV(1000, 10))
+	router := newTestEngine()
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/jobs/"+job.ID+"/clips", `{"events":[{"start":3,"end":4},{"start":6,"end":7}]}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = doJSON(t, router, "DELETE", "/api/v1/jobs/"+job.ID, "")
+	assert.Equal(t, http.StatusOK, code)
+
+	// 派生前缀下不再有对象
+	var remaining []string
+	assert.NoError(t, storage.ListFiles(job.Bucket, GenerateDerivedStorageKey(job.Key, ""), func(info FileInfo) bool {
+		remaining = append(remaining, info.Key)
+		return true
+	}))
+	assert.Empty(t, remaining)
+	exists, _ := storage.FileExists(job.Bucket, job.Key)
+	assert.False(t, exists)
+}
+
+func TestExtractEventClipsRejected(t *testing.T) {
+	storage := newMockStorageService()
+	storageService = storage
+	job := seedCompletedWAVJob(t, storage, newTestWAV(1000, 10))
+	router := newTestEngine()
+	path := "/api/v1/jobs/" + job.ID + "/clips"
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"没有事件", `{"events":[]}`, http.StatusBadRequest},
+		{"结束早于开始", `{"events":[{"start":3,"end":2}]}`, http.StatusBadRequest},
+		{"超出录音时长", `{"events":[{"start":12,"end":13}]}`, http.StatusBadRequest},
+		{"扩展过大", `{"events":[{"start":3,"end":4}],"padding":60}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := doJSON(t, router, "POST", path, tt.body)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+	clips, _ := listJobClips(job)
+	assert.Empty(t, clips)
+
+	// 未完成或非WAV的任务
+	job.Status = JobStatusPending
+	job.UpdatedAt = time.Now()
+	assert.NoError(t, uploadJobRepo.Update(context.Background(), job))
+	code, _ := doJSON(t, router, "POST", path, `{"events":[{"start":3,"end":4}]}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	job.Status = JobStatusCompleted
+	job.FileType = "mp3"
+	assert.NoError(t, uploadJobRepo.Update(context.Background(), job))
+	code, _ = doJSON(t, router, "POST", path, `{"events":[{"start":3,"end":4}]}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+}
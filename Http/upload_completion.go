@@ -0,0 +1,142 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ==================== 上传完成校验 ====================
+
+// completeUploadJob 以存储服务中的对象为准校验上传结果，校验通过时把任务转为完成
+// expectedETag 为客户端声称的ETag，为空时不校验。已完成的任务直接返回，便于客户端重试
+// 校验失败时普通上传保持原状态并记录失败原因，过期前可以重新上传对象后再次完成；
+// 分片上传合并后UploadID已失效，无法重传，直接转为失败
+// 任务被并发修改 (如存储事件与客户端同时完成) 时重新读取任务，按最新状态再处理
+func completeUploadJob(ctx context.Context, job *UploadJob, expectedETag string) (*UploadJob, error) {
+	err := retryUploadJobUpdate(ctx, job, func(job *UploadJob) error {
+		return tryCompleteUploadJob(ctx, job, expectedETag)
+	})
+	return job, err
+}
+
+// 单次完成尝试，任务已被其他请求修改时返回ErrJobConflict
+func tryCompleteUploadJob(ctx context.Context, job *UploadJob, expectedETag string) error {
+	switch job.Status {
+	case JobStatusCompleted:
+		return nil
+	case JobStatusFailed:
+		return uploadVerificationError(job.FailReason)
+	case JobStatusExpired:
+		return ErrJobNotPending
+	}
+
+	if storageService == nil {
+		return ErrStorageService
+	}
+
+	info, err := storageService.GetFileInfo(job.Bucket, job.Key)
+	if err != nil {
+		// 对象尚未出现时保持任务状态不变，客户端可稍后重试
+		return objectInfoError(err)
+	}
+
+	job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+	if reason := verifyUploadedObject(job, info, expectedETag); reason != "" {
+		if job.UploadID != "" {
+			job.Status = JobStatusFailed
+		}
+		job.FailReason = reason
+		if err := uploadJobRepo.Update(ctx, job); err != nil {
+			return err
+		}
+		return uploadVerificationError(reason)
+	}
+
+	job.Status = JobStatusCompleted
+	job.ETag = info.ETag
+	job.FailReason = ""
+	// 创建任务时还没有登记安装记录的，按任务创建时间补充归属
+	if job.TreeID == "" {
+		treeID, err := placementTreeID(ctx, job.DeviceID, job.CreatedAt)
+		if err != nil {
+			return err
+		}
+		job.TreeID = treeID
+	}
+	if err := uploadJobRepo.Update(ctx, job); err != nil {
+		return err
+	}
+
+	// TODO: 触发后续处理流程 (音频检测等)
+	// triggerAudioDetection(job.ID, job.Bucket, job.Key)
+
+	return nil
+}
+
+// 校验对象的大小、ETag、Content-Type和job_id元数据，返回不一致的原因
+func verifyUploadedObject(job *UploadJob, info *FileInfo, expectedETag string) string {
+	if info.Size != job.FileSize {
+		return fmt.Sprintf("文件大小不一致: 期望%d字节，实际%d字节", job.FileSize, info.Size)
+	}
+
+	if etag := normalizeETag(expectedETag); etag != "" && etag != normalizeETag(info.ETag) {
+		return fmt.Sprintf("ETag不一致: 期望%s，实际%s", etag, normalizeETag(info.ETag))
+	}
+
+	if !sameMediaType(job.ContentType, info.ContentType) {
+		return fmt.Sprintf("Content-Type不一致: 期望%s，实际%s", job.ContentType, info.ContentType)
+	}
+
+	if jobID := metadataValue(info.Metadata, "job_id"); jobID != job.ID {
+		return fmt.Sprintf("对象元数据job_id不一致: 期望%s，实际%s", job.ID, jobID)
+	}
+
+	return ""
+}
+
+// 对象不存在时返回ErrObjectNotUploaded (409)，其他错误说明存储服务暂时不可用 (503)
+func objectInfoError(err error) error {
+	if IsObjectNotFound(err) {
+		return ErrObjectNotUploaded
+	}
+	return AppError{Code: http.StatusServiceUnavailable, Message: "读取对象信息失败: " + err.Error()}
+}
+
+func uploadVerificationError(reason string) error {
+	return AppError{Code: http.StatusUnprocessableEntity, Message: "上传文件校验失败: " + reason}
+}
+
+// 去掉ETag两端的引号并统一为小写
+func normalizeETag(etag string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(etag), `"`))
+}
+
+// 比较MIME类型，忽略大小写和charset等参数
+func sameMediaType(expected, actual string) bool {
+	expectedType, _, err := mime.ParseMediaType(expected)
+	if err != nil {
+		return strings.EqualFold(expected, actual)
+	}
+	actualType, _, err := mime.ParseMediaType(actual)
+	if err != nil {
+		return false
+	}
+	return expectedType == actualType
+}
+
+// 读取对象元数据，S3会把元数据键规范化为首字母大写，因此忽略大小写
+func metadataValue(metadata map[string]string, key string) string {
+	if value, ok := metadata[key]; ok {
+		return value
+	}
+	for k, value := range metadata {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建一个1000字节的待上传任务，返回任务ID和对象键
+func createTestJob(t *testing.T, router *gin.Engine) (string, string) {
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	return data["job_id"].(string), data["key"].(string)
+}
+
+func TestUploadCompletionVerified(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	jobID, key := createTestJob(t, router)
+
+	// 对象尚未上传，任务保持pending
+	code, _ := doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{}`)
+	assert.Equal(t, http.StatusConflict, code)
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusPending, job.Status)
+
+	// 回调内容与任务不符
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{"key":"other/key.wav"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav",
+		map[string]string{"Job_id": jobID})
+	info, _ := storage.GetFileInfo(defaultBucket, key)
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{"etag":"\"`+strings.ToUpper(info.ETag)+`\""}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", data["status"])
+	assert.Equal(t, info.ETag, data["etag"])
+
+	// 重复回调幂等
+	code, data = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", data["status"])
+}
+
+func TestUploadCompletionMismatch(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	tests := []struct {
+		name        string
+		size        int
+		contentType string
+		metadataJob string
+		etag        string
+		reason      string
+	}{
+		{"大小不一致", 999, "audio/wav", "", "", "文件大小不一致"},
+		{"Content-Type不一致", 1000, "audio/mpeg", "", "", "Content-Type不一致"},
+		{"job_id不一致", 1000, "audio/wav", "job_other", "", "job_id不一致"},
+		{"ETag不一致", 1000, "audio/wav", "", "deadbeef", "ETag不一致"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobID, key := createTestJob(t, router)
+			metadataJob := tt.metadataJob
+			if metadataJob == "" {
+				metadataJob = jobID
+			}
+			storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", tt.size)), tt.contentType,
+				map[string]string{"job_id": metadataJob})
+
+			code, _ := doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{"etag":"`+tt.etag+`"}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+			// 任务保持pending并记录失败原因，过期前可以重新上传
+			job, _ := uploadJobRepo.Get(context.Background(), jobID)
+			assert.Equal(t, JobStatusPending, job.Status)
+			assert.Contains(t, job.FailReason, tt.reason)
+
+			// 按失败原因过滤可以找到校验失败但仍为pending的任务
+			code, data := doJSON(t, router, "GET", "/api/v1/jobs?status=pending&has_fail_reason=true", "")
+			assert.Equal(t, http.StatusOK, code)
+			jobs := data["data"].([]interface{})
+			assert.Len(t, jobs, 1)
+			assert.Equal(t, jobID, jobs[0].(map[string]interface{})["id"])
+
+			code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{"etag":"`+tt.etag+`"}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+			// 重新上传正确的对象后完成，失败原因被清除
+			storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav",
+				map[string]string{"job_id": jobID})
+			code, data = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{}`)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, "completed", data["status"])
+			job, _ = uploadJobRepo.Get(context.Background(), jobID)
+			assert.Empty(t, job.FailReason)
+		})
+	}
+
+	code, _ := doJSON(t, router, "GET", "/api/v1/jobs?has_fail_reason=maybe", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestUploadCompletionStorageUnavailable(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+	jobID, _ := createTestJob(t, router)
+
+	// 存储服务故障不能当作对象未上传
+	storageService = unavailableStorage{newMockStorageService()}
+	defer func() { storageService = newMockStorageService() }()
+	code, _ := doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete", `{}`)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusPending, job.Status)
+	assert.Empty(t, job.FailReason)
+}
+
+func TestUploadCompletionConcurrentUpdate(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+	ctx := context.Background()
+
+	jobID, key := createTestJob(t, router)
+	storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav",
+		map[string]string{"job_id": jobID})
+
+	// 读取后任务被其他请求修改，完成时重新读取最新版本再保存
+	stale, _ := uploadJobRepo.Get(ctx, jobID)
+	latest, _ := uploadJobRepo.Get(ctx, jobID)
+	latest.Description = "由其他请求修改"
+	assert.NoError(t, uploadJobRepo.Update(ctx, latest))
+
+	job, err := completeUploadJob(ctx, stale, "")
+	assert.NoError(t, err)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+	assert.Equal(t, "由其他请求修改", job.Description)
+	stored, _ := uploadJobRepo.Get(ctx, jobID)
+	assert.Equal(t, JobStatusCompleted, stored.Status)
+	assert.Equal(t, int64(2), stored.Version)
+
+	// 其他请求已把任务标记为过期时，按最新状态返回而不是覆盖
+	jobID, key = createTestJob(t, router)
+	storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav",
+		map[string]string{"job_id": jobID})
+	stale, _ = uploadJobRepo.Get(ctx, jobID)
+	latest, _ = uploadJobRepo.Get(ctx, jobID)
+	latest.Status = JobStatusExpired
+	assert.NoError(t, uploadJobRepo.Update(ctx, latest))
+
+	_, err = completeUploadJob(ctx, stale, "")
+	assert.Equal(t, ErrJobNotPending, err)
+	stored, _ = uploadJobRepo.Get(ctx, jobID)
+	assert.Equal(t, JobStatusExpired, stored.Status)
+}
+
+func TestSameMediaType(t *testing.T) {
+	assert.True(t, sameMediaType("audio/wav", "Audio/WAV"))
+	assert.True(t, sameMediaType("text/plain", "text/plain; charset=utf-8"))
+	assert.False(t, sameMediaType("audio/wav", "audio/mpeg"))
+	assert.False(t, sameMediaType("audio/wav", ""))
+}
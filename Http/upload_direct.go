@@ -0,0 +1,144 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 服务端直传 ====================
+// 低端传感器无法计算或跟随预签名URL时，把文件直接发给本服务，由服务端流式写入存储服务
+
+// DirectUpload 为已创建的任务上传文件，并在同一请求中完成任务
+// PUT  /api/v1/jobs/:id/upload  请求体为文件原始内容
+// POST /api/v1/jobs/:id/upload  multipart/form-data，文件字段名为file
+func DirectUpload(c *gin.Context) {
+	jobID := c.Param("id")
+	if _, busy := uploadLocks.LoadOrStore(jobID, struct{}{}); busy {
+		appErrorResponse(c, ErrUploadLocked)
+		return
+	}
+	defer uploadLocks.Delete(jobID)
+
+	ctx := c.Request.Context()
+	job, err := uploadJobRepo.Get(ctx, jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	if job.Status != JobStatusPending || job.UploadID != "" {
+		appErrorResponse(c, ErrJobNotPending)
+		return
+	}
+	// tus上传的数据先写入临时分片，直传会绕过分片直接覆盖对象
+	if job.UploadURL == tusLocation(job.ID) {
+		appErrorResponse(c, ErrTusUpload)
+		return
+	}
+	if storageService == nil {
+		appErrorResponse(c, ErrStorageService)
+		return
+	}
+
+	// 请求体包含multipart边界，只有原始内容可以提前按Content-Length拒绝
+	if c.Request.ContentLength > job.FileSize && !isMultipartForm(c) {
+		appErrorResponse(c, ErrFileTooLarge)
+		return
+	}
+
+	file, err := directUploadFile(c, job)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	// 边读边写，超出任务声明的大小时立即中止
+	body := &limitedUploadReader{r: file, remaining: job.FileSize}
+	if err := storageService.PutObject(job.Bucket, job.Key, body, job.ContentType, uploadJobMetadata(job)); err != nil {
+		if body.exceeded {
+			appErrorResponse(c, ErrFileTooLarge)
+			return
+		}
+		appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "写入存储服务失败: " + err.Error()})
+		return
+	}
+
+	// 连接中断导致数据不完整时删除对象，任务保持待上传，设备可以重试
+	if body.read < job.FileSize {
+		if err := storageService.DeleteFile(job.Bucket, job.Key); err != nil {
+			log.Printf("删除不完整的对象 %s 失败: %v", job.Key, err)
+		}
+		errorResponse(c, http.StatusBadRequest, "上传数据不完整，请重试")
+		return
+	}
+
+	job, err = completeUploadJob(ctx, job, "")
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"message": "上传完成",
+		"job_id":  job.ID,
+		"status":  string(job.Status),
+		"etag":    job.ETag,
+		"size":    body.read,
+	})
+}
+
+// ==================== 辅助函数 ====================
+
+// 取得待写入的文件内容并检查类型，multipart表单只流式读取到file字段
+func directUploadFile(c *gin.Context, job *UploadJob) (io.Reader, error) {
+	if !isMultipartForm(c) {
+		if err := checkDirectUploadType(job, c.ContentType(), ""); err != nil {
+			return nil, err
+		}
+		return c.Request.Body, nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, AppError{Code: http.StatusBadRequest, Message: "表单格式错误: " + err.Error()}
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, AppError{Code: http.StatusBadRequest, Message: "表单缺少file字段"}
+		}
+		if err != nil {
+			return nil, AppError{Code: http.StatusBadRequest, Message: "表单格式错误: " + err.Error()}
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		if err := checkDirectUploadType(job, part.Header.Get("Content-Type"), part.FileName()); err != nil {
+			return nil, err
+		}
+		return part, nil
+	}
+}
+
+// 文件的Content-Type与扩展名必须与任务一致；无法确定类型的设备可以使用application/octet-stream
+func checkDirectUploadType(job *UploadJob, contentType, fileName string) error {
+	if contentType != "" && !sameMediaType(job.ContentType, contentType) && !sameMediaType("application/octet-stream", contentType) {
+		return AppError{Code: http.StatusUnsupportedMediaType, Message: "Content-Type与任务不一致: " + contentType}
+	}
+	if ext := strings.TrimPrefix(filepath.Ext(fileName), "."); ext != "" && !strings.EqualFold(ext, job.FileType) {
+		return AppError{Code: http.StatusUnsupportedMediaType, Message: "文件类型与任务不一致: " + ext}
+	}
+	return nil
+}
+
+func isMultipartForm(c *gin.Context) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func doUpload(router *gin.Engine, method, path, contentType string, body io.Reader, contentLength int64) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", contentType)
+	req.ContentLength = contentLength
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDirectUploadRaw(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	jobID, key := createTestJob(t, router)
+	content := strings.Repeat("a", 1000)
+
+	w := doUpload(router, "PUT", "/api/v1/jobs/"+jobID+"/upload", "audio/wav", strings.NewReader(content), 1000)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+	info, err := storage.GetFileInfo(defaultBucket, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), info.Size)
+	assert.Equal(t, jobID, info.Metadata["job_id"])
+
+	// 已完成的任务不能再次上传
+	w = doUpload(router, "PUT", "/api/v1/jobs/"+jobID+"/upload", "audio/wav", strings.NewReader(content), 1000)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestDirectUploadRejectsTusJob(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	location := createTusUpload(t, router)
+	jobID := strings.TrimPrefix(location, tusBasePath+"/")
+
+	// tus任务只能通过tus接口上传
+	w := doUpload(router, "PUT", "/api/v1/jobs/"+jobID+"/upload", "audio/wav", strings.NewReader(strings.Repeat("a", 1000)), 1000)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusPending, job.Status)
+	exists, _ := storage.FileExists(defaultBucket, job.Key)
+	assert.False(t, exists)
+}
+
+func TestDirectUploadMultipart(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	jobID, _ := createTestJob(t, router)
+
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	form.WriteField("device_id", "dev_001")
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="file"; filename="a.wav"`)
+	header.Set("Content-Type", "application/octet-stream")
+	part, _ := form.CreatePart(header)
+	part.Write([]byte(strings.Repeat("a", 1000)))
+	form.Close()
+
+	w := doUpload(router, "POST", "/api/v1/jobs/"+jobID+"/upload", form.FormDataContentType(), &buf, int64(buf.Len()))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+}
+
+func TestDirectUploadLimits(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	jobID, key := createTestJob(t, router)
+	path := "/api/v1/jobs/" + jobID + "/upload"
+
+	tests := []struct {
+		name          string
+		contentType   string
+		content       string
+		contentLength int64
+		code          int
+	}{
+		{"Content-Length超出", "audio/wav", strings.Repeat("a", 1001), 1001, http.StatusRequestEntityTooLarge},
+		{"流式读取时超出", "audio/wav", strings.Repeat("a", 1001), -1, http.StatusRequestEntityTooLarge},
+		{"类型不一致", "audio/mpeg", strings.Repeat("a", 1000), 1000, http.StatusUnsupportedMediaType},
+		{"数据不完整", "audio/wav", strings.Repeat("a", 500), -1, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doUpload(router, "PUT", path, tt.contentType, strings.NewReader(tt.content), tt.contentLength)
+			assert.Equal(t, tt.code, w.Code)
+
+			// 任务保持待上传，不留下对象
+			job, _ := uploadJobRepo.Get(context.Background(), jobID)
+			assert.Equal(t, JobStatusPending, job.Status)
+			exists, _ := storage.FileExists(defaultBucket, key)
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestDirectUploadMultipartWrongExtension(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	jobID, _ := createTestJob(t, router)
+
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, _ := form.CreateFormFile("file", "a.mp3")
+	part.Write([]byte(strings.Repeat("a", 1000)))
+	form.Close()
+
+	w := doUpload(router, "POST", "/api/v1/jobs/"+jobID+"/upload", form.FormDataContentType(), &buf, int64(buf.Len()))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// 缺少file字段
+	buf.Reset()
+	form = multipart.NewWriter(&buf)
+	form.WriteField("device_id", "dev_001")
+	form.Close()
+	w = doUpload(router, "POST", "/api/v1/jobs/"+jobID+"/upload", form.FormDataContentType(), &buf, int64(buf.Len()))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,132 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 存储事件回调 ====================
+
+// 存储事件回调共享密钥，为空时拒绝所有事件
+var bucketEventSecret string
+
+// BucketEvent MinIO/S3 存储桶事件通知
+// MinIO webhook 与 S3 (经SNS/SQS转发) 的消息都使用 Records 数组
+type BucketEvent struct {
+	Records []BucketEventRecord `json:"Records"`
+}
+
+// BucketEventRecord 单条事件记录
+type BucketEventRecord struct {
+	EventName string `json:"eventName"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key         string `json:"key"` // URL编码的对象键
+			Size        int64  `json:"size"`
+			ETag        string `json:"eTag"`
+			ContentType string `json:"contentType"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// HandleBucketEvent 接收存储桶对象创建事件，自动完成对应的上传任务
+// POST /api/v1/storage/events
+// 设备上传后断网未调用 /jobs/:id/complete 时，由存储服务直接通知
+func HandleBucketEvent(c *gin.Context) {
+	if bucketEventSecret == "" {
+		errorResponse(c, http.StatusServiceUnavailable, "未配置存储事件回调密钥")
+		return
+	}
+	if !validBucketEventToken(c.GetHeader("Authorization")) {
+		errorResponse(c, http.StatusUnauthorized, "存储事件回调认证失败")
+		return
+	}
+
+	var event BucketEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		errorResponse(c, http.StatusBadRequest, "事件格式错误: "+err.Error())
+		return
+	}
+
+	completed, ignored, retry := 0, 0, 0
+	for _, record := range event.Records {
+		handled, err := processBucketEventRecord(c, record)
+		switch {
+		case err != nil:
+			log.Printf("处理存储事件失败 %s/%s: %v", record.S3.Bucket.Name, record.S3.Object.Key, err)
+			retry++
+		case handled:
+			completed++
+		default:
+			ignored++
+		}
+	}
+
+	// 存在可重试的失败时返回5xx，让存储服务重新投递 (已处理的记录幂等)
+	if retry > 0 {
+		errorResponse(c, http.StatusServiceUnavailable, "部分事件处理失败，请重试")
+		return
+	}
+
+	successResponse(c, gin.H{
+		"completed": completed,
+		"ignored":   ignored,
+	})
+}
+
+// 处理单条事件记录，返回是否对应到了上传任务；error表示需要存储服务重试
+func processBucketEventRecord(c *gin.Context, record BucketEventRecord) (bool, error) {
+	if !strings.HasPrefix(strings.TrimPrefix(record.EventName, "s3:"), "ObjectCreated:") {
+		return false, nil
+	}
+
+	// 事件中的对象键经过URL编码 (空格编码为+)
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		log.Printf("存储事件对象键无法解码: %s", record.S3.Object.Key)
+		return false, nil
+	}
+
+	job, err := uploadJobRepo.GetByObject(c.Request.Context(), record.S3.Bucket.Name, key)
+	if errors.Is(err, ErrJobNotFound) {
+		// 附件、缩略图等对象不属于上传任务
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = completeUploadJob(c.Request.Context(), job, record.S3.Object.ETag)
+	var appErr AppError
+	if errors.As(err, &appErr) && appErr.Code == http.StatusUnprocessableEntity {
+		// 校验失败已记录到任务上，重试也不会改变结果
+		return true, nil
+	}
+	if errors.Is(err, ErrJobNotPending) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 校验Authorization头，兼容 "Bearer <token>" 和直接传token两种形式
+func validBucketEventToken(header string) bool {
+	return matchBearerToken(header, bucketEventSecret)
+}
+
+// 以固定时间比较Authorization头中的令牌与密钥
+func matchBearerToken(header, secret string) bool {
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造MinIO对象创建事件
+func bucketEventBody(eventName, bucket, key string) string {
+	return `{"EventName":"` + eventName + `","Records":[{"eventName":"` + eventName + `",` +
+		`"s3":{"bucket":{"name":"` + bucket + `"},"object":{"key":"` + url.QueryEscape(key) + `","size":1000}}}]}`
+}
+
+func postBucketEvent(router *gin.Engine, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/storage/events", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBucketEventCompletesJob(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	bucketEventSecret = "event-secret"
+	router := newTestEngine()
+
+	jobID, key := createTestJob(t, router)
+	body := bucketEventBody("s3:ObjectCreated:Put", defaultBucket, key)
+
+	// 认证
+	assert.Equal(t, http.StatusUnauthorized, postBucketEvent(router, "", body).Code)
+	assert.Equal(t, http.StatusUnauthorized, postBucketEvent(router, "wrong", body).Code)
+
+	// 事件先于对象可见时让存储服务重试
+	assert.Equal(t, http.StatusServiceUnavailable, postBucketEvent(router, "event-secret", body).Code)
+
+	storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav",
+		map[string]string{"job_id": jobID})
+
+	w := postBucketEvent(router, "event-secret", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"completed":1`)
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+
+	// 重复投递幂等
+	assert.Equal(t, http.StatusOK, postBucketEvent(router, "event-secret", body).Code)
+}
+
+func TestBucketEventIgnoresUnrelatedObjects(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	bucketEventSecret = "event-secret"
+	router := newTestEngine()
+
+	for _, body := range []string{
+		bucketEventBody("s3:ObjectCreated:Put", defaultBucket, "attachments/tree/t1/a b.png"),
+		bucketEventBody("s3:ObjectRemoved:Delete", defaultBucket, "dev_001/a.wav"),
+	} {
+		w := postBucketEvent(router, "event-secret", body)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"ignored":1`)
+	}
+
+	// 未配置密钥时拒绝
+	bucketEventSecret = ""
+	assert.Equal(t, http.StatusServiceUnavailable, postBucketEvent(router, "", bucketEventBody("s3:ObjectCreated:Put", defaultBucket, "x")).Code)
+}
+
+func TestBucketEventVerificationFailure(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	bucketEventSecret = "event-secret"
+	router := newTestEngine()
+
+	jobID, key := createTestJob(t, router)
+	storage.PutObject(defaultBucket, key, strings.NewReader("short"), "audio/wav", map[string]string{"job_id": jobID})
+
+	// 校验失败不需要重试
+	w := postBucketEvent(router, "event-secret", bucketEventBody("ObjectCreated:Put", defaultBucket, key))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusPending, job.Status)
+	assert.Contains(t, job.FailReason, "文件大小不一致")
+}
@@ -1,7 +1,14 @@
 package httpserver
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,15 +19,29 @@ import (
 // 全局存储服务实例
 var storageService StorageService
 
+// 默认存储桶
+const defaultBucket = "pest-detection"
+
+const (
+	maxUploadFileSize = 100 * 1024 * 1024 // 上传文件最大100MB
+	uploadURLTTL      = 24 * time.Hour    // 上传任务有效期
+)
+
+// 正在由服务端写入对象的任务 (tus、直传)，同一任务不能并发写入
+// 锁只在当前进程内有效，多副本部署时请求可能落到不同实例而互不感知，
+// 因此tus和直传只支持单副本部署，或由负载均衡按任务ID (URL路径) 做会话保持
+var uploadLocks sync.Map
+
 // InitStorageService 初始化存储服务
 func InitStorageService() error {
 	config := LoadObjectStorageConfig()
+	bucketEventSecret = config.EventSecret
 
-	var err error
-	storageService, err = NewMinIOStorageService(config)
+	service, err := NewStorageService(config)
 	if err != nil {
 		return err
 	}
+	storageService = service
 
 	return nil
 }
@@ -36,65 +57,65 @@ func CreateUploadJob(c *gin.Context) {
 		return
 	}
 
-	// 验证文件类型
-	if !ValidateFileType(req.FileType) {
-		errorResponse(c, http.StatusBadRequest, "不支持的文件类型: "+req.FileType)
+	if err := validateUploadJobRequest(&req); err != nil {
+		appErrorResponse(c, err)
 		return
 	}
 
-	// 验证文件大小 (默认100MB)
-	if !ValidateFileSize(req.FileSize, 100*1024*1024) {
-		errorResponse(c, http.StatusBadRequest, "文件大小超出限制")
+	job, err := newUploadJob(c.Request.Context(), &req)
+	if err != nil {
+		appErrorResponse(c, err)
 		return
 	}
 
-	// 生成任务ID
-	jobID := GenerateJobID()
-
-	// 生成存储键
-	storageKey := GenerateStorageKey(req.DeviceID, req.FileName)
-
-	// 设置元数据
-	metadata := map[string]string{
-		"device_id":   req.DeviceID,
-		"job_id":      jobID,
-		"file_type":   req.FileType,
-		"description": req.Description,
-		"upload_time": time.Now().Format(time.RFC3339),
+	// 默认使用预签名PUT，前端只需要上传文件
+	method := "PUT"
+	requiredFields := []string{"file"}
+	var formFields map[string]string
+
+	if req.UploadMethod == "POST" {
+		// 预签名POST表单，由存储服务强制校验文件大小和类型
+		post, err := presignPost(job)
+		if err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+		job.UploadURL = post.URL
+		method = "POST"
+		formFields = post.Fields
+		requiredFields = postFormFieldNames(post.Fields)
+	} else {
+		// 生成预签名上传URL (24小时过期)
+		uploadURL, err := presignUpload(job.Key, job.ContentType, job.FileSize, uploadJobMetadata(job), uploadURLTTL)
+		if err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+		job.UploadURL = uploadURL
 	}
 
-	// 生成预签名上传URL
-	uploadURL, err := storageService.GeneratePresignedUploadURL(PresignedURLParams{
-		Bucket:      "pest-detection", // 使用默认存储桶
-		Key:         storageKey,
-		Method:      "PUT",
-		Expires:     time.Duration(24) * time.Hour, // 24小时过期
-		ContentType: req.ContentType,
-		Metadata:    metadata,
-	})
-
-	if err != nil {
-		errorResponse(c, http.StatusInternalServerError, "生成预签名URL失败: "+err.Error())
+	// 保存任务信息到数据库
+	if err := uploadJobRepo.Create(c.Request.Context(), job); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// 创建响应
 	response := CreateUploadJobResponse{
-		JobID:          jobID,
-		UploadURL:      uploadURL,
-		Bucket:         "pest-detection",
-		Key:            storageKey,
-		TTL:            24 * 3600, // 24小时，单位秒
-		ExpiresAt:      time.Now().Add(24 * time.Hour),
-		ContentType:    req.ContentType,
-		MaxFileSize:    req.FileSize,
-		RequiredFields: []string{"file"}, // 前端需要上传的字段
-		Status:         string(JobStatusPending),
-		CreatedAt:      time.Now(),
-	}
-
-	// 保存任务信息到数据库 (TODO: 实现数据库存储)
-	// saveUploadJobToDatabase(response)
+		JobID:          job.ID,
+		UploadURL:      job.UploadURL,
+		Method:         method,
+		FormFields:     formFields,
+		Bucket:         job.Bucket,
+		Key:            job.Key,
+		TTL:            job.TTL,
+		ExpiresAt:      job.ExpiresAt,
+		ContentType:    job.ContentType,
+		MaxFileSize:    job.FileSize,
+		RequiredFields: requiredFields, // 前端需要上传的字段
+		Status:         string(job.Status),
+		CreatedAt:      job.CreatedAt,
+	}
 
 	// 返回成功响应
 	successResponse(c, response)
@@ -109,76 +130,151 @@ func GetUploadJobStatus(c *gin.Context) {
 		return
 	}
 
-	// TODO: 从数据库查询任务状态
-	// job := getUploadJobFromDatabase(jobID)
-
-	// 模拟任务状态
-	job := &UploadJob{
-		ID:          jobID,
-		DeviceID:    "dev_001",
-		FileName:    "audio_sample.wav",
-		FileSize:    1024000,
-		FileType:    "wav",
-		ContentType: "audio/wav",
-		Status:      JobStatusPending,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	job, err := uploadJobRepo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
 	}
 
 	successResponse(c, job)
 }
 
 // ListUploadJobs 列出上传任务
-// GET /api/v1/jobs
+// GET /api/v1/jobs?device_id=xxx&tree_id=xxx&status=pending&has_fail_reason=true&file_type=wav&created_from=...&created_to=...&order=desc
+// 默认按页码分页 (page, page_size)；传入cursor参数 (首页为空) 时使用游标分页
 func ListUploadJobs(c *gin.Context) {
-	// 获取查询参数
-	_ = c.Query("device_id")              // TODO: 使用deviceID进行过滤
-	_ = c.Query("status")                 // TODO: 使用status进行过滤
-	_ = c.DefaultQuery("page", "1")       // TODO: 使用page进行分页
-	_ = c.DefaultQuery("page_size", "20") // TODO: 使用pageSize进行分页
-
-	// TODO: 从数据库查询任务列表
-	// jobs := getUploadJobsFromDatabase(deviceID, status, page, pageSize)
-
-	// 模拟任务列表
-	jobs := []UploadJob{
-		{
-			ID:          "job_abc123",
-			DeviceID:    "dev_001",
-			FileName:    "audio_sample.wav",
-			FileSize:    1024000,
-			FileType:    "wav",
-			ContentType: "audio/wav",
-			Status:      JobStatusCompleted,
-			CreatedAt:   time.Now().Add(-1 * time.Hour),
-			UpdatedAt:   time.Now().Add(-30 * time.Minute),
-		},
-		{
-			ID:          "job_def456",
-			DeviceID:    "dev_002",
-			FileName:    "audio_sample.mp3",
-			FileSize:    2048000,
-			FileType:    "mp3",
-			ContentType: "audio/mpeg",
-			Status:      JobStatusPending,
-			CreatedAt:   time.Now().Add(-2 * time.Hour),
-			UpdatedAt:   time.Now().Add(-2 * time.Hour),
-		},
+	filter, err := parseUploadJobFilter(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		listUploadJobsByCursor(c, filter, cursor, pageSize)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	filter.CountTotal = true
+	filter.Offset = (page - 1) * pageSize
+	filter.Limit = pageSize
+	jobs, total, err := uploadJobRepo.List(c.Request.Context(), filter)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	// 分页响应
 	response := PaginatedResponse{
-		Total:      len(jobs),
-		Page:       1,
-		PageSize:   20,
-		TotalPages: 1,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
 		Data:       jobs,
 	}
 
 	successResponse(c, response)
 }
 
-// DeleteUploadJob 删除上传任务
+// 游标分页：多取一条判断是否还有下一页，不统计总数
+func listUploadJobsByCursor(c *gin.Context, filter UploadJobFilter, cursor string, pageSize int) {
+	if cursor != "" {
+		after, ascending, err := DecodeUploadJobCursor(cursor)
+		if err != nil || ascending != filter.Ascending {
+			appErrorResponse(c, ErrInvalidCursor)
+			return
+		}
+		filter.After = &after
+	}
+
+	filter.Limit = pageSize + 1
+	jobs, _, err := uploadJobRepo.List(c.Request.Context(), filter)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := CursorPaginatedResponse{PageSize: pageSize}
+	if len(jobs) > pageSize {
+		jobs = jobs[:pageSize]
+		last := jobs[len(jobs)-1]
+		response.HasMore = true
+		response.NextCursor = EncodeUploadJobCursor(UploadJobCursor{CreatedAt: last.CreatedAt, ID: last.ID}, filter.Ascending)
+	}
+	response.Data = jobs
+
+	successResponse(c, response)
+}
+
+// 解析任务列表的过滤和排序参数
+func parseUploadJobFilter(c *gin.Context) (UploadJobFilter, error) {
+	filter := UploadJobFilter{
+		DeviceID: c.Query("device_id"),
+		TreeID:   c.Query("tree_id"),
+		Status:   UploadJobStatus(c.Query("status")),
+		FileType: strings.ToLower(c.Query("file_type")),
+	}
+
+	switch filter.Status {
+	case "", JobStatusPending, JobStatusUploading, JobStatusCompleted, JobStatusFailed, JobStatusExpired:
+	default:
+		return filter, AppError{Code: http.StatusBadRequest, Message: "无效的任务状态: " + string(filter.Status)}
+	}
+
+	// 普通上传校验失败后任务仍为pending，只有按失败原因过滤才能找到
+	if value := c.Query("has_fail_reason"); value != "" {
+		failedOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, AppError{Code: http.StatusBadRequest, Message: "has_fail_reason应为true或false"}
+		}
+		filter.FailedOnly = failedOnly
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, AppError{Code: http.StatusBadRequest, Message: "排序方式应为asc或desc"}
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeQuery(c, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeQuery(c, "created_to"); err != nil {
+		return filter, err
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && filter.CreatedTo.Before(filter.CreatedFrom) {
+		return filter, ErrInvalidTimeRange
+	}
+
+	return filter, nil
+}
+
+// 解析RFC3339格式的时间参数，参数为空时返回零值
+func parseTimeQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, AppError{Code: http.StatusBadRequest, Message: "时间格式错误，应为RFC3339: " + value}
+	}
+	return t, nil
+}
+
+// DeleteUploadJob 删除上传任务及其存储对象 (含派生的片段)
 // DELETE /api/v1/jobs/:id
 func DeleteUploadJob(c *gin.Context) {
 	jobID := c.Param("id")
@@ -187,11 +283,38 @@ func DeleteUploadJob(c *gin.Context) {
 		return
 	}
 
-	// TODO: 从数据库删除任务
-	// deleteUploadJobFromDatabase(jobID)
+	job, err := uploadJobRepo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
 
-	// TODO: 从存储服务删除文件
-	// storageService.DeleteFile("pest-detection", storageKey)
+	// 先删除存储对象，失败时保留任务记录以便重试
+	abortUnfinishedMultipart(job)
+	discardTusChunks(job)
+	if storageService != nil {
+		if err := deleteDerivedObjects(job); err != nil {
+			appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "删除派生文件失败: " + err.Error()})
+			return
+		}
+		// 无法确认对象是否存在时保留任务，否则对象会变成来源不明的孤儿
+		exists, err := storageService.FileExists(job.Bucket, job.Key)
+		if err != nil {
+			appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "检查文件失败: " + err.Error()})
+			return
+		}
+		if exists {
+			if err := storageService.DeleteFile(job.Bucket, job.Key); err != nil {
+				appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "删除文件失败: " + err.Error()})
+				return
+			}
+		}
+	}
+
+	if err := uploadJobRepo.Delete(c.Request.Context(), jobID); err != nil {
+		appErrorResponse(c, err)
+		return
+	}
 
 	successResponse(c, gin.H{
 		"message": "任务删除成功",
@@ -201,6 +324,7 @@ func DeleteUploadJob(c *gin.Context) {
 
 // UploadCompletionWebhook 上传完成回调
 // POST /api/v1/jobs/:id/complete
+// 回调内容只作为参考，任务状态以存储服务中的对象为准
 func UploadCompletionWebhook(c *gin.Context) {
 	jobID := c.Param("id")
 	if jobID == "" {
@@ -214,19 +338,178 @@ func UploadCompletionWebhook(c *gin.Context) {
 		return
 	}
 
-	// TODO: 更新任务状态为已完成
-	// updateUploadJobStatus(jobID, JobStatusCompleted)
+	job, err := uploadJobRepo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
 
-	// TODO: 触发后续处理流程 (音频检测等)
-	// triggerAudioDetection(jobID, notification.Bucket, notification.Key)
+	if (notification.JobID != "" && notification.JobID != job.ID) ||
+		(notification.Bucket != "" && notification.Bucket != job.Bucket) ||
+		(notification.Key != "" && notification.Key != job.Key) {
+		errorResponse(c, http.StatusBadRequest, "回调参数与上传任务不匹配")
+		return
+	}
+
+	job, err = completeUploadJob(c.Request.Context(), job, notification.ETag)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
 
 	successResponse(c, gin.H{
 		"message": "上传完成回调处理成功",
-		"job_id":  jobID,
-		"status":  "completed",
+		"job_id":  job.ID,
+		"status":  string(job.Status),
+		"etag":    job.ETag,
 	})
 }
 
 // ==================== 辅助函数 ====================
 
+// 验证上传任务的文件类型和大小
+func validateUploadJobRequest(req *CreateUploadJobRequest) error {
+	if !ValidateFileType(req.FileType) {
+		return AppError{Code: http.StatusBadRequest, Message: "不支持的文件类型: " + req.FileType}
+	}
+	if !ValidateFileSize(req.FileSize, maxUploadFileSize) {
+		return AppError{Code: http.StatusBadRequest, Message: "文件大小超出限制"}
+	}
+	return nil
+}
+
+// 根据请求生成待上传任务 (尚未保存)
+// 任务按创建时间归属到设备当时安装的树，查询安装记录失败时不创建任务
+func newUploadJob(ctx context.Context, req *CreateUploadJobRequest) (*UploadJob, error) {
+	// 数据库只保存到毫秒，统一截断保证游标分页比较一致
+	now := time.Now().Truncate(time.Millisecond)
+	treeID, err := placementTreeID(ctx, req.DeviceID, now)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadJob{
+		ID:          GenerateJobID(),
+		DeviceID:    req.DeviceID,
+		FileName:    req.FileName,
+		FileSize:    req.FileSize,
+		FileType:    req.FileType,
+		ContentType: req.ContentType,
+		Description: req.Description,
+		Bucket:      defaultBucket,
+		Key:         GenerateStorageKey(req.DeviceID, req.FileName),
+		Status:      JobStatusPending,
+		TTL:         int64(uploadURLTTL / time.Second),
+		ExpiresAt:   now.Add(uploadURLTTL),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		TreeID:      treeID,
+	}, nil
+}
+
+// 设备在指定时间点安装的树ID，没有安装记录时为空
+func placementTreeID(ctx context.Context, deviceID string, at time.Time) (string, error) {
+	placement, err := plantationRepo.PlacementAt(ctx, deviceID, at)
+	if errors.Is(err, ErrPlacementNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return placement.TreeID, nil
+}
+
+// 上传对象需要携带的元数据，完成时通过job_id校验对象归属
+func uploadJobMetadata(job *UploadJob) map[string]string {
+	return map[string]string{
+		"device_id":   job.DeviceID,
+		"job_id":      job.ID,
+		"file_type":   job.FileType,
+		"description": job.Description,
+		"upload_time": job.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// presignUpload 在默认存储桶中为对象生成预签名PUT上传URL (上传任务和附件共用)
+// size为声明的文件大小，本地存储据此限制上传的字节数
+func presignUpload(key, contentType string, size int64, metadata map[string]string, ttl time.Duration) (string, error) {
+	if storageService == nil {
+		return "", ErrStorageService
+	}
+
+	uploadURL, err := storageService.GeneratePresignedUploadURL(PresignedURLParams{
+		Bucket:      defaultBucket,
+		Key:         key,
+		Method:      "PUT",
+		Expires:     ttl,
+		ContentType: contentType,
+		Metadata:    metadata,
+		MaxSize:     size,
+	})
+	if err != nil {
+		return "", AppError{Code: http.StatusInternalServerError, Message: "生成预签名URL失败: " + err.Error()}
+	}
+
+	return uploadURL, nil
+}
+
+// presignPost 为任务生成预签名POST表单，文件大小必须与任务声明的大小一致
+func presignPost(job *UploadJob) (*PresignedPost, error) {
+	if storageService == nil {
+		return nil, ErrStorageService
+	}
+	storage, ok := storageService.(PostPolicyStorage)
+	if !ok {
+		return nil, ErrPostPolicyNotSupported
+	}
+
+	post, err := storage.GeneratePresignedPost(PresignedURLParams{
+		Bucket:      job.Bucket,
+		Key:         job.Key,
+		Method:      "POST",
+		Expires:     uploadURLTTL,
+		ContentType: job.ContentType,
+		Metadata:    uploadJobMetadata(job),
+		MinSize:     job.FileSize,
+		MaxSize:     job.FileSize,
+	})
+	if err != nil {
+		return nil, AppError{Code: http.StatusInternalServerError, Message: "生成预签名POST表单失败: " + err.Error()}
+	}
+
+	return post, nil
+}
+
+// POST表单需要提交的字段，文件字段必须放在最后
+func postFormFieldNames(fields map[string]string) []string {
+	names := make([]string, 0, len(fields)+1)
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, "file")
+}
+
+// limitedUploadReader 限制上传数据的大小，超出时读取报错，使存储服务放弃写入
+type limitedUploadReader struct {
+	r         io.Reader
+	remaining int64 // 还允许读取的字节数
+	read      int64 // 已读取的字节数
+	exceeded  bool  // 数据是否超出限制
+}
+
+func (l *limitedUploadReader) Read(p []byte) (int, error) {
+	// 多读一个字节用于判断是否超出限制
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		l.exceeded = true
+		return 0, ErrFileTooLarge
+	}
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
+}
+
 // 注意：errorResponse 和 successResponse 函数已在 handlers.go 中定义
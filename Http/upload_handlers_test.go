@@ -2,10 +2,14 @@ package httpserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -162,6 +166,9 @@ func TestCreateUploadJobFileTooLarge(t *testing.T) {
 func TestGetUploadJobStatus(t *testing.T) {
 	// 设置测试模式
 	gin.SetMode(gin.TestMode)
+
+	// 预先保存任务
+	seedUploadJob(t, "job_123")
 	
 	// 创建HTTP请求
 	req, _ := http.NewRequest("GET", "/api/v1/jobs/job_123", nil)
@@ -235,6 +242,9 @@ func TestListUploadJobs(t *testing.T) {
 func TestDeleteUploadJob(t *testing.T) {
 	// 设置测试模式
 	gin.SetMode(gin.TestMode)
+
+	// 预先保存任务
+	seedUploadJob(t, "job_123")
 	
 	// 创建HTTP请求
 	req, _ := http.NewRequest("DELETE", "/api/v1/jobs/job_123", nil)
@@ -291,13 +301,14 @@ func TestGenerateStorageKey(t *testing.T) {
 	
 	storageKey := GenerateStorageKey(deviceID, fileName)
 	
-	// 验证格式
+	// 验证格式: 文件名中间会插入唯一后缀
 	assert.Contains(t, storageKey, deviceID)
-	assert.Contains(t, storageKey, fileName)
+	assert.Contains(t, storageKey, "audio_sample_")
+	assert.True(t, strings.HasSuffix(storageKey, ".wav"))
 	assert.Contains(t, storageKey, "/")
 	
 	// 验证时间戳格式
-	assert.Contains(t, storageKey, "2024") // 假设是2024年
+	assert.Contains(t, storageKey, time.Now().Format("2006/01/02"))
 }
 
 func TestValidateFileType(t *testing.T) {
@@ -351,3 +362,73 @@ func TestGetContentType(t *testing.T) {
 	assert.Equal(t, "audio/wav", GetContentType("AUDIO.WAV"))
 	assert.Equal(t, "audio/mpeg", GetContentType("AUDIO.MP3"))
 }
+
+func TestCreateUploadJobPresignedPost(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav","upload_method":"POST"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "POST", data["method"])
+	assert.Equal(t, "http://storage.test/"+defaultBucket, data["upload_url"])
+
+	fields := data["form_fields"].(map[string]interface{})
+	assert.Equal(t, data["key"], fields["key"])
+	assert.Equal(t, "audio/wav", fields["Content-Type"])
+	assert.Equal(t, data["job_id"], fields["x-amz-meta-job_id"])
+
+	// 文件字段必须在最后
+	required := data["required_fields"].([]interface{})
+	assert.Equal(t, "file", required[len(required)-1])
+	assert.Len(t, required, len(fields)+1)
+
+	// 默认仍使用PUT
+	code, data = doJSON(t, router, "POST", "/api/v1/jobs",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "PUT", data["method"])
+	assert.NotContains(t, data, "form_fields")
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav","upload_method":"PATCH"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestCreateUploadJobPresignedPostNotSupported(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = struct{ StorageService }{newMockStorageService()}
+	defer func() { storageService = newMockStorageService() }()
+	router := newTestEngine()
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/jobs",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav","upload_method":"POST"}`)
+	assert.Equal(t, http.StatusNotImplemented, code)
+}
+
+// unavailableStorage 检查对象时返回错误，模拟存储服务故障
+type unavailableStorage struct {
+	*mockStorageService
+}
+
+func (s unavailableStorage) FileExists(bucket, key string) (bool, error) {
+	return false, fmt.Errorf("connection refused")
+}
+
+func (s unavailableStorage) GetFileInfo(bucket, key string) (*FileInfo, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func TestDeleteUploadJobStorageUnavailable(t *testing.T) {
+	job := seedUploadJob(t, "job_delete")
+	storageService = unavailableStorage{newMockStorageService()}
+	defer func() { storageService = newMockStorageService() }()
+	router := newTestEngine()
+
+	// 无法确认对象是否存在时保留任务记录
+	code, _ := doJSON(t, router, "DELETE", "/api/v1/jobs/"+job.ID, "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	_, err := uploadJobRepo.Get(context.Background(), job.ID)
+	assert.NoError(t, err)
+}
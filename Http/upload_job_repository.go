@@ -0,0 +1,652 @@
+package httpserver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"RPW_Detection/db"
+)
+
+// ==================== 上传任务持久化 ====================
+
+// 全局上传任务仓库实例，StartServer中按配置替换
+var uploadJobRepo UploadJobRepository = NewMemoryUploadJobRepository()
+
+// UploadJobFilter 上传任务查询条件，字段为零值表示不过滤
+type UploadJobFilter struct {
+	DeviceID    string           // 设备ID
+	TreeID      string           // 录音所属的树ID
+	Status      UploadJobStatus  // 任务状态
+	FileType    string           // 文件类型
+	FailedOnly  bool             // 只返回记录了失败原因的任务 (包括校验失败后仍可重传的任务)
+	Bucket      string           // 存储桶
+	KeyPrefix   string           // 对象键前缀 (存储对账按派生对象查找源任务)
+	CreatedFrom time.Time        // 创建时间下限 (包含)
+	CreatedTo   time.Time        // 创建时间上限 (不包含)
+	ExpiresTo   time.Time        // 过期时间上限 (不包含)，用于查找已过期任务
+	Ascending   bool             // 按创建时间升序，默认倒序
+	After       *UploadJobCursor // 游标位置，只返回排在其后的任务
+	CountTotal  bool             // 是否统计符合条件的总数 (游标分页时不需要)
+	Offset      int              // 跳过的记录数
+	Limit       int              // 最多返回的记录数，0表示不限制
+}
+
+// UploadJobCursor 游标分页位置 (按创建时间和ID排序的最后一条记录)
+type UploadJobCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// EncodeUploadJobCursor 将游标编码为不透明字符串，同时记录排序方向
+func EncodeUploadJobCursor(cursor UploadJobCursor, ascending bool) string {
+	order := "desc"
+	if ascending {
+		order = "asc"
+	}
+	raw := order + "|" + strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + "|" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeUploadJobCursor 解析游标，返回游标位置和生成时的排序方向
+func DecodeUploadJobCursor(value string) (UploadJobCursor, bool, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return UploadJobCursor{}, false, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || (parts[0] != "asc" && parts[0] != "desc") || parts[2] == "" {
+		return UploadJobCursor{}, false, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return UploadJobCursor{}, false, ErrInvalidCursor
+	}
+
+	return UploadJobCursor{CreatedAt: time.Unix(0, nanos), ID: parts[2]}, parts[0] == "asc", nil
+}
+
+// 判断任务是否符合过滤条件 (不含游标)
+func (f UploadJobFilter) matches(job UploadJob) bool {
+	if f.DeviceID != "" && job.DeviceID != f.DeviceID {
+		return false
+	}
+	if f.TreeID != "" && job.TreeID != f.TreeID {
+		return false
+	}
+	if f.Status != "" && job.Status != f.Status {
+		return false
+	}
+	if f.FileType != "" && job.FileType != f.FileType {
+		return false
+	}
+	if f.FailedOnly && job.FailReason == "" {
+		return false
+	}
+	if f.Bucket != "" && job.Bucket != f.Bucket {
+		return false
+	}
+	if f.KeyPrefix != "" && !strings.HasPrefix(job.Key, f.KeyPrefix) {
+		return false
+	}
+	if !f.CreatedFrom.IsZero() && job.CreatedAt.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !job.CreatedAt.Before(f.CreatedTo) {
+		return false
+	}
+	if !f.ExpiresTo.IsZero() && !job.ExpiresAt.Before(f.ExpiresTo) {
+		return false
+	}
+	return true
+}
+
+// 判断任务a是否排在任务b之前
+func (f UploadJobFilter) before(aCreatedAt time.Time, aID string, bCreatedAt time.Time, bID string) bool {
+	if !aCreatedAt.Equal(bCreatedAt) {
+		return aCreatedAt.Before(bCreatedAt) == f.Ascending
+	}
+	if aID == bID {
+		return false
+	}
+	return (aID < bID) == f.Ascending
+}
+
+// UploadJobRepository 上传任务仓库接口
+type UploadJobRepository interface {
+	// 创建任务
+	Create(ctx context.Context, job *UploadJob) error
+
+	// 获取任务，不存在时返回ErrJobNotFound
+	Get(ctx context.Context, id string) (*UploadJob, error)
+
+	// 按对象位置获取任务 (存储事件回调使用)，不存在时返回ErrJobNotFound
+	GetByObject(ctx context.Context, bucket, key string) (*UploadJob, error)
+
+	// 更新任务，job.Version与已保存的版本不一致时返回ErrJobConflict，不存在时返回ErrJobNotFound
+	// 更新成功后job.Version加1
+	Update(ctx context.Context, job *UploadJob) error
+
+	// 删除任务，不存在时返回ErrJobNotFound
+	Delete(ctx context.Context, id string) error
+
+	// 按条件列出任务，filter.CountTotal为true时同时返回符合条件的总数
+	List(ctx context.Context, filter UploadJobFilter) ([]UploadJob, int, error)
+}
+
+// InitRepositories 根据数据库配置初始化上传任务、种植园、巡检任务和附件仓库
+// DB_DRIVER=memory 时使用内存仓库 (本地开发和测试)，否则连接MySQL；
+// 连接或建表失败时直接返回错误，不会自动退回内存仓库
+func InitRepositories(config *DatabaseConfig) error {
+	if config.Driver == "memory" {
+		uploadJobRepo = NewMemoryUploadJobRepository()
+		plantationRepo = NewMemoryPlantationRepository()
+		inspectionRepo = NewMemoryInspectionRepository()
+		attachmentRepo = NewMemoryAttachmentRepository()
+		log.Printf("上传任务、种植园、巡检和附件数据使用内存存储，重启后数据将丢失")
+		return nil
+	}
+
+	conn, err := db.OpenMySQL(config.GetDSN(), db.PoolOptions{
+		MaxOpenConns: config.MaxOpenConns,
+		MaxIdleConns: config.MaxIdleConns,
+		ConnLifetime: config.ConnLifetime,
+	})
+	if err != nil {
+		return err
+	}
+
+	jobs := NewMySQLUploadJobRepository(conn)
+	if err := jobs.Migrate(context.Background()); err != nil {
+		conn.Close()
+		return err
+	}
+	plantation := NewMySQLPlantationRepository(conn)
+	if err := plantation.Migrate(context.Background()); err != nil {
+		conn.Close()
+		return err
+	}
+	inspections := NewMySQLInspectionRepository(conn)
+	if err := inspections.Migrate(context.Background()); err != nil {
+		conn.Close()
+		return err
+	}
+	attachments := NewMySQLAttachmentRepository(conn)
+	if err := attachments.Migrate(context.Background()); err != nil {
+		conn.Close()
+		return err
+	}
+
+	uploadJobRepo = jobs
+	plantationRepo = plantation
+	inspectionRepo = inspections
+	attachmentRepo = attachments
+	return nil
+}
+
+// 并发修改冲突时的最大尝试次数
+const maxUploadJobUpdateAttempts = 3
+
+// retryUploadJobUpdate 执行一次"读取-修改-保存"，保存时遇到ErrJobConflict则重新读取任务再执行
+// fn每次都会收到最新的任务，必须基于它重新判断状态；重试后job指向的内容同样更新为最新版本
+func retryUploadJobUpdate(ctx context.Context, job *UploadJob, fn func(job *UploadJob) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(job)
+		if !errors.Is(err, ErrJobConflict) || attempt >= maxUploadJobUpdateAttempts {
+			return err
+		}
+
+		latest, getErr := uploadJobRepo.Get(ctx, job.ID)
+		if getErr != nil {
+			return getErr
+		}
+		*job = *latest
+	}
+}
+
+// ==================== 内存实现 ====================
+
+// MemoryUploadJobRepository 内存上传任务仓库
+type MemoryUploadJobRepository struct {
+	mu   sync.RWMutex
+	jobs map[string]UploadJob
+}
+
+// NewMemoryUploadJobRepository 创建内存上传任务仓库
+func NewMemoryUploadJobRepository() *MemoryUploadJobRepository {
+	return &MemoryUploadJobRepository{jobs: make(map[string]UploadJob)}
+}
+
+// Create 创建任务
+func (r *MemoryUploadJobRepository) Create(ctx context.Context, job *UploadJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[job.ID]; ok {
+		return fmt.Errorf("上传任务已存在: %s", job.ID)
+	}
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+// Get 获取任务
+func (r *MemoryUploadJobRepository) Get(ctx context.Context, id string) (*UploadJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+// GetByObject 按对象位置获取任务
+func (r *MemoryUploadJobRepository) GetByObject(ctx context.Context, bucket, key string) (*UploadJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, job := range r.jobs {
+		if job.Bucket == bucket && job.Key == key {
+			return &job, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// Update 更新任务
+func (r *MemoryUploadJobRepository) Update(ctx context.Context, job *UploadJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.jobs[job.ID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if stored.Version != job.Version {
+		return ErrJobConflict
+	}
+	job.Version++
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+// Delete 删除任务
+func (r *MemoryUploadJobRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(r.jobs, id)
+	return nil
+}
+
+// List 列出任务
+func (r *MemoryUploadJobRepository) List(ctx context.Context, filter UploadJobFilter) ([]UploadJob, int, error) {
+	r.mu.RLock()
+	jobs := make([]UploadJob, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		if filter.matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return filter.before(jobs[i].CreatedAt, jobs[i].ID, jobs[j].CreatedAt, jobs[j].ID)
+	})
+
+	total := len(jobs)
+	if filter.After != nil {
+		cursor := filter.After
+		start := sort.Search(len(jobs), func(i int) bool {
+			return filter.before(cursor.CreatedAt, cursor.ID, jobs[i].CreatedAt, jobs[i].ID)
+		})
+		jobs = jobs[start:]
+	}
+
+	if filter.Offset >= len(jobs) {
+		return []UploadJob{}, total, nil
+	}
+	jobs = jobs[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(jobs) {
+		jobs = jobs[:filter.Limit]
+	}
+	return jobs, total, nil
+}
+
+// ==================== MySQL实现 ====================
+
+// 上传任务表结构 (key是MySQL保留字，需要反引号)
+const uploadJobsSchema = "CREATE TABLE IF NOT EXISTS upload_jobs (" +
+	"id VARCHAR(64) NOT NULL PRIMARY KEY," +
+	"device_id VARCHAR(128) NOT NULL," +
+	"tree_id VARCHAR(64) NOT NULL DEFAULT ''," +
+	"file_name VARCHAR(255) NOT NULL," +
+	"file_size BIGINT NOT NULL," +
+	"file_type VARCHAR(16) NOT NULL," +
+	"content_type VARCHAR(128) NOT NULL," +
+	"description TEXT NOT NULL," +
+	"bucket VARCHAR(128) NOT NULL," +
+	"`key` VARCHAR(512) NOT NULL," +
+	"status VARCHAR(16) NOT NULL," +
+	"upload_url TEXT NOT NULL," +
+	"etag VARCHAR(128) NOT NULL DEFAULT ''," +
+	"fail_reason VARCHAR(512) NOT NULL DEFAULT ''," +
+	"upload_id VARCHAR(255) NOT NULL DEFAULT ''," +
+	"part_size BIGINT NOT NULL DEFAULT 0," +
+	"ttl BIGINT NOT NULL," +
+	"expires_at DATETIME(3) NOT NULL," +
+	"created_at DATETIME(3) NOT NULL," +
+	"updated_at DATETIME(3) NOT NULL," +
+	"version BIGINT NOT NULL DEFAULT 0," +
+	"KEY idx_upload_jobs_device_created (device_id, created_at)," +
+	"KEY idx_upload_jobs_status_created (status, created_at)," +
+	"KEY idx_upload_jobs_tree_created (tree_id, created_at)," +
+	"UNIQUE KEY uk_upload_jobs_object (bucket, `key`)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+// 查询列 (顺序与scanUploadJob一致)
+const uploadJobColumns = "id, device_id, tree_id, file_name, file_size, file_type, content_type, description, " +
+	"bucket, `key`, status, upload_url, etag, fail_reason, " +
+	"upload_id, part_size, ttl, expires_at, created_at, updated_at, version"
+
+// 查询upload_jobs表已有的列
+const uploadJobsColumnsQuery = "SELECT COLUMN_NAME FROM information_schema.COLUMNS " +
+	"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'upload_jobs'"
+
+// 初版upload_jobs表之后新增的列，Migrate按顺序为早期版本创建的表补齐
+var uploadJobsAddedColumns = []struct {
+	name       string
+	definition string
+}{
+	{"etag", "VARCHAR(128) NOT NULL DEFAULT ''"},
+	{"fail_reason", "VARCHAR(512) NOT NULL DEFAULT ''"},
+	{"upload_id", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{"part_size", "BIGINT NOT NULL DEFAULT 0"},
+	{"version", "BIGINT NOT NULL DEFAULT 0"},
+	{"tree_id", "VARCHAR(64) NOT NULL DEFAULT '', ADD KEY idx_upload_jobs_tree_created (tree_id, created_at)"},
+}
+
+// MySQLUploadJobRepository MySQL上传任务仓库
+type MySQLUploadJobRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLUploadJobRepository 创建MySQL上传任务仓库
+func NewMySQLUploadJobRepository(conn *sql.DB) *MySQLUploadJobRepository {
+	return &MySQLUploadJobRepository{db: conn}
+}
+
+// Migrate 创建上传任务表，并为早期版本创建的表补充缺少的列
+func (r *MySQLUploadJobRepository) Migrate(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, uploadJobsSchema); err != nil {
+		return fmt.Errorf("创建upload_jobs表失败: %v", err)
+	}
+
+	existing, err := r.existingColumns(ctx)
+	if err != nil {
+		return fmt.Errorf("检查upload_jobs表结构失败: %v", err)
+	}
+	for _, column := range uploadJobsAddedColumns {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := r.db.ExecContext(ctx, "ALTER TABLE upload_jobs ADD COLUMN "+column.name+" "+column.definition); err != nil {
+			return fmt.Errorf("添加upload_jobs.%s列失败: %v", column.name, err)
+		}
+	}
+	return nil
+}
+
+// 读取upload_jobs表已有的列名
+func (r *MySQLUploadJobRepository) existingColumns(ctx context.Context) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, uploadJobsColumnsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = true
+	}
+	return columns, rows.Err()
+}
+
+// Create 创建任务
+func (r *MySQLUploadJobRepository) Create(ctx context.Context, job *UploadJob) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO upload_jobs ("+uploadJobColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		job.ID, job.DeviceID, job.TreeID, job.FileName, job.FileSize, job.FileType, job.ContentType, job.Description,
+		job.Bucket, job.Key, string(job.Status), job.UploadURL, job.ETag, job.FailReason,
+		job.UploadID, job.PartSize, job.TTL, job.ExpiresAt, job.CreatedAt, job.UpdatedAt, job.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("保存上传任务失败: %v", err)
+	}
+	return nil
+}
+
+// Get 获取任务
+func (r *MySQLUploadJobRepository) Get(ctx context.Context, id string) (*UploadJob, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+uploadJobColumns+" FROM upload_jobs WHERE id = ?", id)
+	job, err := scanUploadJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询上传任务失败: %v", err)
+	}
+	return job, nil
+}
+
+// GetByObject 按对象位置获取任务
+func (r *MySQLUploadJobRepository) GetByObject(ctx context.Context, bucket, key string) (*UploadJob, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+uploadJobColumns+" FROM upload_jobs WHERE bucket = ? AND `key` = ?", bucket, key)
+	job, err := scanUploadJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询上传任务失败: %v", err)
+	}
+	return job, nil
+}
+
+// Update 按版本号条件更新任务 (compare-and-swap)
+func (r *MySQLUploadJobRepository) Update(ctx context.Context, job *UploadJob) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE upload_jobs SET device_id = ?, tree_id = ?, file_name = ?, file_size = ?, file_type = ?, content_type = ?, "+
+			"description = ?, bucket = ?, `key` = ?, status = ?, upload_url = ?, etag = ?, fail_reason = ?, "+
+			"upload_id = ?, part_size = ?, ttl = ?, expires_at = ?, updated_at = ?, version = version + 1 "+
+			"WHERE id = ? AND version = ?",
+		job.DeviceID, job.TreeID, job.FileName, job.FileSize, job.FileType, job.ContentType,
+		job.Description, job.Bucket, job.Key, string(job.Status), job.UploadURL, job.ETag, job.FailReason,
+		job.UploadID, job.PartSize, job.TTL, job.ExpiresAt, job.UpdatedAt,
+		job.ID, job.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("更新上传任务失败: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("更新上传任务失败: %v", err)
+	}
+	// version每次都会变化，没有匹配的行说明任务不存在或已被其他请求修改
+	if affected == 0 {
+		if _, err := r.Get(ctx, job.ID); err != nil {
+			return err
+		}
+		return ErrJobConflict
+	}
+	job.Version++
+	return nil
+}
+
+// Delete 删除任务
+func (r *MySQLUploadJobRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM upload_jobs WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("删除上传任务失败: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// List 列出任务
+func (r *MySQLUploadJobRepository) List(ctx context.Context, filter UploadJobFilter) ([]UploadJob, int, error) {
+	where, args := filter.whereClause()
+
+	total := 0
+	if filter.CountTotal {
+		if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM upload_jobs"+where, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("统计上传任务失败: %v", err)
+		}
+	}
+
+	query := strings.Builder{}
+	query.WriteString("SELECT " + uploadJobColumns + " FROM upload_jobs")
+
+	// 游标条件只影响本页数据，不影响总数
+	if filter.After != nil {
+		op := "<"
+		if filter.Ascending {
+			op = ">"
+		}
+		if where == "" {
+			query.WriteString(" WHERE ")
+		} else {
+			query.WriteString(where + " AND ")
+		}
+		query.WriteString("(created_at " + op + " ? OR (created_at = ? AND id " + op + " ?))")
+		args = append(args, filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	} else {
+		query.WriteString(where)
+	}
+
+	if filter.Ascending {
+		query.WriteString(" ORDER BY created_at ASC, id ASC")
+	} else {
+		query.WriteString(" ORDER BY created_at DESC, id DESC")
+	}
+	if filter.Limit > 0 {
+		query.WriteString(" LIMIT ? OFFSET ?")
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询上传任务失败: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]UploadJob, 0)
+	for rows.Next() {
+		job, err := scanUploadJob(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取上传任务失败: %v", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("读取上传任务失败: %v", err)
+	}
+
+	return jobs, total, nil
+}
+
+// 生成过滤条件对应的WHERE子句 (不含游标)
+func (f UploadJobFilter) whereClause() (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if f.DeviceID != "" {
+		conditions = append(conditions, "device_id = ?")
+		args = append(args, f.DeviceID)
+	}
+	if f.TreeID != "" {
+		conditions = append(conditions, "tree_id = ?")
+		args = append(args, f.TreeID)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(f.Status))
+	}
+	if f.FileType != "" {
+		conditions = append(conditions, "file_type = ?")
+		args = append(args, f.FileType)
+	}
+	if f.FailedOnly {
+		conditions = append(conditions, "fail_reason <> ''")
+	}
+	if f.Bucket != "" {
+		conditions = append(conditions, "bucket = ?")
+		args = append(args, f.Bucket)
+	}
+	if f.KeyPrefix != "" {
+		conditions = append(conditions, "`key` LIKE ?")
+		args = append(args, escapeLikePattern(f.KeyPrefix)+"%")
+	}
+	if !f.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, f.CreatedTo)
+	}
+	if !f.ExpiresTo.IsZero() {
+		conditions = append(conditions, "expires_at < ?")
+		args = append(args, f.ExpiresTo)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// 转义LIKE模式中的通配符 (MySQL默认转义字符为反斜杠)
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// 行扫描接口 (*sql.Row 和 *sql.Rows)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// 扫描一行上传任务
+func scanUploadJob(row rowScanner) (*UploadJob, error) {
+	var job UploadJob
+	var status string
+	err := row.Scan(
+		&job.ID, &job.DeviceID, &job.TreeID, &job.FileName, &job.FileSize, &job.FileType, &job.ContentType, &job.Description,
+		&job.Bucket, &job.Key, &status, &job.UploadURL, &job.ETag, &job.FailReason,
+		&job.UploadID, &job.PartSize, &job.TTL, &job.ExpiresAt, &job.CreatedAt, &job.UpdatedAt, &job.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	job.Status = UploadJobStatus(status)
+	return &job, nil
+}
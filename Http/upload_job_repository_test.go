@@ -0,0 +1,422 @@
+package httpserver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// 重置上传任务仓库并保存一个待上传任务
+func seedUploadJob(t *testing.T, id string) *UploadJob {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	job := newTestUploadJob(id, time.Now())
+	assert.NoError(t, uploadJobRepo.Create(context.Background(), job))
+	return job
+}
+
+func newTestUploadJob(id string, createdAt time.Time) *UploadJob {
+	return &UploadJob{
+		ID:          id,
+		DeviceID:    "dev_001",
+		FileName:    "audio_sample.wav",
+		FileSize:    1024000,
+		FileType:    "wav",
+		ContentType: "audio/wav",
+		Bucket:      defaultBucket,
+		Key:         "dev_001/" + id + ".wav",
+		Status:      JobStatusPending,
+		TTL:         3600,
+		ExpiresAt:   createdAt.Add(time.Hour),
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+	}
+}
+
+func TestMemoryUploadJobRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUploadJobRepository()
+	now := time.Now()
+
+	for i, id := range []string{"job_a", "job_b", "job_c"} {
+		assert.NoError(t, repo.Create(ctx, newTestUploadJob(id, now.Add(time.Duration(i)*time.Minute))))
+	}
+	assert.Error(t, repo.Create(ctx, newTestUploadJob("job_a", now)))
+
+	// 返回副本，修改不影响仓库
+	job, err := repo.Get(ctx, "job_a")
+	assert.NoError(t, err)
+	job.Status = JobStatusCompleted
+	stored, _ := repo.Get(ctx, "job_a")
+	assert.Equal(t, JobStatusPending, stored.Status)
+
+	assert.NoError(t, repo.Update(ctx, job))
+	stored, _ = repo.Get(ctx, "job_a")
+	assert.Equal(t, JobStatusCompleted, stored.Status)
+	assert.Equal(t, int64(1), job.Version)
+	assert.Equal(t, int64(1), stored.Version)
+
+	// 基于旧版本的更新被拒绝，不覆盖其他请求的修改
+	stale := *job
+	stale.Version = 0
+	stale.Status = JobStatusFailed
+	assert.Equal(t, ErrJobConflict, repo.Update(ctx, &stale))
+	stored, _ = repo.Get(ctx, "job_a")
+	assert.Equal(t, JobStatusCompleted, stored.Status)
+
+	// 按创建时间倒序分页
+	jobs, total, err := repo.List(ctx, UploadJobFilter{Offset: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "job_b", jobs[0].ID)
+
+	jobs, _, _ = repo.List(ctx, UploadJobFilter{Offset: 5, Limit: 1})
+	assert.Empty(t, jobs)
+
+	assert.NoError(t, repo.Delete(ctx, "job_a"))
+	_, err = repo.Get(ctx, "job_a")
+	assert.Equal(t, ErrJobNotFound, err)
+	assert.Equal(t, ErrJobNotFound, repo.Delete(ctx, "job_a"))
+	assert.Equal(t, ErrJobNotFound, repo.Update(ctx, newTestUploadJob("job_missing", now)))
+}
+
+func TestUploadJobLifecycle(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	jobID := data["job_id"].(string)
+	key := data["key"].(string)
+
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "dev_001", data["device_id"])
+	assert.Equal(t, "pending", data["status"])
+
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs?page_size=10", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), data["total"])
+	assert.Equal(t, float64(1), data["total_pages"])
+
+	// 模拟客户端通过预签名URL上传
+	storage.PutObject(defaultBucket, key, strings.NewReader(strings.Repeat("a", 1000)), "audio/wav",
+		map[string]string{"job_id": jobID})
+
+	code, data = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/complete",
+		`{"job_id":"`+jobID+`","bucket":"`+defaultBucket+`","key":"`+key+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", data["status"])
+
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", data["status"])
+
+	// 删除任务同时删除对象
+	code, _ = doJSON(t, router, "DELETE", "/api/v1/jobs/"+jobID, "")
+	assert.Equal(t, http.StatusOK, code)
+	exists, _ := storage.FileExists(defaultBucket, key)
+	assert.False(t, exists)
+
+	code, _ = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestListUploadJobsFilters(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	router := newTestEngine()
+	ctx := context.Background()
+	base := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		job := newTestUploadJob("job_"+string(rune('a'+i)), base.Add(time.Duration(i)*time.Hour))
+		if i%2 == 1 {
+			job.DeviceID = "dev_002"
+			job.FileType = "mp3"
+			job.Status = JobStatusCompleted
+		}
+		assert.NoError(t, uploadJobRepo.Create(ctx, job))
+	}
+
+	code, data := doJSON(t, router, "GET", "/api/v1/jobs?device_id=dev_002", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), data["total"])
+
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs?status=pending&file_type=WAV&page_size=2", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), data["total"])
+	assert.Equal(t, float64(2), data["total_pages"])
+	jobs := data["data"].([]interface{})
+	assert.Equal(t, "job_e", jobs[0].(map[string]interface{})["id"])
+
+	// 创建时间范围 [from, to)
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs?order=asc&created_from=2024-01-15T09:00:00Z&created_to=2024-01-15T11:00:00Z", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), data["total"])
+	jobs = data["data"].([]interface{})
+	assert.Equal(t, "job_b", jobs[0].(map[string]interface{})["id"])
+	assert.Equal(t, "job_c", jobs[1].(map[string]interface{})["id"])
+
+	for _, query := range []string{"status=unknown", "order=random", "created_from=yesterday",
+		"created_from=2024-01-16T00:00:00Z&created_to=2024-01-15T00:00:00Z", "cursor=bogus"} {
+		code, _ = doJSON(t, router, "GET", "/api/v1/jobs?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestListUploadJobsCursor(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	router := newTestEngine()
+	base := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	// 相同创建时间按ID排序，保证翻页不重复不遗漏
+	for i := 0; i < 5; i++ {
+		createdAt := base.Add(time.Duration(i/2) * time.Minute)
+		assert.NoError(t, uploadJobRepo.Create(context.Background(), newTestUploadJob("job_"+string(rune('a'+i)), createdAt)))
+	}
+
+	var seen []string
+	cursor := ""
+	for {
+		code, data := doJSON(t, router, "GET", "/api/v1/jobs?page_size=2&cursor="+cursor, "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotContains(t, data, "total")
+		for _, job := range data["data"].([]interface{}) {
+			seen = append(seen, job.(map[string]interface{})["id"].(string))
+		}
+		if data["has_more"] != true {
+			assert.Empty(t, data["next_cursor"])
+			break
+		}
+		cursor = data["next_cursor"].(string)
+	}
+	assert.Equal(t, []string{"job_e", "job_d", "job_c", "job_b", "job_a"}, seen)
+
+	// 游标不能跨排序方向使用
+	code, _ := doJSON(t, router, "GET", "/api/v1/jobs?order=asc&cursor="+cursor, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestUploadJobCursorEncoding(t *testing.T) {
+	cursor := UploadJobCursor{CreatedAt: time.Date(2024, 1, 15, 8, 0, 0, 123000000, time.UTC), ID: "job_abc"}
+
+	decoded, ascending, err := DecodeUploadJobCursor(EncodeUploadJobCursor(cursor, true))
+	assert.NoError(t, err)
+	assert.True(t, ascending)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, "job_abc", decoded.ID)
+
+	_, _, err = DecodeUploadJobCursor("not-a-cursor")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+// ==================== MySQL实现 ====================
+
+func newMockUploadJobRepository(t *testing.T) (*MySQLUploadJobRepository, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("创建sqlmock失败: %v", err)
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		conn.Close()
+	})
+	return NewMySQLUploadJobRepository(conn), mock
+}
+
+// 按uploadJobColumns的顺序生成查询结果
+func uploadJobRows(jobs ...*UploadJob) *sqlmock.Rows {
+	rows := sqlmock.NewRows(strings.Split(strings.ReplaceAll(strings.ReplaceAll(uploadJobColumns, "`", ""), " ", ""), ","))
+	for _, job := range jobs {
+		rows.AddRow(job.ID, job.DeviceID, job.TreeID, job.FileName, job.FileSize, job.FileType, job.ContentType, job.Description,
+			job.Bucket, job.Key, string(job.Status), job.UploadURL, job.ETag, job.FailReason,
+			job.UploadID, job.PartSize, job.TTL, job.ExpiresAt, job.CreatedAt, job.UpdatedAt, job.Version)
+	}
+	return rows
+}
+
+const (
+	selectUploadJobByID = "SELECT " + uploadJobColumns + " FROM upload_jobs WHERE id = ?"
+	updateUploadJob     = "UPDATE upload_jobs SET device_id = ?, tree_id = ?, file_name = ?, file_size = ?, file_type = ?, content_type = ?, " +
+		"description = ?, bucket = ?, `key` = ?, status = ?, upload_url = ?, etag = ?, fail_reason = ?, " +
+		"upload_id = ?, part_size = ?, ttl = ?, expires_at = ?, updated_at = ?, version = version + 1 " +
+		"WHERE id = ? AND version = ?"
+)
+
+func TestMySQLUploadJobRepositoryMigrate(t *testing.T) {
+	repo, mock := newMockUploadJobRepository(t)
+
+	// 初版创建的表缺少后续新增的全部列
+	initial := sqlmock.NewRows([]string{"COLUMN_NAME"})
+	for _, name := range []string{"id", "device_id", "file_name", "file_size", "file_type", "content_type", "description",
+		"bucket", "key", "status", "upload_url", "ttl", "expires_at", "created_at", "updated_at"} {
+		initial.AddRow(name)
+	}
+	mock.ExpectExec(uploadJobsSchema).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(uploadJobsColumnsQuery).WillReturnRows(initial)
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN etag VARCHAR(128) NOT NULL DEFAULT ''").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN fail_reason VARCHAR(512) NOT NULL DEFAULT ''").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN upload_id VARCHAR(255) NOT NULL DEFAULT ''").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN part_size BIGINT NOT NULL DEFAULT 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN version BIGINT NOT NULL DEFAULT 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN tree_id VARCHAR(64) NOT NULL DEFAULT '', " +
+		"ADD KEY idx_upload_jobs_tree_created (tree_id, created_at)").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, repo.Migrate(context.Background()))
+
+	// 只补齐缺少的列
+	partial := sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("ETAG").AddRow("fail_reason").AddRow("upload_id").AddRow("part_size").AddRow("tree_id")
+	mock.ExpectExec(uploadJobsSchema).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(uploadJobsColumnsQuery).WillReturnRows(partial)
+	mock.ExpectExec("ALTER TABLE upload_jobs ADD COLUMN version BIGINT NOT NULL DEFAULT 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, repo.Migrate(context.Background()))
+
+	// 列齐全时不再修改表结构
+	complete := sqlmock.NewRows([]string{"COLUMN_NAME"})
+	for _, column := range uploadJobsAddedColumns {
+		complete.AddRow(column.name)
+	}
+	mock.ExpectExec(uploadJobsSchema).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(uploadJobsColumnsQuery).WillReturnRows(complete)
+	assert.NoError(t, repo.Migrate(context.Background()))
+}
+
+func TestMySQLUploadJobRepositoryCreateGet(t *testing.T) {
+	repo, mock := newMockUploadJobRepository(t)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	job := newTestUploadJob("job_a", now)
+
+	mock.ExpectExec("INSERT INTO upload_jobs ("+uploadJobColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(job.ID, job.DeviceID, job.TreeID, job.FileName, job.FileSize, job.FileType, job.ContentType, job.Description,
+			job.Bucket, job.Key, "pending", job.UploadURL, job.ETag, job.FailReason,
+			job.UploadID, job.PartSize, job.TTL, job.ExpiresAt, job.CreatedAt, job.UpdatedAt, int64(0)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, repo.Create(ctx, job))
+
+	mock.ExpectQuery(selectUploadJobByID).WithArgs("job_a").WillReturnRows(uploadJobRows(job))
+	stored, err := repo.Get(ctx, "job_a")
+	assert.NoError(t, err)
+	assert.Equal(t, job, stored)
+
+	mock.ExpectQuery("SELECT "+uploadJobColumns+" FROM upload_jobs WHERE bucket = ? AND `key` = ?").
+		WithArgs(job.Bucket, job.Key).WillReturnRows(uploadJobRows(job))
+	stored, err = repo.GetByObject(ctx, job.Bucket, job.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, "job_a", stored.ID)
+
+	// 查询不到记录映射为ErrJobNotFound，其他错误原样包装
+	mock.ExpectQuery(selectUploadJobByID).WithArgs("job_missing").WillReturnRows(uploadJobRows())
+	_, err = repo.Get(ctx, "job_missing")
+	assert.Equal(t, ErrJobNotFound, err)
+
+	mock.ExpectQuery(selectUploadJobByID).WithArgs("job_a").WillReturnError(errors.New("connection refused"))
+	_, err = repo.Get(ctx, "job_a")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrJobNotFound, err)
+
+	mock.ExpectExec("DELETE FROM upload_jobs WHERE id = ?").WithArgs("job_missing").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, ErrJobNotFound, repo.Delete(ctx, "job_missing"))
+}
+
+func TestMySQLUploadJobRepositoryUpdate(t *testing.T) {
+	repo, mock := newMockUploadJobRepository(t)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	job := newTestUploadJob("job_a", now)
+	job.Version = 3
+	job.Status = JobStatusCompleted
+
+	updateArgs := func(job *UploadJob) []driver.Value {
+		return []driver.Value{job.DeviceID, job.TreeID, job.FileName, job.FileSize, job.FileType, job.ContentType,
+			job.Description, job.Bucket, job.Key, string(job.Status), job.UploadURL, job.ETag, job.FailReason,
+			job.UploadID, job.PartSize, job.TTL, job.ExpiresAt, job.UpdatedAt, job.ID, job.Version}
+	}
+
+	// 版本号匹配时更新，并同步内存中的版本号
+	mock.ExpectExec(updateUploadJob).WithArgs(updateArgs(job)...).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.Update(ctx, job))
+	assert.Equal(t, int64(4), job.Version)
+
+	// 没有匹配的行但记录存在: 已被其他请求修改
+	stored := *job
+	stored.Version = 5
+	mock.ExpectExec(updateUploadJob).WithArgs(updateArgs(job)...).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectUploadJobByID).WithArgs("job_a").WillReturnRows(uploadJobRows(&stored))
+	assert.Equal(t, ErrJobConflict, repo.Update(ctx, job))
+	assert.Equal(t, int64(4), job.Version)
+
+	// 没有匹配的行且记录不存在
+	missing := newTestUploadJob("job_missing", now)
+	mock.ExpectExec(updateUploadJob).WithArgs(updateArgs(missing)...).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectUploadJobByID).WithArgs("job_missing").WillReturnRows(uploadJobRows())
+	assert.Equal(t, ErrJobNotFound, repo.Update(ctx, missing))
+}
+
+func TestMySQLUploadJobRepositoryList(t *testing.T) {
+	repo, mock := newMockUploadJobRepository(t)
+	ctx := context.Background()
+	base := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	jobA := newTestUploadJob("job_a", base)
+	jobB := newTestUploadJob("job_b", base.Add(time.Minute))
+
+	// 过滤条件同时作用于总数和数据，分页参数只作用于数据
+	filter := UploadJobFilter{
+		DeviceID:    "dev_001",
+		Status:      JobStatusPending,
+		FileType:    "wav",
+		CreatedFrom: base,
+		CreatedTo:   base.Add(time.Hour),
+		CountTotal:  true,
+		Offset:      2,
+		Limit:       10,
+	}
+	where := " WHERE device_id = ? AND status = ? AND file_type = ? AND created_at >= ? AND created_at < ?"
+	mock.ExpectQuery("SELECT COUNT(*) FROM upload_jobs"+where).
+		WithArgs("dev_001", "pending", "wav", base, base.Add(time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+	mock.ExpectQuery("SELECT "+uploadJobColumns+" FROM upload_jobs"+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?").
+		WithArgs("dev_001", "pending", "wav", base, base.Add(time.Hour), 10, 2).
+		WillReturnRows(uploadJobRows(jobB, jobA))
+	jobs, total, err := repo.List(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 12, total)
+	assert.Equal(t, []UploadJob{*jobB, *jobA}, jobs)
+
+	// 游标分页: 升序时取排在游标之后的记录，不统计总数
+	cursor := &UploadJobCursor{CreatedAt: base, ID: "job_a"}
+	mock.ExpectQuery("SELECT "+uploadJobColumns+" FROM upload_jobs WHERE expires_at < ? AND "+
+		"(created_at > ? OR (created_at = ? AND id > ?)) ORDER BY created_at ASC, id ASC LIMIT ? OFFSET ?").
+		WithArgs(base.Add(time.Hour), base, base, "job_a", 100, 0).
+		WillReturnRows(uploadJobRows(jobB))
+	jobs, total, err = repo.List(ctx, UploadJobFilter{ExpiresTo: base.Add(time.Hour), Ascending: true, After: cursor, Limit: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Equal(t, []UploadJob{*jobB}, jobs)
+
+	// 降序游标且没有其他条件
+	mock.ExpectQuery("SELECT "+uploadJobColumns+" FROM upload_jobs WHERE "+
+		"(created_at < ? OR (created_at = ? AND id < ?)) ORDER BY created_at DESC, id DESC").
+		WithArgs(base, base, "job_a").
+		WillReturnRows(uploadJobRows())
+	jobs, _, err = repo.List(ctx, UploadJobFilter{After: cursor})
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	// 对象键前缀中的LIKE通配符按字面匹配
+	mock.ExpectQuery("SELECT "+uploadJobColumns+" FROM upload_jobs WHERE bucket = ? AND `key` LIKE ? ORDER BY created_at DESC, id DESC").
+		WithArgs("audio", `dev\_001/100\%.`+"%").
+		WillReturnRows(uploadJobRows(jobA))
+	jobs, _, err = repo.List(ctx, UploadJobFilter{Bucket: "audio", KeyPrefix: "dev_001/100%."})
+	assert.NoError(t, err)
+	assert.Equal(t, []UploadJob{*jobA}, jobs)
+}
@@ -0,0 +1,455 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 上传任务维护 ====================
+
+const (
+	uploadMaintenanceBatchSize = 100              // 每批处理的任务数
+	minOrphanGracePeriod       = 10 * time.Minute // 孤儿对象宽限期下限，避免删除刚上传、任务尚未保存的对象
+)
+
+// 手动对账接口的配置，由StartUploadMaintenance按UploadConfig设置
+var (
+	storageAdminToken    string          // 存储管理接口的认证令牌，与存储事件回调密钥分开
+	reconcileGracePeriod = 1 * time.Hour // 手动对账未指定grace_period时使用的宽限期
+)
+
+// ReconcileReport 存储对账结果
+type ReconcileReport struct {
+	ScannedObjects int       `json:"scanned_objects"`          // 扫描的上传对象数
+	ScannedJobs    int       `json:"scanned_jobs"`             // 扫描的已完成任务数
+	OrphanObjects  []string  `json:"orphan_objects"`           // 没有对应任务的对象键
+	Unreferenced   []string  `json:"unreferenced_attachments"` // 没有附件记录的附件对象键，只报告不删除 (内存存储时附件记录重启后丢失)
+	MissingObjects []string  `json:"missing_objects"`          // 对象已丢失的已完成任务ID
+	StaleObjects   []string  `json:"stale_objects"`            // 已失败或已过期任务残留的对象键
+	Repaired       bool      `json:"repaired"`                 // 是否已修复 (删除孤儿对象和残留对象、标记任务失败)
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+}
+
+// StartUploadMaintenance 在后台定期清理过期任务，并按配置进行存储对账，ctx取消时退出
+func StartUploadMaintenance(ctx context.Context, config *UploadConfig) {
+	storageAdminToken = config.AdminToken
+	reconcileGracePeriod = config.OrphanGracePeriod
+
+	go func() {
+		// 间隔为0时不启用对应的定时任务，对账仍可通过接口手动触发
+		var sweep, reconcile <-chan time.Time
+		if config.SweepInterval > 0 {
+			ticker := time.NewTicker(config.SweepInterval)
+			defer ticker.Stop()
+			sweep = ticker.C
+		}
+		if config.ReconcileInterval > 0 {
+			ticker := time.NewTicker(config.ReconcileInterval)
+			defer ticker.Stop()
+			reconcile = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sweep:
+				n, err := ExpireUploadJobs(ctx, time.Now())
+				if err != nil {
+					log.Printf("清理过期上传任务失败: %v", err)
+				}
+				if n > 0 {
+					log.Printf("已将 %d 个上传任务标记为过期", n)
+				}
+				n, err = ExpireAttachments(ctx, time.Now())
+				if err != nil {
+					log.Printf("清理过期附件失败: %v", err)
+				}
+				if n > 0 {
+					log.Printf("已将 %d 个附件标记为过期", n)
+				}
+			case <-reconcile:
+				report, err := ReconcileUploadObjects(ctx, config.ReconcileRepair, config.OrphanGracePeriod)
+				if err != nil {
+					log.Printf("存储对账失败: %v", err)
+					continue
+				}
+				if len(report.OrphanObjects) > 0 || len(report.MissingObjects) > 0 || len(report.StaleObjects) > 0 ||
+					len(report.Unreferenced) > 0 {
+					log.Printf("存储对账: 孤儿对象 %d 个，对象丢失的任务 %d 个，失败/过期任务残留对象 %d 个，无记录的附件对象 %d 个，已修复: %v",
+						len(report.OrphanObjects), len(report.MissingObjects), len(report.StaleObjects),
+						len(report.Unreferenced), report.Repaired)
+				}
+			}
+		}
+	}()
+}
+
+// ExpireUploadJobs 将超过ExpiresAt仍未完成的任务标记为过期，并删除残留的不完整对象
+// 对象已完整上传但设备未回调的任务会被补完成，而不是过期
+func ExpireUploadJobs(ctx context.Context, now time.Time) (int, error) {
+	if storageService == nil {
+		return 0, ErrStorageService
+	}
+
+	expired := 0
+	for _, status := range []UploadJobStatus{JobStatusPending, JobStatusUploading} {
+		filter := UploadJobFilter{
+			Status:    status,
+			ExpiresTo: now,
+			Ascending: true,
+			Limit:     uploadMaintenanceBatchSize,
+		}
+
+		// 处理过的任务状态会改变，用游标翻页避免跳过记录
+		for {
+			jobs, _, err := uploadJobRepo.List(ctx, filter)
+			if err != nil {
+				return expired, err
+			}
+
+			for i := range jobs {
+				ok, err := expireUploadJob(ctx, &jobs[i], now)
+				if err != nil {
+					log.Printf("过期上传任务 %s 失败: %v", jobs[i].ID, err)
+					continue
+				}
+				if ok {
+					expired++
+				}
+			}
+
+			if len(jobs) < filter.Limit {
+				break
+			}
+			last := jobs[len(jobs)-1]
+			filter.After = &UploadJobCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+	}
+
+	return expired, nil
+}
+
+// 过期单个任务，返回任务是否被标记为过期
+// 任务在处理期间被并发修改时重新读取，按最新状态重新判断
+func expireUploadJob(ctx context.Context, job *UploadJob, now time.Time) (bool, error) {
+	expired := false
+	err := retryUploadJobUpdate(ctx, job, func(job *UploadJob) error {
+		var err error
+		expired, err = tryExpireUploadJob(ctx, job, now)
+		return err
+	})
+	return expired, err
+}
+
+func tryExpireUploadJob(ctx context.Context, job *UploadJob, now time.Time) (bool, error) {
+	// 重新读取后任务可能已完成或不再过期
+	if (job.Status != JobStatusPending && job.Status != JobStatusUploading) || !job.ExpiresAt.Before(now) {
+		return false, nil
+	}
+
+	exists, err := storageService.FileExists(job.Bucket, job.Key)
+	if err != nil {
+		return false, err
+	}
+
+	job.FailReason = "上传超时"
+	if !exists {
+		// 分片尚未合并时释放已上传的分片
+		abortUnfinishedMultipart(job)
+		discardTusChunks(job)
+	} else {
+		info, err := storageService.GetFileInfo(job.Bucket, job.Key)
+		if err != nil {
+			return false, err
+		}
+
+		// 设备已上传完成但没有回调，补完成任务
+		if verifyUploadedObject(job, info, "") == "" {
+			_, err := completeUploadJob(ctx, job, "")
+			return false, err
+		}
+
+		if err := storageService.DeleteFile(job.Bucket, job.Key); err != nil {
+			return false, err
+		}
+		job.FailReason = "上传超时，已删除不完整的对象"
+	}
+
+	job.Status = JobStatusExpired
+	job.UpdatedAt = now.Truncate(time.Millisecond)
+	if err := uploadJobRepo.Update(ctx, job); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExpireAttachments 将超过ExpiresAt仍未确认上传的附件标记为过期，并删除可能已上传的对象
+func ExpireAttachments(ctx context.Context, now time.Time) (int, error) {
+	if storageService == nil {
+		return 0, nil
+	}
+
+	attachments, err := attachmentRepo.List(ctx, AttachmentFilter{Status: AttachmentPending, ExpiresTo: now})
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, attachment := range attachments {
+
+		// 删除失败时保留pending状态，下次清理重试
+		if err := storageService.DeleteFile(attachment.Bucket, attachment.Key); err != nil {
+			log.Printf("删除过期附件 %s 的对象失败: %v", attachment.ID, err)
+			continue
+		}
+
+		_, err := attachmentRepo.Update(ctx, attachment.ID, func(a *Attachment) {
+			// 清理期间附件可能已确认上传
+			if a.Status != AttachmentPending {
+				return
+			}
+			a.Status = AttachmentExpired
+			a.FailReason = "上传超时"
+			expired++
+		})
+		if err != nil {
+			log.Printf("过期附件 %s 失败: %v", attachment.ID, err)
+		}
+	}
+	return expired, nil
+}
+
+// ReconcileUploadObjects 对比存储桶与任务表，找出没有任务的对象、对象已丢失的已完成任务，
+// 以及已失败或已过期任务残留的对象。附件对象 (含缩略图) 与附件记录对比，没有记录的只报告，
+// 修复时也不删除 (DB_DRIVER=memory 时附件记录重启后为空，对象仍可能有用)。
+// repair为true时删除孤儿对象和残留对象，并把对象丢失的任务标记为失败
+// gracePeriod小于minOrphanGracePeriod时按minOrphanGracePeriod处理
+func ReconcileUploadObjects(ctx context.Context, repair bool, gracePeriod time.Duration) (*ReconcileReport, error) {
+	if storageService == nil {
+		return nil, ErrStorageService
+	}
+	if gracePeriod < minOrphanGracePeriod {
+		gracePeriod = minOrphanGracePeriod
+	}
+
+	report := &ReconcileReport{
+		OrphanObjects:  []string{},
+		Unreferenced:   []string{},
+		MissingObjects: []string{},
+		StaleObjects:   []string{},
+		Repaired:       repair,
+		StartedAt:      time.Now(),
+	}
+
+	// 逐个对象按对象位置查找任务，不在内存中保存整个存储桶的对象列表
+	// 任务和附件记录都在对象上传前创建，因此不会把新对象误判为孤儿
+	var lookupErr error
+	// 对象按键排序返回，同一任务的派生对象相邻，只查找一次源任务
+	var derivedPrefix string
+	var derivedJob *UploadJob
+	var derivedErr error
+	err := storageService.ListFiles(defaultBucket, "", func(info FileInfo) bool {
+		if isAttachmentObject(info.Key) {
+			report.ScannedObjects++
+			if report.StartedAt.Sub(info.LastModified) < gracePeriod {
+				return true
+			}
+			referenced, err := attachmentRepo.ReferencesObject(ctx, defaultBucket, info.Key)
+			if err != nil {
+				lookupErr = err
+				return false
+			}
+			if !referenced {
+				report.Unreferenced = append(report.Unreferenced, info.Key)
+			}
+			return true
+		}
+		if !isUploadJobObject(info.Key) {
+			return true
+		}
+		report.ScannedObjects++
+
+		// 派生对象 (事件片段) 归属于源任务，按源任务判断
+		var job *UploadJob
+		var err error
+		if prefix, ok := derivedObjectPrefix(info.Key); ok {
+			if prefix != derivedPrefix {
+				derivedPrefix = prefix
+				derivedJob, derivedErr = findDerivedSourceJob(ctx, defaultBucket, prefix)
+			}
+			job, err = derivedJob, derivedErr
+		} else {
+			job, err = uploadJobRepo.GetByObject(ctx, defaultBucket, info.Key)
+		}
+		if errors.Is(err, ErrJobNotFound) {
+			if report.StartedAt.Sub(info.LastModified) >= gracePeriod {
+				report.OrphanObjects = append(report.OrphanObjects, info.Key)
+			}
+			return true
+		}
+		if err != nil {
+			lookupErr = err
+			return false
+		}
+
+		// 失败和过期是最终状态，残留的对象不会再被使用；同样留出宽限期便于排查
+		if (job.Status == JobStatusFailed || job.Status == JobStatusExpired) && report.StartedAt.Sub(job.UpdatedAt) >= gracePeriod {
+			report.StaleObjects = append(report.StaleObjects, info.Key)
+		}
+		return true
+	})
+	if err == nil {
+		err = lookupErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 遍历结束后再删除，避免边遍历边删除影响存储服务的分页
+	if repair {
+		for _, key := range append(append([]string{}, report.OrphanObjects...), report.StaleObjects...) {
+			if err := storageService.DeleteFile(defaultBucket, key); err != nil {
+				log.Printf("删除孤儿/残留对象 %s 失败: %v", key, err)
+			}
+		}
+	}
+
+	// 再按页遍历任务，逐个检查已完成任务的对象是否存在
+	filter := UploadJobFilter{Status: JobStatusCompleted, Ascending: true, Limit: uploadMaintenanceBatchSize}
+	for {
+		jobs, _, err := uploadJobRepo.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			report.ScannedJobs++
+			// 对账开始后才完成的任务，不在本次检查范围内
+			if job.Bucket != defaultBucket || !job.UpdatedAt.Before(report.StartedAt) {
+				continue
+			}
+
+			exists, err := storageService.FileExists(job.Bucket, job.Key)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				continue
+			}
+
+			report.MissingObjects = append(report.MissingObjects, job.ID)
+			if repair {
+				err := retryUploadJobUpdate(ctx, job, func(job *UploadJob) error {
+					if job.Status != JobStatusCompleted {
+						return nil
+					}
+					job.Status = JobStatusFailed
+					job.FailReason = "存储对象已丢失"
+					job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+					return uploadJobRepo.Update(ctx, job)
+				})
+				if err != nil {
+					log.Printf("标记任务 %s 失败: %v", job.ID, err)
+				}
+			}
+		}
+
+		if len(jobs) < filter.Limit {
+			break
+		}
+		last := jobs[len(jobs)-1]
+		filter.After = &UploadJobCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// 判断对象是否属于上传任务或其派生对象 (附件和tus临时分片有各自的生命周期)
+func isUploadJobObject(key string) bool {
+	return !isAttachmentObject(key) && !strings.HasPrefix(key, tusChunkPrefix)
+}
+
+// 返回派生对象所在的派生前缀 (<源键去扩展名>.derived/)，不是派生对象时返回false
+func derivedObjectPrefix(key string) (string, bool) {
+	i := strings.Index(key, derivedKeyMarker)
+	if i < 0 {
+		return "", false
+	}
+	return key[:i+len(derivedKeyMarker)], true
+}
+
+// 按派生前缀查找源任务。派生前缀去掉了源对象的扩展名，
+// 因此按前缀列出候选任务，再比较候选任务生成的派生前缀
+func findDerivedSourceJob(ctx context.Context, bucket, prefix string) (*UploadJob, error) {
+	base := strings.TrimSuffix(prefix, derivedKeyMarker)
+	job, err := uploadJobRepo.GetByObject(ctx, bucket, base)
+	if err == nil || !errors.Is(err, ErrJobNotFound) {
+		return job, err
+	}
+
+	jobs, _, err := uploadJobRepo.List(ctx, UploadJobFilter{Bucket: bucket, KeyPrefix: base + "."})
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		if GenerateDerivedStorageKey(jobs[i].Key, "") == prefix {
+			return &jobs[i], nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// 判断对象是否属于图片附件 (原图及其缩略图)
+func isAttachmentObject(key string) bool {
+	return strings.HasPrefix(key, "attachments/")
+}
+
+// ReconcileStorage 手动触发存储对账
+// POST /api/v1/storage/reconcile?repair=true
+// 修复会删除对象，需要在Authorization头中携带存储管理令牌 (不接受存储事件回调密钥)
+func ReconcileStorage(c *gin.Context) {
+	if storageAdminToken == "" {
+		errorResponse(c, http.StatusServiceUnavailable, "未配置存储管理令牌，无法认证对账请求")
+		return
+	}
+	if !matchBearerToken(c.GetHeader("Authorization"), storageAdminToken) {
+		errorResponse(c, http.StatusUnauthorized, "存储对账认证失败")
+		return
+	}
+
+	// 默认与定时对账使用相同的宽限期
+	gracePeriod := reconcileGracePeriod
+	if gracePeriod < minOrphanGracePeriod {
+		gracePeriod = minOrphanGracePeriod
+	}
+	if value := c.Query("grace_period"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "grace_period格式错误，例如1h")
+			return
+		}
+		if parsed < minOrphanGracePeriod {
+			errorResponse(c, http.StatusBadRequest, "grace_period不能小于"+minOrphanGracePeriod.String())
+			return
+		}
+		gracePeriod = parsed
+	}
+
+	report, err := ReconcileUploadObjects(c.Request.Context(), c.Query("repair") == "true", gracePeriod)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, report)
+}
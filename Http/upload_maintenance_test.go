@@ -0,0 +1,280 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 携带认证令牌调用存储对账接口
+func postReconcile(t *testing.T, router *gin.Engine, token, query string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/storage/reconcile"+query, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(w, req)
+
+	var response APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	data, _ := response.Data.(map[string]interface{})
+	return w.Code, data
+}
+
+func TestExpireUploadJobs(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	ctx := context.Background()
+	now := time.Now()
+
+	// job_a: 未上传；job_b: 上传不完整；job_c: 已上传但未回调；job_d: 未过期
+	for _, id := range []string{"job_a", "job_b", "job_c", "job_d"} {
+		job := newTestUploadJob(id, now.Add(-2*time.Hour))
+		if id == "job_d" {
+			job.ExpiresAt = now.Add(time.Hour)
+		}
+		assert.NoError(t, uploadJobRepo.Create(ctx, job))
+	}
+	storage.PutObject(defaultBucket, "dev_001/job_b.wav", strings.NewReader("partial"), "audio/wav",
+		map[string]string{"job_id": "job_b"})
+	storage.PutObject(defaultBucket, "dev_001/job_c.wav", strings.NewReader(strings.Repeat("a", 1024000)), "audio/wav",
+		map[string]string{"job_id": "job_c"})
+
+	n, err := ExpireUploadJobs(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	expected := map[string]UploadJobStatus{
+		"job_a": JobStatusExpired,
+		"job_b": JobStatusExpired,
+		"job_c": JobStatusCompleted,
+		"job_d": JobStatusPending,
+	}
+	for id, status := range expected {
+		job, _ := uploadJobRepo.Get(ctx, id)
+		assert.Equal(t, status, job.Status, id)
+	}
+
+	exists, _ := storage.FileExists(defaultBucket, "dev_001/job_b.wav")
+	assert.False(t, exists)
+
+	// 再次运行不会重复处理
+	n, err = ExpireUploadJobs(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestExpireAttachments(t *testing.T) {
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	now := time.Now()
+
+	// att_a: 已上传但未确认；att_b: 未上传；att_c: 未过期
+	for id, expiresAt := range map[string]time.Time{"att_a": now.Add(-time.Minute), "att_b": now.Add(-time.Minute), "att_c": now.Add(time.Hour)} {
+		attachmentRepo.Create(context.Background(), Attachment{ID: id, Bucket: defaultBucket, Key: "attachments/tree/t1/" + id + ".png", ExpiresAt: expiresAt})
+	}
+	storage.putFile(defaultBucket, &FileInfo{Key: "attachments/tree/t1/att_a.png", LastModified: now})
+
+	n, err := ExpireAttachments(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for id, status := range map[string]AttachmentStatus{"att_a": AttachmentExpired, "att_b": AttachmentExpired, "att_c": AttachmentPending} {
+		attachment, _ := attachmentRepo.Get(context.Background(), id)
+		assert.Equal(t, status, attachment.Status, id)
+	}
+	exists, _ := storage.FileExists(defaultBucket, "attachments/tree/t1/att_a.png")
+	assert.False(t, exists)
+
+	// 过期后不能再确认上传
+	router := setupPlantationRouter()
+	code, _ := doJSON(t, router, "POST", "/api/v1/attachments/att_a/complete", "")
+	assert.Equal(t, http.StatusGone, code)
+
+	n, err = ExpireAttachments(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestReconcileUploadObjects(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	storageAdminToken = "admin-token"
+	router := newTestEngine()
+	ctx := context.Background()
+	past := time.Now().Add(-48 * time.Hour)
+
+	for _, id := range []string{"job_ok", "job_lost"} {
+		job := newTestUploadJob(id, past)
+		job.Status = JobStatusCompleted
+		assert.NoError(t, uploadJobRepo.Create(ctx, job))
+	}
+	// 失败/过期任务残留的对象，刚失败的任务在宽限期内不处理
+	for id, status := range map[string]UploadJobStatus{"job_failed": JobStatusFailed, "job_expired": JobStatusExpired, "job_recent": JobStatusFailed} {
+		job := newTestUploadJob(id, past)
+		job.Status = status
+		if id == "job_recent" {
+			job.UpdatedAt = time.Now()
+		}
+		assert.NoError(t, uploadJobRepo.Create(ctx, job))
+		storage.putFile(defaultBucket, &FileInfo{Key: job.Key, LastModified: past})
+	}
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_ok.wav", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/orphan.wav", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/fresh.wav", LastModified: time.Now()})
+	// 派生对象按源任务判断: 源任务已删除的是孤儿对象，源任务已过期的是残留对象
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_ok.derived/clip_a_0001.wav", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_ok.derived/clip_a_0002.wav", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_deleted.derived/clip_a_0001.wav", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_deleted.derived/clip_b_0001.wav", LastModified: time.Now()})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_expired.derived/clip_a_0001.wav", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/job_recent.derived/clip_a_0001.wav", LastModified: past})
+	// 没有记录的附件对象 (如重启后丢失记录) 只报告，修复时也不删除
+	attachmentRepo.Create(context.Background(), Attachment{ID: "att_ok", Bucket: defaultBucket, Key: "attachments/tree/t1/a.png",
+		ThumbnailKey: "attachments/tree/t1/a.derived/thumbnail.jpg"})
+	storage.putFile(defaultBucket, &FileInfo{Key: "attachments/tree/t1/a.png", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "attachments/tree/t1/a.derived/thumbnail.jpg", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "attachments/tree/t1/lost.png", LastModified: past})
+
+	// 只报告不修复
+	code, data := postReconcile(t, router, "admin-token", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(15), data["scanned_objects"])
+	assert.ElementsMatch(t, []interface{}{"dev_001/orphan.wav", "dev_001/job_deleted.derived/clip_a_0001.wav"}, data["orphan_objects"])
+	assert.Equal(t, []interface{}{"attachments/tree/t1/lost.png"}, data["unreferenced_attachments"])
+	assert.Equal(t, []interface{}{"job_lost"}, data["missing_objects"])
+	assert.ElementsMatch(t, []interface{}{"dev_001/job_failed.wav", "dev_001/job_expired.wav",
+		"dev_001/job_expired.derived/clip_a_0001.wav"}, data["stale_objects"])
+
+	job, _ := uploadJobRepo.Get(ctx, "job_lost")
+	assert.Equal(t, JobStatusCompleted, job.Status)
+	exists, _ := storage.FileExists(defaultBucket, "dev_001/job_failed.wav")
+	assert.True(t, exists)
+
+	code, data = postReconcile(t, router, "admin-token", "?repair=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, data["repaired"])
+
+	for key, kept := range map[string]bool{
+		"dev_001/orphan.wav":                          false,
+		"dev_001/job_failed.wav":                      false,
+		"dev_001/job_expired.wav":                     false,
+		"dev_001/job_recent.wav":                      true,
+		"dev_001/fresh.wav":                           true,
+		"dev_001/job_ok.derived/clip_a_0001.wav":      true,
+		"dev_001/job_ok.derived/clip_a_0002.wav":      true,
+		"dev_001/job_deleted.derived/clip_a_0001.wav": false,
+		"dev_001/job_deleted.derived/clip_b_0001.wav": true,
+		"dev_001/job_expired.derived/clip_a_0001.wav": false,
+		"dev_001/job_recent.derived/clip_a_0001.wav":  true,
+		"attachments/tree/t1/lost.png":                true,
+		"attachments/tree/t1/a.png":                   true,
+		"attachments/tree/t1/a.derived/thumbnail.jpg": true,
+	} {
+		exists, _ = storage.FileExists(defaultBucket, key)
+		assert.Equal(t, kept, exists, key)
+	}
+	job, _ = uploadJobRepo.Get(ctx, "job_lost")
+	assert.Equal(t, JobStatusFailed, job.Status)
+	assert.Equal(t, "存储对象已丢失", job.FailReason)
+
+	for _, query := range []string{"?grace_period=soon", "?grace_period=0s", "?grace_period=-1h", "?grace_period=5m"} {
+		code, _ = postReconcile(t, router, "admin-token", query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestReconcileKeepsAttachmentsAfterRestart(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	past := time.Now().Add(-48 * time.Hour)
+
+	attachmentRepo.Create(context.Background(), Attachment{ID: "att_1", Bucket: defaultBucket, Key: "attachments/tree/t1/a.png",
+		ThumbnailKey: "attachments/tree/t1/a.derived/thumbnail.jpg"})
+	storage.putFile(defaultBucket, &FileInfo{Key: "attachments/tree/t1/a.png", LastModified: past})
+	storage.putFile(defaultBucket, &FileInfo{Key: "attachments/tree/t1/a.derived/thumbnail.jpg", LastModified: past})
+
+	// 模拟重启: 附件记录全部丢失
+	attachmentRepo = NewMemoryAttachmentRepository()
+	report, err := ReconcileUploadObjects(context.Background(), true, time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, report.OrphanObjects)
+	assert.ElementsMatch(t, []string{"attachments/tree/t1/a.png", "attachments/tree/t1/a.derived/thumbnail.jpg"},
+		report.Unreferenced)
+	for _, key := range []string{"attachments/tree/t1/a.png", "attachments/tree/t1/a.derived/thumbnail.jpg"} {
+		exists, _ := storage.FileExists(defaultBucket, key)
+		assert.True(t, exists, key)
+	}
+}
+
+func TestReconcileStorageAuth(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/orphan.wav", LastModified: time.Now().Add(-48 * time.Hour)})
+
+	// 未配置管理令牌时不允许调用
+	storageAdminToken = ""
+	bucketEventSecret = "event-secret"
+	code, _ := postReconcile(t, router, "", "?repair=true")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = postReconcile(t, router, "event-secret", "?repair=true")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// 存储事件回调密钥不能用于对账
+	storageAdminToken = "admin-token"
+	for _, token := range []string{"", "wrong-secret", "event-secret"} {
+		code, _ = postReconcile(t, router, token, "?repair=true")
+		assert.Equal(t, http.StatusUnauthorized, code, token)
+	}
+	exists, _ := storage.FileExists(defaultBucket, "dev_001/orphan.wav")
+	assert.True(t, exists)
+}
+
+func TestReconcileStorageDefaultGracePeriod(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	attachmentRepo = NewMemoryAttachmentRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	storageAdminToken = "admin-token"
+	router := newTestEngine()
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/orphan.wav", LastModified: time.Now().Add(-2 * time.Hour)})
+
+	// 未指定grace_period时使用配置的宽限期
+	reconcileGracePeriod = 3 * time.Hour
+	code, data := postReconcile(t, router, "admin-token", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, data["orphan_objects"])
+
+	reconcileGracePeriod = time.Hour
+	code, data = postReconcile(t, router, "admin-token", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"dev_001/orphan.wav"}, data["orphan_objects"])
+}
+
+func TestReconcileMinimumGracePeriod(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	storage.putFile(defaultBucket, &FileInfo{Key: "dev_001/recent.wav", LastModified: time.Now().Add(-time.Minute)})
+
+	// 定时对账配置的宽限期过小时按下限处理，不会删除刚上传的对象
+	report, err := ReconcileUploadObjects(context.Background(), true, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, report.OrphanObjects)
+	exists, _ := storage.FileExists(defaultBucket, "dev_001/recent.wav")
+	assert.True(t, exists)
+}
@@ -0,0 +1,396 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 分片上传处理器 ====================
+
+const (
+	defaultPartSize = 8 * 1024 * 1024 // 默认分片大小8MB
+	minPartSize     = 5 * 1024 * 1024 // S3要求除最后一片外每片至少5MB
+	maxPartCount    = 10000           // S3单次分片上传最多10000片
+	minPartURLTTL   = 5 * time.Minute // 分片预签名URL的最短有效期
+)
+
+// 获取支持分片上传的存储服务
+func multipartStorage() (MultipartStorage, error) {
+	if storageService == nil {
+		return nil, ErrStorageService
+	}
+	storage, ok := storageService.(MultipartStorage)
+	if !ok {
+		return nil, ErrMultipartNotSupported
+	}
+	return storage, nil
+}
+
+// CreateMultipartUploadJob 创建分片上传任务，返回每个分片的预签名URL
+// POST /api/v1/jobs/multipart
+func CreateMultipartUploadJob(c *gin.Context) {
+	var req CreateMultipartUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if err := validateUploadJobRequest(&req.CreateUploadJobRequest); err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	partSize := req.PartSize
+	if partSize == 0 {
+		partSize = defaultPartSize
+	}
+	if partSize < minPartSize {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("分片大小不能小于%d字节", minPartSize))
+		return
+	}
+	if partCount(req.FileSize, partSize) > maxPartCount {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("分片数量不能超过%d", maxPartCount))
+		return
+	}
+
+	storage, err := multipartStorage()
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	job, err := newUploadJob(c.Request.Context(), &req.CreateUploadJobRequest)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	uploadID, err := storage.CreateMultipartUpload(job.Bucket, job.Key, job.ContentType, uploadJobMetadata(job))
+	if err != nil {
+		appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: err.Error()})
+		return
+	}
+	job.UploadID = uploadID
+	job.PartSize = partSize
+	job.Status = JobStatusUploading
+
+	parts, err := presignParts(storage, job, allPartNumbers(job))
+	if err == nil {
+		err = uploadJobRepo.Create(c.Request.Context(), job)
+	}
+	if err != nil {
+		if abortErr := storage.AbortMultipartUpload(job.Bucket, job.Key, uploadID); abortErr != nil {
+			log.Printf("取消分片上传失败 %s: %v", uploadID, abortErr)
+		}
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, CreateMultipartUploadResponse{
+		JobID:       job.ID,
+		UploadID:    job.UploadID,
+		Bucket:      job.Bucket,
+		Key:         job.Key,
+		PartSize:    job.PartSize,
+		PartCount:   len(parts),
+		Parts:       parts,
+		ExpiresAt:   job.ExpiresAt,
+		ContentType: job.ContentType,
+		Status:      string(job.Status),
+		CreatedAt:   job.CreatedAt,
+	})
+}
+
+// ListUploadJobParts 列出已上传的分片，并为缺失的分片重新生成预签名URL，用于断线续传
+// GET /api/v1/jobs/:id/parts
+func ListUploadJobParts(c *gin.Context) {
+	job, storage, err := getMultipartJob(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	uploaded, err := storage.ListParts(job.Bucket, job.Key, job.UploadID)
+	if err != nil {
+		appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: err.Error()})
+		return
+	}
+
+	// 大小与分片规划不符的分片需要重传，同一序号重新PUT会覆盖原分片
+	valid, invalid := checkPartSizes(job, uploaded)
+	missing := missingPartNumbers(job, valid)
+	urls, err := presignParts(storage, job, missing)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"job_id":        job.ID,
+		"upload_id":     job.UploadID,
+		"part_size":     job.PartSize,
+		"part_count":    partCount(job.FileSize, job.PartSize),
+		"uploaded":      valid,
+		"invalid_parts": invalid,
+		"missing_parts": missing,
+		"parts":         urls,
+	})
+}
+
+// CompleteMultipartUploadJob 合并分片并校验最终对象
+// POST /api/v1/jobs/:id/multipart/complete
+func CompleteMultipartUploadJob(c *gin.Context) {
+	var req CompleteMultipartUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		errorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	job, err := uploadJobRepo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	if job.UploadID == "" {
+		appErrorResponse(c, ErrNotMultipart)
+		return
+	}
+
+	etag := ""
+	if job.Status == JobStatusUploading {
+		// 与签发分片URL一致，过期但尚未被清理的任务不能再合并，避免与过期清理的取消并发
+		if !time.Now().Before(job.ExpiresAt) {
+			appErrorResponse(c, ErrUploadGone)
+			return
+		}
+		etag, err = mergeUploadJobParts(job, req.Parts)
+		if err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+	}
+
+	job, err = completeUploadJob(c.Request.Context(), job, etag)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"message": "分片上传完成",
+		"job_id":  job.ID,
+		"status":  string(job.Status),
+		"etag":    job.ETag,
+	})
+}
+
+// AbortMultipartUploadJob 取消分片上传，释放已上传的分片
+// DELETE /api/v1/jobs/:id/multipart
+func AbortMultipartUploadJob(c *gin.Context) {
+	job, storage, err := getMultipartJob(c)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	if err := storage.AbortMultipartUpload(job.Bucket, job.Key, job.UploadID); err != nil {
+		appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: err.Error()})
+		return
+	}
+
+	// 取消期间任务可能被过期清理或完成请求修改，冲突时重新读取后再判断
+	ctx := c.Request.Context()
+	err = retryUploadJobUpdate(ctx, job, func(job *UploadJob) error {
+		switch job.Status {
+		case JobStatusFailed, JobStatusExpired:
+			return nil
+		case JobStatusUploading:
+		default:
+			return ErrMultipartClosed
+		}
+		job.Status = JobStatusFailed
+		job.FailReason = "分片上传已取消"
+		job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+		return uploadJobRepo.Update(ctx, job)
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"message": "分片上传已取消",
+		"job_id":  job.ID,
+		"status":  string(job.Status),
+	})
+}
+
+// ==================== 辅助函数 ====================
+
+// 获取上传中的分片任务
+func getMultipartJob(c *gin.Context) (*UploadJob, MultipartStorage, error) {
+	job, err := uploadJobRepo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.UploadID == "" {
+		return nil, nil, ErrNotMultipart
+	}
+	if job.Status != JobStatusUploading {
+		return nil, nil, ErrMultipartClosed
+	}
+	if !time.Now().Before(job.ExpiresAt) {
+		return nil, nil, ErrUploadGone
+	}
+
+	storage, err := multipartStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, storage, nil
+}
+
+// 确认分片齐全后合并，返回对象ETag
+// 合并成功但任务状态未保存时重试，对象已存在则直接进入校验
+func mergeUploadJobParts(job *UploadJob, expected []UploadedPart) (string, error) {
+	storage, err := multipartStorage()
+	if err != nil {
+		return "", err
+	}
+
+	if exists, err := storageService.FileExists(job.Bucket, job.Key); err == nil && exists {
+		return "", nil
+	}
+
+	uploaded, err := storage.ListParts(job.Bucket, job.Key, job.UploadID)
+	if err != nil {
+		return "", AppError{Code: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+
+	valid, invalid := checkPartSizes(job, uploaded)
+	if len(invalid) > 0 {
+		return "", AppError{Code: http.StatusConflict, Message: fmt.Sprintf("分片大小与分片规划不符，需要重传: %v", invalid)}
+	}
+	if missing := missingPartNumbers(job, valid); len(missing) > 0 {
+		return "", AppError{Code: http.StatusConflict, Message: fmt.Sprintf("分片未全部上传，缺少: %v", missing)}
+	}
+
+	// 客户端提供了分片ETag时与存储服务核对，防止分片被覆盖
+	if len(expected) > 0 {
+		etags := make(map[int]string, len(uploaded))
+		for _, part := range uploaded {
+			etags[part.PartNumber] = normalizeETag(part.ETag)
+		}
+		if len(expected) != len(uploaded) {
+			return "", AppError{Code: http.StatusBadRequest, Message: "分片数量不一致"}
+		}
+		for _, part := range expected {
+			if etags[part.PartNumber] != normalizeETag(part.ETag) {
+				return "", AppError{Code: http.StatusBadRequest, Message: fmt.Sprintf("分片%d的ETag不一致", part.PartNumber)}
+			}
+		}
+	}
+
+	etag, err := storage.CompleteMultipartUpload(job.Bucket, job.Key, job.UploadID, uploaded)
+	if err != nil {
+		return "", AppError{Code: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+	return etag, nil
+}
+
+// 释放未完成的分片上传 (任务过期或删除时)，失败只记录日志
+func abortUnfinishedMultipart(job *UploadJob) {
+	if job.UploadID == "" || job.Status != JobStatusUploading {
+		return
+	}
+	storage, err := multipartStorage()
+	if err != nil {
+		return
+	}
+	if err := storage.AbortMultipartUpload(job.Bucket, job.Key, job.UploadID); err != nil {
+		log.Printf("取消分片上传 %s 失败: %v", job.UploadID, err)
+	}
+}
+
+// 为指定分片生成预签名URL，有效期到任务过期为止
+// 剩余时间为0时存储服务会改用默认有效期，因此已过期的任务直接拒绝，临近过期的任务至少给minPartURLTTL
+func presignParts(storage MultipartStorage, job *UploadJob, numbers []int) ([]PresignedPart, error) {
+	ttl := time.Until(job.ExpiresAt)
+	if ttl <= 0 {
+		return nil, ErrUploadGone
+	}
+	if ttl < minPartURLTTL {
+		ttl = minPartURLTTL
+	}
+	parts := make([]PresignedPart, 0, len(numbers))
+	for _, number := range numbers {
+		url, err := storage.GeneratePresignedPartURL(job.Bucket, job.Key, job.UploadID, number, ttl)
+		if err != nil {
+			return nil, AppError{Code: http.StatusInternalServerError, Message: "生成预签名URL失败: " + err.Error()}
+		}
+		parts = append(parts, PresignedPart{PartNumber: number, UploadURL: url})
+	}
+	return parts, nil
+}
+
+// 分片序号对应的应有大小，除最后一片外都等于PartSize
+func expectedPartSize(job *UploadJob, number int) int64 {
+	if number < partCount(job.FileSize, job.PartSize) {
+		return job.PartSize
+	}
+	return job.FileSize - int64(number-1)*job.PartSize
+}
+
+// 按分片规划检查已上传分片的大小，返回大小正确的分片和大小不符的分片序号
+// 超出分片数量的序号同样视为不符
+func checkPartSizes(job *UploadJob, uploaded []UploadedPart) ([]UploadedPart, []int) {
+	count := partCount(job.FileSize, job.PartSize)
+	valid := make([]UploadedPart, 0, len(uploaded))
+	invalid := make([]int, 0)
+	for _, part := range uploaded {
+		if part.PartNumber < 1 || part.PartNumber > count || part.Size != expectedPartSize(job, part.PartNumber) {
+			invalid = append(invalid, part.PartNumber)
+			continue
+		}
+		valid = append(valid, part)
+	}
+	return valid, invalid
+}
+
+// 计算分片数量 (空文件也需要一个分片)
+func partCount(fileSize, partSize int64) int {
+	if fileSize <= 0 {
+		return 1
+	}
+	return int((fileSize + partSize - 1) / partSize)
+}
+
+// 任务的全部分片序号
+func allPartNumbers(job *UploadJob) []int {
+	numbers := make([]int, partCount(job.FileSize, job.PartSize))
+	for i := range numbers {
+		numbers[i] = i + 1
+	}
+	return numbers
+}
+
+// 尚未上传的分片序号
+func missingPartNumbers(job *UploadJob, uploaded []UploadedPart) []int {
+	done := make(map[int]bool, len(uploaded))
+	for _, part := range uploaded {
+		done[part.PartNumber] = true
+	}
+
+	missing := make([]int, 0)
+	for _, number := range allPartNumbers(job) {
+		if !done[number] {
+			missing = append(missing, number)
+		}
+	}
+	return missing
+}
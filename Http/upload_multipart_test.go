@@ -0,0 +1,269 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartUploadResume(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	// 12MB文件，按5MB分3片
+	fileSize := 12 * 1024 * 1024
+	content := bytes.Repeat([]byte("a"), fileSize)
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"long.wav","file_size":12582912,"file_type":"wav","content_type":"audio/wav","part_size":5242880}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), data["part_count"])
+	assert.Equal(t, "uploading", data["status"])
+	assert.Len(t, data["parts"], 3)
+	jobID := data["job_id"].(string)
+	uploadID := data["upload_id"].(string)
+
+	// 上传第1片后断线
+	storage.uploadPart(uploadID, 1, content[:minPartSize])
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", "")
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID+"/parts", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, data["uploaded"], 1)
+	assert.Equal(t, []interface{}{float64(2), float64(3)}, data["missing_parts"])
+	assert.Len(t, data["parts"], 2)
+
+	// 续传剩余分片
+	storage.uploadPart(uploadID, 2, content[minPartSize:2*minPartSize])
+	storage.uploadPart(uploadID, 3, content[2*minPartSize:])
+
+	code, data = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "completed", data["status"])
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	info, err := storage.GetFileInfo(job.Bucket, job.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(fileSize), info.Size)
+	assert.Equal(t, info.ETag, data["etag"])
+
+	// 重复完成幂等，分片接口不再可用
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID+"/parts", "")
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+func TestMultipartUploadETagCheckAndAbort(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), data["part_count"])
+	jobID := data["job_id"].(string)
+	uploadID := data["upload_id"].(string)
+
+	storage.uploadPart(uploadID, 1, []byte(strings.Repeat("a", 1000)))
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", `{"parts":[{"part_number":1,"etag":"bogus"}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, data = doJSON(t, router, "DELETE", "/api/v1/jobs/"+jobID+"/multipart", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "failed", data["status"])
+
+	_, err := storage.ListParts(defaultBucket, "", uploadID)
+	assert.Error(t, err)
+
+	code, _ = doJSON(t, router, "DELETE", "/api/v1/jobs/"+jobID+"/multipart", "")
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+// 取消分片上传时模拟其他请求同时修改了任务
+type concurrentAbortStorage struct {
+	*mockStorageService
+	onAbort func()
+}
+
+func (s *concurrentAbortStorage) AbortMultipartUpload(bucket, key, uploadID string) error {
+	s.onAbort()
+	return s.mockStorageService.AbortMultipartUpload(bucket, key, uploadID)
+}
+
+func TestMultipartUploadAbortConflict(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	router := newTestEngine()
+	ctx := context.Background()
+
+	var jobID string
+	storageService = &concurrentAbortStorage{
+		mockStorageService: newMockStorageService(),
+		onAbort: func() {
+			job, _ := uploadJobRepo.Get(ctx, jobID)
+			job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+			assert.NoError(t, uploadJobRepo.Update(ctx, job))
+		},
+	}
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	jobID = data["job_id"].(string)
+
+	code, data = doJSON(t, router, "DELETE", "/api/v1/jobs/"+jobID+"/multipart", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "failed", data["status"])
+
+	job, _ := uploadJobRepo.Get(ctx, jobID)
+	assert.Equal(t, JobStatusFailed, job.Status)
+	assert.Equal(t, "分片上传已取消", job.FailReason)
+}
+
+func TestMultipartUploadVerificationFailure(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	jobID := data["job_id"].(string)
+	storage.uploadPart(data["upload_id"].(string), 1, []byte(strings.Repeat("a", 1000)))
+	// 合并后的对象与任务不符 (如合并成功、状态未保存时对象被覆盖)
+	storage.PutObject(defaultBucket, data["key"].(string), strings.NewReader(strings.Repeat("a", 999)), "audio/wav",
+		map[string]string{"job_id": jobID})
+
+	// 合并后UploadID失效，无法重传分片，校验失败即为最终结果
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusFailed, job.Status)
+	assert.Contains(t, job.FailReason, "文件大小不一致")
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+}
+
+func TestMultipartUploadPartSizes(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	// 11MB文件，按5MB分3片，最后一片1MB
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"long.wav","file_size":11534336,"file_type":"wav","content_type":"audio/wav","part_size":5242880}`)
+	assert.Equal(t, http.StatusOK, code)
+	jobID := data["job_id"].(string)
+	uploadID := data["upload_id"].(string)
+
+	storage.uploadPart(uploadID, 1, bytes.Repeat([]byte("a"), minPartSize))
+	storage.uploadPart(uploadID, 2, bytes.Repeat([]byte("a"), minPartSize-1))
+	storage.uploadPart(uploadID, 3, bytes.Repeat([]byte("a"), 1024*1024))
+	storage.uploadPart(uploadID, 4, []byte("extra"))
+
+	// 大小不符和超出规划的分片需要重传
+	code, data = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID+"/parts", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, data["uploaded"], 2)
+	assert.Equal(t, []interface{}{float64(2), float64(4)}, data["invalid_parts"])
+	assert.Equal(t, []interface{}{float64(2)}, data["missing_parts"])
+	assert.Len(t, data["parts"], 1)
+
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", "")
+	assert.Equal(t, http.StatusConflict, code)
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusUploading, job.Status)
+}
+
+func TestMultipartUploadExpired(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	jobID := data["job_id"].(string)
+	ctx := context.Background()
+
+	// 临近过期时分片URL至少有minPartURLTTL的有效期
+	job, _ := uploadJobRepo.Get(ctx, jobID)
+	job.ExpiresAt = time.Now().Add(time.Second)
+	assert.NoError(t, uploadJobRepo.Update(ctx, job))
+	parts, err := presignParts(storage, job, []int{1})
+	assert.NoError(t, err)
+	assert.Contains(t, parts[0].UploadURL, "expires=300")
+
+	// 过期但尚未被清理的任务不再签发分片URL
+	job.ExpiresAt = time.Now().Add(-time.Second)
+	assert.NoError(t, uploadJobRepo.Update(ctx, job))
+	code, _ = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID+"/parts", "")
+	assert.Equal(t, http.StatusGone, code)
+	_, err = presignParts(storage, job, []int{1})
+	assert.Equal(t, ErrUploadGone, err)
+
+	// 也不能再合并分片，任务留给过期清理处理
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/"+jobID+"/multipart/complete", `{}`)
+	assert.Equal(t, http.StatusGone, code)
+	job, _ = uploadJobRepo.Get(ctx, jobID)
+	assert.Equal(t, JobStatusUploading, job.Status)
+	exists, _ := storage.FileExists(defaultBucket, job.Key)
+	assert.False(t, exists)
+}
+
+func TestMultipartUploadValidation(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	code, _ := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav","part_size":1024}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 普通任务不能使用分片接口
+	jobID, _ := createTestJob(t, router)
+	code, _ = doJSON(t, router, "GET", "/api/v1/jobs/"+jobID+"/parts", "")
+	assert.Equal(t, http.StatusConflict, code)
+
+	// 存储服务不支持分片上传
+	storageService = struct{ StorageService }{newMockStorageService()}
+	code, _ = doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusNotImplemented, code)
+	storageService = newMockStorageService()
+}
+
+func TestExpireMultipartUploadAborts(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	code, data := doJSON(t, router, "POST", "/api/v1/jobs/multipart",
+		`{"device_id":"dev_001","file_name":"a.wav","file_size":1000,"file_type":"wav","content_type":"audio/wav"}`)
+	assert.Equal(t, http.StatusOK, code)
+	uploadID := data["upload_id"].(string)
+	storage.uploadPart(uploadID, 1, []byte("partial"))
+
+	n, err := ExpireUploadJobs(context.Background(), time.Now().Add(48*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = storage.ListParts(defaultBucket, "", uploadID)
+	assert.Error(t, err)
+}
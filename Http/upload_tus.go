@@ -0,0 +1,649 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== tus 断点续传协议 ====================
+// 实现 tus 1.0.0 核心协议及 creation、expiration、termination、checksum 扩展
+// 无法直连S3的网关通过本服务上传，分片先写入存储服务的临时对象，收齐后合并为任务对象
+// 同一上传的PATCH由进程内的uploadLocks串行化，tus只支持单副本部署 (或按URL路径会话保持)
+
+const (
+	tusVersion            = "1.0.0"
+	tusExtensions         = "creation,expiration,termination,checksum"
+	tusChecksumAlgorithms = "md5,sha1,sha256"
+	tusChunkContentType   = "application/offset+octet-stream"
+	tusChunkPrefix        = ".tus/"       // 临时分片对象前缀，不参与存储对账
+	tusUnverifiedSuffix   = ".unverified" // 未校验标记：带校验和的PATCH在校验通过前，从该偏移量起的分片不计入已接收数据
+	tusSubChunkSize       = 1 << 20       // 每个临时分片对象最多1MB，连接中断时已接收的完整分片不会丢失
+	tusBasePath           = "/api/v1/tus"
+)
+
+// TusMiddleware 设置 Tus-Resumable 响应头，并拒绝不支持的协议版本
+func TusMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			errorResponse(c, http.StatusPreconditionFailed, "不支持的tus协议版本")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TusOptions 返回服务端支持的协议版本和扩展
+// OPTIONS /api/v1/tus
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(maxUploadFileSize, 10))
+	c.Header("Tus-Checksum-Algorithm", tusChecksumAlgorithms)
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTusUpload 创建tus上传
+// POST /api/v1/tus
+// Upload-Metadata 携带 job_id 时续用已有的待上传任务，否则根据 device_id、filename 等字段创建新任务
+func CreateTusUpload(c *gin.Context) {
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		errorResponse(c, http.StatusBadRequest, "不支持延迟指定Upload-Length")
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		errorResponse(c, http.StatusBadRequest, "Upload-Length缺失或格式错误")
+		return
+	}
+	if length > maxUploadFileSize {
+		appErrorResponse(c, ErrFileTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Upload-Metadata格式错误: "+err.Error())
+		return
+	}
+
+	if storageService == nil {
+		appErrorResponse(c, ErrStorageService)
+		return
+	}
+
+	ctx := c.Request.Context()
+	location := ""
+	if jobID := metadata["job_id"]; jobID != "" {
+		job, err := uploadJobRepo.Get(ctx, jobID)
+		if err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+		if job.Status != JobStatusPending || job.UploadID != "" {
+			appErrorResponse(c, ErrJobNotPending)
+			return
+		}
+		if job.FileSize != length {
+			errorResponse(c, http.StatusBadRequest, "Upload-Length与任务文件大小不一致")
+			return
+		}
+
+		location = tusLocation(job.ID)
+		job.UploadURL = location
+		job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+		if err := uploadJobRepo.Update(ctx, job); err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+		c.Header("Upload-Expires", job.ExpiresAt.UTC().Format(http.TimeFormat))
+	} else {
+		req := tusUploadJobRequest(metadata, length)
+		if req.DeviceID == "" || req.FileName == "" {
+			errorResponse(c, http.StatusBadRequest, "Upload-Metadata缺少device_id或filename")
+			return
+		}
+		if err := validateUploadJobRequest(&req); err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+
+		job, err := newUploadJob(ctx, &req)
+		if err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+		location = tusLocation(job.ID)
+		job.UploadURL = location
+		if err := uploadJobRepo.Create(ctx, job); err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+		c.Header("Upload-Expires", job.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+
+	c.Header("Location", location)
+	c.Status(http.StatusCreated)
+}
+
+// GetTusUploadOffset 查询已接收的字节数，客户端据此续传
+// HEAD /api/v1/tus/:id
+func GetTusUploadOffset(c *gin.Context) {
+	// PATCH写入期间偏移量尚未确定，返回423由客户端稍后重试
+	jobID := c.Param("id")
+	if _, busy := uploadLocks.LoadOrStore(jobID, struct{}{}); busy {
+		appErrorResponse(c, ErrUploadLocked)
+		return
+	}
+	defer uploadLocks.Delete(jobID)
+
+	job, err := getTusJob(c.Request.Context(), jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	offset, err := tusUploadOffset(job)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(job.FileSize, 10))
+	c.Header("Upload-Expires", job.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// PatchTusUpload 从Upload-Offset处追加数据，收齐后合并对象并完成任务
+// PATCH /api/v1/tus/:id
+func PatchTusUpload(c *gin.Context) {
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType != tusChunkContentType {
+		errorResponse(c, http.StatusUnsupportedMediaType, "Content-Type必须为"+tusChunkContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		errorResponse(c, http.StatusBadRequest, "Upload-Offset缺失或格式错误")
+		return
+	}
+	checksum, expected, err := parseTusChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	jobID := c.Param("id")
+	if _, busy := uploadLocks.LoadOrStore(jobID, struct{}{}); busy {
+		appErrorResponse(c, ErrUploadLocked)
+		return
+	}
+	defer uploadLocks.Delete(jobID)
+
+	ctx := c.Request.Context()
+	job, err := getTusJob(ctx, jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	// 上次带校验和的PATCH中途崩溃时留下的未校验分片，先清理再计算偏移量
+	if err := clearUnverifiedTusChunks(job); err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	current, err := tusUploadOffset(job)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	if offset != current {
+		appErrorResponse(c, ErrUploadOffsetMismatch)
+		return
+	}
+
+	remaining := job.FileSize - offset
+	if c.Request.ContentLength > remaining {
+		appErrorResponse(c, ErrFileTooLarge)
+		return
+	}
+
+	if job.Status != JobStatusCompleted && c.Request.ContentLength != 0 {
+		body := &limitedUploadReader{r: c.Request.Body, remaining: remaining}
+		var reader io.Reader = body
+		if checksum != nil {
+			reader = io.TeeReader(body, checksum)
+		}
+
+		// 带校验和时先写入未校验标记，分片在校验通过后才计入偏移量，进程中途退出也不会留下未校验的数据
+		marker := ""
+		if checksum != nil {
+			marker = tusUnverifiedKey(job.ID, offset)
+			if err := storageService.PutObject(job.Bucket, marker, bytes.NewReader(nil), tusChunkContentType, nil); err != nil {
+				appErrorResponse(c, AppError{Code: http.StatusServiceUnavailable, Message: "写入存储服务失败: " + err.Error()})
+				return
+			}
+		}
+
+		keys, written, writeErr := writeTusChunks(job, offset, reader)
+		// 超出大小、校验失败的数据不保留；带校验和的PATCH未收完时无法校验，同样丢弃
+		mismatch := checksum != nil && writeErr == nil && written > 0 && subtle.ConstantTimeCompare(checksum.Sum(nil), expected) != 1
+		if body.exceeded || mismatch || (checksum != nil && writeErr != nil) {
+			for _, key := range keys {
+				if err := storageService.DeleteFile(job.Bucket, key); err != nil {
+					log.Printf("删除tus分片 %s 失败: %v", key, err)
+				}
+			}
+			written = 0
+		}
+		if marker != "" {
+			// 标记删除失败时分片仍视为未校验，不计入偏移量，下次PATCH前清理
+			if err := storageService.DeleteFile(job.Bucket, marker); err != nil {
+				log.Printf("删除tus未校验标记 %s 失败: %v", marker, err)
+				if written > 0 && writeErr == nil && !mismatch && !body.exceeded {
+					writeErr = AppError{Code: http.StatusServiceUnavailable, Message: "写入存储服务失败: " + err.Error()}
+				}
+				written = 0
+			}
+		}
+		offset += written
+
+		if written > 0 {
+			// 与过期清理、存储事件并发时重新读取任务后再更新状态
+			err := retryUploadJobUpdate(ctx, job, func(job *UploadJob) error {
+				if job.Status != JobStatusPending {
+					return nil
+				}
+				job.Status = JobStatusUploading
+				job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+				return uploadJobRepo.Update(ctx, job)
+			})
+			if err != nil {
+				appErrorResponse(c, err)
+				return
+			}
+		}
+
+		switch {
+		case body.exceeded:
+			appErrorResponse(c, ErrFileTooLarge)
+			return
+		case writeErr != nil:
+			// 已保存的数据计入偏移量，客户端HEAD后从该位置续传
+			c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+			appErrorResponse(c, writeErr)
+			return
+		case mismatch:
+			appErrorResponse(c, ErrChecksumMismatch)
+			return
+		}
+	}
+
+	if offset == job.FileSize {
+		if err := finishTusUpload(ctx, job); err != nil {
+			appErrorResponse(c, err)
+			return
+		}
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Expires", job.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// TerminateTusUpload 终止上传，删除已接收的分片
+// DELETE /api/v1/tus/:id
+func TerminateTusUpload(c *gin.Context) {
+	// 与PATCH使用同一把锁，避免删除分片后正在进行的PATCH继续写入
+	jobID := c.Param("id")
+	if _, busy := uploadLocks.LoadOrStore(jobID, struct{}{}); busy {
+		appErrorResponse(c, ErrUploadLocked)
+		return
+	}
+	defer uploadLocks.Delete(jobID)
+
+	ctx := c.Request.Context()
+	job, err := getTusJob(ctx, jobID)
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+	if job.Status == JobStatusCompleted {
+		appErrorResponse(c, ErrTusUploadCompleted)
+		return
+	}
+
+	discardTusChunks(job)
+	// 与过期清理、存储事件并发时重新读取任务后再更新状态
+	err = retryUploadJobUpdate(ctx, job, func(job *UploadJob) error {
+		switch job.Status {
+		case JobStatusCompleted:
+			return ErrTusUploadCompleted
+		case JobStatusFailed, JobStatusExpired:
+			return nil
+		}
+		job.Status = JobStatusFailed
+		job.FailReason = "上传已取消"
+		job.UpdatedAt = time.Now().Truncate(time.Millisecond)
+		return uploadJobRepo.Update(ctx, job)
+	})
+	if err != nil {
+		appErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ==================== 辅助函数 ====================
+
+// 获取可通过tus上传的任务，已终止或过期的上传返回410 (超过ExpiresAt但清理任务尚未处理的同样视为过期)
+// 只接受经过tus创建接口的任务 (UploadURL为tus地址)，预签名URL和直传任务不能通过tus写入
+func getTusJob(ctx context.Context, id string) (*UploadJob, error) {
+	if storageService == nil {
+		return nil, ErrStorageService
+	}
+
+	job, err := uploadJobRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UploadID != "" {
+		return nil, AppError{Code: http.StatusConflict, Message: "分片上传任务不支持tus上传"}
+	}
+	if job.UploadURL != tusLocation(job.ID) {
+		return nil, ErrNotTusUpload
+	}
+	if job.Status == JobStatusFailed || job.Status == JobStatusExpired {
+		return nil, ErrUploadGone
+	}
+	if job.Status != JobStatusCompleted && !time.Now().Before(job.ExpiresAt) {
+		return nil, ErrUploadGone
+	}
+	return job, nil
+}
+
+// 已接收的字节数，由存储服务中的临时分片推算，重启后仍可续传
+func tusUploadOffset(job *UploadJob) (int64, error) {
+	if job.Status == JobStatusCompleted {
+		return job.FileSize, nil
+	}
+
+	chunks, err := tusChunks(job)
+	if err != nil {
+		return 0, err
+	}
+	var offset int64
+	for _, chunk := range chunks {
+		offset += chunk.Size
+	}
+
+	// 分片已合并但任务未完成 (完成时出错)，对象即为全部数据
+	if offset == 0 {
+		if exists, err := storageService.FileExists(job.Bucket, job.Key); err == nil && exists {
+			return job.FileSize, nil
+		}
+	}
+	return offset, nil
+}
+
+// 按偏移量顺序列出任务已校验的临时分片
+func tusChunks(job *UploadJob) ([]FileInfo, error) {
+	chunks, _, err := listTusChunks(job)
+	return chunks, err
+}
+
+// 列出任务的临时分片，分为已校验的分片和未校验的对象键
+// 未校验的对象键包括最早的未校验标记之后的分片以及标记本身，标记排在最后，按顺序删除时不会让分片重新计入
+func listTusChunks(job *UploadJob) ([]FileInfo, []string, error) {
+	all := make([]FileInfo, 0)
+	err := storageService.ListFiles(job.Bucket, tusChunkPrefix+job.ID+"/", func(info FileInfo) bool {
+		all = append(all, info)
+		return true
+	})
+	if err != nil {
+		return nil, nil, AppError{Code: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+
+	// 分片键按偏移量补零，字典序即字节顺序；标记键排在同一偏移量的分片之后
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+
+	// 最早的标记对应的分片键，该键及之后的分片都未校验
+	boundary := ""
+	markers := make([]string, 0)
+	for _, info := range all {
+		if strings.HasSuffix(info.Key, tusUnverifiedSuffix) {
+			if boundary == "" {
+				boundary = strings.TrimSuffix(info.Key, tusUnverifiedSuffix)
+			}
+			markers = append(markers, info.Key)
+		}
+	}
+
+	chunks := make([]FileInfo, 0, len(all))
+	unverified := make([]string, 0)
+	for _, info := range all {
+		switch {
+		case strings.HasSuffix(info.Key, tusUnverifiedSuffix):
+		case boundary != "" && info.Key >= boundary:
+			unverified = append(unverified, info.Key)
+		default:
+			chunks = append(chunks, info)
+		}
+	}
+	return chunks, append(unverified, markers...), nil
+}
+
+// 删除未校验的分片和标记，分片先于标记删除；任一删除失败时返回错误，避免在残留分片之后继续写入
+func clearUnverifiedTusChunks(job *UploadJob) error {
+	_, unverified, err := listTusChunks(job)
+	if err != nil {
+		return err
+	}
+	for _, key := range unverified {
+		if err := storageService.DeleteFile(job.Bucket, key); err != nil {
+			return AppError{Code: http.StatusServiceUnavailable, Message: "删除未校验的分片失败: " + err.Error()}
+		}
+	}
+	return nil
+}
+
+// 把请求体按tusSubChunkSize拆成多个临时分片依次写入，返回已写入的分片键和字节数
+// 读取请求体出错 (如连接中断) 时，已读到的数据同样写入一个分片，续传时HEAD返回真实的偏移量
+func writeTusChunks(job *UploadJob, offset int64, body io.Reader) ([]string, int64, error) {
+	buf := make([]byte, tusSubChunkSize)
+	keys := make([]string, 0)
+	var written int64
+	for {
+		// 不使用io.ReadFull：它会把连接中断的ErrUnexpectedEOF与正常结束混在一起
+		n := 0
+		var readErr error
+		for n < len(buf) && readErr == nil {
+			var m int
+			m, readErr = body.Read(buf[n:])
+			n += m
+		}
+
+		if n > 0 {
+			key := tusChunkKey(job.ID, offset+written)
+			if err := storageService.PutObject(job.Bucket, key, bytes.NewReader(buf[:n]), tusChunkContentType, nil); err != nil {
+				return keys, written, AppError{Code: http.StatusServiceUnavailable, Message: "写入存储服务失败: " + err.Error()}
+			}
+			keys = append(keys, key)
+			written += int64(n)
+		}
+
+		if readErr == io.EOF {
+			return keys, written, nil
+		}
+		if readErr != nil {
+			return keys, written, AppError{Code: http.StatusBadRequest, Message: "读取上传数据失败: " + readErr.Error()}
+		}
+	}
+}
+
+// 合并临时分片为任务对象，删除分片后校验并完成任务
+func finishTusUpload(ctx context.Context, job *UploadJob) error {
+	chunks, err := tusChunks(job)
+	if err != nil {
+		return err
+	}
+
+	if len(chunks) > 0 {
+		if err := concatTusChunks(job, chunks); err != nil {
+			return AppError{Code: http.StatusServiceUnavailable, Message: "合并上传数据失败: " + err.Error()}
+		}
+		discardTusChunks(job)
+	}
+
+	_, err = completeUploadJob(ctx, job, "")
+	return err
+}
+
+// 依次读取分片写入任务对象，通过管道流式合并，不在内存中缓存整个文件
+func concatTusChunks(job *UploadJob, chunks []FileInfo) error {
+	reader, writer := io.Pipe()
+	go func() {
+		for _, chunk := range chunks {
+			body, err := storageService.GetObject(job.Bucket, chunk.Key)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(writer, body)
+			body.Close()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	err := storageService.PutObject(job.Bucket, job.Key, reader, job.ContentType, uploadJobMetadata(job))
+	// 存储服务提前返回时结束读取协程
+	reader.CloseWithError(err)
+	return err
+}
+
+// 删除任务的临时分片 (任务完成、终止、过期或删除时)，失败只记录日志
+func discardTusChunks(job *UploadJob) {
+	if storageService == nil {
+		return
+	}
+	chunks, unverified, err := listTusChunks(job)
+	if err != nil {
+		log.Printf("列出tus分片失败 %s: %v", job.ID, err)
+		return
+	}
+	keys := make([]string, 0, len(chunks)+len(unverified))
+	for _, chunk := range chunks {
+		keys = append(keys, chunk.Key)
+	}
+	for _, key := range append(keys, unverified...) {
+		if err := storageService.DeleteFile(job.Bucket, key); err != nil {
+			log.Printf("删除tus分片 %s 失败: %v", key, err)
+		}
+	}
+}
+
+// 临时分片的对象键，偏移量补零保证按字典序排列
+func tusChunkKey(jobID string, offset int64) string {
+	return fmt.Sprintf("%s%s/%020d", tusChunkPrefix, jobID, offset)
+}
+
+// 未校验标记的对象键，与该偏移量的分片键相邻
+func tusUnverifiedKey(jobID string, offset int64) string {
+	return tusChunkKey(jobID, offset) + tusUnverifiedSuffix
+}
+
+func tusLocation(jobID string) string {
+	return tusBasePath + "/" + jobID
+}
+
+// 解析Upload-Metadata: 逗号分隔的 "key base64(value)" 键值对
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%s的值不是有效的base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// 根据tus元数据生成创建任务请求，兼容tus客户端常用的filename/filetype字段
+func tusUploadJobRequest(metadata map[string]string, length int64) CreateUploadJobRequest {
+	req := CreateUploadJobRequest{
+		DeviceID:    metadata["device_id"],
+		FileName:    metadata["file_name"],
+		FileSize:    length,
+		FileType:    strings.ToLower(metadata["file_type"]),
+		ContentType: metadata["content_type"],
+		Description: metadata["description"],
+	}
+	if req.FileName == "" {
+		req.FileName = metadata["filename"]
+	}
+	if req.ContentType == "" {
+		req.ContentType = metadata["filetype"]
+	}
+	if req.FileType == "" {
+		req.FileType = strings.ToLower(strings.TrimPrefix(filepath.Ext(req.FileName), "."))
+	}
+	if req.ContentType == "" {
+		req.ContentType = GetContentType(req.FileName)
+	}
+	return req
+}
+
+// 解析Upload-Checksum: "<算法> <base64摘要>"，未提供时返回nil
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+
+	algorithm, encoded, _ := strings.Cut(header, " ")
+	expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, nil, AppError{Code: http.StatusBadRequest, Message: "Upload-Checksum格式错误"}
+	}
+
+	switch algorithm {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	}
+	return nil, nil, AppError{Code: http.StatusBadRequest, Message: "不支持的校验算法: " + algorithm}
+}
@@ -0,0 +1,410 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 发送tus请求，默认携带协议版本头
+func doTus(router *gin.Engine, method, path string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func tusMetadata(pairs ...string) string {
+	encoded := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		encoded = append(encoded, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return strings.Join(encoded, ",")
+}
+
+// 创建一个1000字节的tus上传，返回Location
+func createTusUpload(t *testing.T, router *gin.Engine) string {
+	w := doTus(router, "POST", "/api/v1/tus", map[string]string{
+		"Upload-Length":   "1000",
+		"Upload-Metadata": tusMetadata("device_id", "dev_001", "filename", "a.wav", "filetype", "audio/wav"),
+	}, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	return w.Header().Get("Location")
+}
+
+func patchTus(router *gin.Engine, location, offset, body string, headers map[string]string) *httptest.ResponseRecorder {
+	all := map[string]string{"Content-Type": tusChunkContentType, "Upload-Offset": offset}
+	for name, value := range headers {
+		all[name] = value
+	}
+	return doTus(router, "PATCH", location, all, body)
+}
+
+func TestTusUploadFlow(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	w := doTus(router, "OPTIONS", "/api/v1/tus", nil, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, tusVersion, w.Header().Get("Tus-Version"))
+	assert.Contains(t, w.Header().Get("Tus-Extension"), "checksum")
+
+	location := createTusUpload(t, router)
+	jobID := strings.TrimPrefix(location, "/api/v1/tus/")
+	job, err := uploadJobRepo.Get(context.Background(), jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, "wav", job.FileType)
+	assert.Equal(t, "audio/wav", job.ContentType)
+
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "1000", w.Header().Get("Upload-Length"))
+	assert.Equal(t, tusVersion, w.Header().Get("Tus-Resumable"))
+
+	first := strings.Repeat("a", 400)
+	sum := sha1.Sum([]byte(first))
+	w = patchTus(router, location, "0", first, map[string]string{
+		"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "400", w.Header().Get("Upload-Offset"))
+
+	// 偏移量不一致
+	w = patchTus(router, location, "0", first, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 校验和不一致的分片不保留
+	w = patchTus(router, location, "400", strings.Repeat("b", 100), map[string]string{
+		"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	assert.Equal(t, ErrChecksumMismatch.Code, w.Code)
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, "400", w.Header().Get("Upload-Offset"))
+
+	w = patchTus(router, location, "400", strings.Repeat("b", 600), nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("Upload-Offset"))
+
+	job, _ = uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+
+	body, err := storage.GetObject(job.Bucket, job.Key)
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	assert.Equal(t, first+strings.Repeat("b", 600), string(content))
+
+	// 临时分片已删除
+	chunks, _ := tusChunks(job)
+	assert.Empty(t, chunks)
+
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, "1000", w.Header().Get("Upload-Offset"))
+}
+
+func TestTusUploadRequiresVersion(t *testing.T) {
+	router := newTestEngine()
+
+	req, _ := http.NewRequest("POST", "/api/v1/tus", nil)
+	req.Header.Set("Upload-Length", "1000")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, tusVersion, w.Header().Get("Tus-Version"))
+}
+
+func TestTusUploadExistingJob(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	jobID, _ := createTestJob(t, router)
+
+	w := doTus(router, "POST", "/api/v1/tus", map[string]string{
+		"Upload-Length":   "999",
+		"Upload-Metadata": tusMetadata("job_id", jobID),
+	}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doTus(router, "POST", "/api/v1/tus", map[string]string{
+		"Upload-Length":   "1000",
+		"Upload-Metadata": tusMetadata("job_id", jobID),
+	}, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/api/v1/tus/"+jobID, w.Header().Get("Location"))
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, "/api/v1/tus/"+jobID, job.UploadURL)
+}
+
+func TestTusUploadRequiresTusJob(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	// 预签名URL任务未经过tus创建接口，不能直接HEAD/PATCH
+	jobID, _ := createTestJob(t, router)
+	location := tusLocation(jobID)
+	assert.Equal(t, http.StatusConflict, doTus(router, "HEAD", location, nil, "").Code)
+	assert.Equal(t, http.StatusConflict, patchTus(router, location, "0", "abc", nil).Code)
+	chunks, _ := tusChunks(&UploadJob{ID: jobID, Bucket: defaultBucket})
+	assert.Empty(t, chunks)
+}
+
+func TestCORSPreflightAndTusOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSMiddleware())
+	SetupRoutes(router)
+
+	options := func(path string, preflight bool) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("OPTIONS", path, nil)
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "PATCH")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 其他路由的OPTIONS请求 (无论是否预检) 都直接返回204
+	for _, preflight := range []bool{true, false} {
+		w := options("/api/v1/jobs", preflight)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// 浏览器对tus接口的预检请求由中间件处理
+	w := options("/api/v1/tus/job_1", true)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Tus-Extension"))
+
+	// tus客户端的OPTIONS请求返回协议能力
+	w = options("/api/v1/tus", false)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, tusExtensions, w.Header().Get("Tus-Extension"))
+}
+
+// droppedReader 读完数据后返回连接中断错误
+type droppedReader struct {
+	r io.Reader
+}
+
+func (d *droppedReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestTusUploadSplitsChunks(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+
+	size := tusSubChunkSize*2 + 500
+	w := doTus(router, "POST", "/api/v1/tus", map[string]string{
+		"Upload-Length":   strconv.Itoa(size),
+		"Upload-Metadata": tusMetadata("device_id", "dev_001", "filename", "a.wav", "filetype", "audio/wav"),
+	}, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	location := w.Header().Get("Location")
+	job, _ := uploadJobRepo.Get(context.Background(), strings.TrimPrefix(location, "/api/v1/tus/"))
+
+	// 连接在传完两个完整分片和部分数据后中断，已收到的数据全部保留
+	received := tusSubChunkSize*2 + 100
+	req, _ := http.NewRequest("PATCH", location, &droppedReader{r: strings.NewReader(strings.Repeat("a", received))})
+	req.ContentLength = -1
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", tusChunkContentType)
+	req.Header.Set("Upload-Offset", "0")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	chunks, _ := tusChunks(job)
+	assert.Len(t, chunks, 3)
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, strconv.Itoa(received), w.Header().Get("Upload-Offset"))
+
+	w = patchTus(router, location, strconv.Itoa(received), strings.Repeat("b", size-received), nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	job, _ = uploadJobRepo.Get(context.Background(), job.ID)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+	body, _ := storage.GetObject(job.Bucket, job.Key)
+	content, _ := io.ReadAll(body)
+	assert.Equal(t, strings.Repeat("a", received)+strings.Repeat("b", size-received), string(content))
+}
+
+func TestTusUploadDroppedWithChecksum(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+	location := createTusUpload(t, router)
+
+	// 带校验和的PATCH未收完时无法校验，已收到的数据不保留
+	sum := sha1.Sum([]byte(strings.Repeat("a", 400)))
+	req, _ := http.NewRequest("PATCH", location, &droppedReader{r: strings.NewReader(strings.Repeat("a", 300))})
+	req.ContentLength = -1
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", tusChunkContentType)
+	req.Header.Set("Upload-Offset", "0")
+	req.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	w := doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+}
+
+// 带校验和的PATCH中途退出时留下未校验标记，标记之后的分片不计入偏移量，下次PATCH前清理
+func TestTusUploadUnverifiedChunks(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storage := newMockStorageService()
+	storageService = storage
+	router := newTestEngine()
+	location := createTusUpload(t, router)
+	job, _ := uploadJobRepo.Get(context.Background(), strings.TrimPrefix(location, "/api/v1/tus/"))
+
+	w := patchTus(router, location, "0", strings.Repeat("a", 100), nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	storage.PutObject(job.Bucket, tusUnverifiedKey(job.ID, 100), strings.NewReader(""), tusChunkContentType, nil)
+	storage.PutObject(job.Bucket, tusChunkKey(job.ID, 100), strings.NewReader(strings.Repeat("x", 300)), tusChunkContentType, nil)
+	storage.PutObject(job.Bucket, tusChunkKey(job.ID, 400), strings.NewReader(strings.Repeat("x", 300)), tusChunkContentType, nil)
+
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, "100", w.Header().Get("Upload-Offset"))
+
+	// PATCH写入期间HEAD返回423
+	uploadLocks.Store(job.ID, struct{}{})
+	w = doTus(router, "HEAD", location, nil, "")
+	uploadLocks.Delete(job.ID)
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	sum := sha1.Sum([]byte(strings.Repeat("b", 900)))
+	w = patchTus(router, location, "100", strings.Repeat("b", 900), map[string]string{
+		"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("Upload-Offset"))
+
+	job, _ = uploadJobRepo.Get(context.Background(), job.ID)
+	assert.Equal(t, JobStatusCompleted, job.Status)
+	body, _ := storage.GetObject(job.Bucket, job.Key)
+	content, _ := io.ReadAll(body)
+	assert.Equal(t, strings.Repeat("a", 100)+strings.Repeat("b", 900), string(content))
+	_, unverified, _ := listTusChunks(job)
+	assert.Empty(t, unverified)
+}
+
+func TestTusUploadTooLarge(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	w := doTus(router, "POST", "/api/v1/tus", map[string]string{
+		"Upload-Length":   "999999999999",
+		"Upload-Metadata": tusMetadata("device_id", "dev_001", "filename", "a.wav"),
+	}, "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	location := createTusUpload(t, router)
+
+	// 未声明Content-Length时在读取过程中检查大小
+	req, _ := http.NewRequest("PATCH", location, strings.NewReader(strings.Repeat("a", 1001)))
+	req.ContentLength = -1
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", tusChunkContentType)
+	req.Header.Set("Upload-Offset", "0")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+}
+
+func TestTusUploadTermination(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	location := createTusUpload(t, router)
+	w := patchTus(router, location, "0", strings.Repeat("a", 100), nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doTus(router, "DELETE", location, nil, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	job, _ := uploadJobRepo.Get(context.Background(), strings.TrimPrefix(location, "/api/v1/tus/"))
+	assert.Equal(t, JobStatusFailed, job.Status)
+	chunks, _ := tusChunks(job)
+	assert.Empty(t, chunks)
+}
+
+func TestTusUploadTerminationLocked(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	// PATCH写入期间不允许终止
+	location := createTusUpload(t, router)
+	jobID := strings.TrimPrefix(location, "/api/v1/tus/")
+	uploadLocks.Store(jobID, struct{}{})
+	w := doTus(router, "DELETE", location, nil, "")
+	uploadLocks.Delete(jobID)
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	job, _ := uploadJobRepo.Get(context.Background(), jobID)
+	assert.Equal(t, JobStatusPending, job.Status)
+}
+
+func TestTusUploadExpired(t *testing.T) {
+	uploadJobRepo = NewMemoryUploadJobRepository()
+	storageService = newMockStorageService()
+	router := newTestEngine()
+
+	// 超过有效期但清理任务尚未运行时同样返回410
+	location := createTusUpload(t, router)
+	ctx := context.Background()
+	job, _ := uploadJobRepo.Get(ctx, strings.TrimPrefix(location, "/api/v1/tus/"))
+	job.ExpiresAt = time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	assert.NoError(t, uploadJobRepo.Update(ctx, job))
+
+	w := doTus(router, "HEAD", location, nil, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	w = patchTus(router, location, "0", strings.Repeat("a", 100), nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	metadata, err := parseTusMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential")
+	assert.NoError(t, err)
+	assert.Equal(t, "world_domination_plan.pdf", metadata["filename"])
+	assert.Contains(t, metadata, "is_confidential")
+
+	_, err = parseTusMetadata("filename !!!")
+	assert.Error(t, err)
+}
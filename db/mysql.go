@@ -1,3 +1,38 @@
 package db
 
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
+	_ "github.com/go-sql-driver/mysql" // 注册MySQL驱动
+)
+
+// 连接池参数
+type PoolOptions struct {
+	MaxOpenConns int
+	MaxIdleConns int
+	ConnLifetime time.Duration
+}
+
+// OpenMySQL 打开MySQL连接池并验证连接可用
+func OpenMySQL(dsn string, opts PoolOptions) (*sql.DB, error) {
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开MySQL连接失败: %v", err)
+	}
+
+	conn.SetMaxOpenConns(opts.MaxOpenConns)
+	conn.SetMaxIdleConns(opts.MaxIdleConns)
+	conn.SetConnMaxLifetime(opts.ConnLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("连接MySQL失败: %v", err)
+	}
+
+	return conn, nil
+}
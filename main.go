@@ -16,6 +16,6 @@ func main() {
 	container.Provide(engine)
 	httpserver.SetupRoutes(engine)
 	if err := httpserver.StartServer(cfg, engine); err != nil {
-		log.Fatalf("服务器启动失败", err)
+		log.Fatalf("服务器启动失败: %v", err)
 	}
 }